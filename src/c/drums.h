@@ -1,12 +1,9 @@
 #ifndef DRUMS_H
 #define DRUMS_H
 
-void render_snare(float *out, int sampleRate, int samples);
-void render_kick(float *out, int sampleRate, int samples);
-void render_hihat(float *out, int sampleRate, int samples);
-void render_tom(float *out, int sampleRate, int samples);
-void render_clap(float *out, int sampleRate, int samples);
-int load_wav(const char *path, float **buffer, int *sampleRate);
+/* load_wav decodes a sound file to interleaved float frames with at most two
+ * channels and returns the frame count, or a negative miniaudio result. */
+int load_wav(const char *path, float **buffer, int *sampleRate, int *channels);
 const char *result_description(int code);
 
 #endif
@@ -6,22 +6,108 @@ import (
 	"os"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/ingyamilmolinar/tunkul/internal/audio"
 	game_log "github.com/ingyamilmolinar/tunkul/internal/log"
+	"github.com/ingyamilmolinar/tunkul/internal/midi"
+	"github.com/ingyamilmolinar/tunkul/internal/netsync"
+	"github.com/ingyamilmolinar/tunkul/internal/osc"
 	"github.com/ingyamilmolinar/tunkul/internal/ui"
 )
 
 func main() {
 	logLevel := flag.String("log", "DEBUG", "Log level (DEBUG, INFO, ERROR, NONE)")
 	demo := flag.Bool("demo", false, "run a demo circuit and exit")
+	audioSpec := flag.String("audio", "", "Audio backend (oto, webaudio, null, file:out.wav); empty for the platform default")
+	midiSpec := flag.String("midi", "", "Also send hits to a MIDI output: an ALSA sequencer port (128:0 or a client name such as \"FLUID Synth\"), \"virtual\" for a tunkul port to connect with aconnect, a Web MIDI port name, or \"first\" for the first port; pair with -audio null to drive only external gear")
+	midiInSpec := flag.String("midi-in", "", "MIDI input port, named like -midi; pads record into the rows playing their note and learned CCs move controls")
+	midiClock := flag.String("midi-clock", "", "MIDI clock sync: \"out\" sends clock on the -midi port, \"in\" follows the clock on the -midi-in port")
+	oscAddr := flag.String("osc", "", "Listen for OSC control messages on this UDP address, e.g. :9000")
+	oscOut := flag.String("osc-out", "", "Also send OSC events such as /tunkul/step to this host:port")
+	syncGroup := flag.String("sync", "", "Share tempo and bar phase with other instances on the LAN: a multicast group:port, or \"on\" for the default group")
+	seed := flag.Uint64("seed", 1, "Seed for the randomize and mutate pattern tools; the same seed replays the same variations")
 	flag.Parse()
 
+	be, err := audio.NewBackend(*audioSpec)
+	if err != nil {
+		log.Fatal(err)
+	}
+	audio.SetBackend(be)
+	defer audio.Reset()
+
+	var out midi.Out
+	if *midiSpec != "" {
+		out, err = midi.Open(portSpec(*midiSpec))
+		if err != nil {
+			log.Fatal(err)
+		}
+		s := midi.NewSender(out)
+		defer s.Close()
+		ui.SetMIDIOutput(s)
+	}
+	var in midi.In
+	if *midiInSpec != "" {
+		in, err = midi.OpenIn(portSpec(*midiInSpec))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer in.Close()
+	}
+
 	logger := game_log.New(os.Stdout, game_log.LevelFromString(*logLevel))
 
 	// Create an instance of our game
 	g := ui.New(logger)
+	g.SetSeed(*seed)
 	if *demo {
 		g.RunDemo()
 	}
+	if in != nil {
+		if err := g.SetMIDIInput(in); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *oscAddr != "" {
+		srv, err := osc.Listen(*oscAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer srv.Close()
+		if *oscOut != "" {
+			if err := srv.AddTarget(*oscOut); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := g.SetOSCServer(srv); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *syncGroup != "" {
+		group := *syncGroup
+		if group == "on" {
+			group = netsync.DefaultGroup
+		}
+		sess, err := netsync.Join(group, float64(g.BPM()))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer sess.Close()
+		g.SetNetSync(sess)
+	}
+	switch *midiClock {
+	case "":
+	case "out":
+		if out == nil {
+			log.Fatal("-midi-clock out needs a -midi port")
+		}
+		g.SendMIDIClock(out)
+	case "in":
+		if in == nil {
+			log.Fatal("-midi-clock in needs a -midi-in port")
+		}
+		g.FollowMIDIClock(true)
+	default:
+		log.Fatalf("unknown -midi-clock mode %q", *midiClock)
+	}
 
 	// Optional window settings (not used in WASM, but for desktop builds)
 	ebiten.SetWindowSize(1280, 720)
@@ -34,3 +120,12 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// portSpec maps the "first" port name to the empty spec midi.Open and
+// midi.OpenIn use for the first available port.
+func portSpec(flagValue string) string {
+	if flagValue == "first" {
+		return ""
+	}
+	return flagValue
+}
@@ -2,63 +2,351 @@ package beat
 
 import (
 	"log"
+	"math"
+	"sync"
 	"time"
 )
 
+// PPQN is the resolution of MIDI clock: pulses per quarter note.
+const PPQN = 24
+
+// MIDI real-time and song position messages understood by the scheduler.
+const (
+	MsgSongPosition byte = 0xF2
+	MsgClock        byte = 0xF8
+	MsgStart        byte = 0xFA
+	MsgContinue     byte = 0xFB
+	MsgStop         byte = 0xFC
+)
+
+// clockSmoothing weighs each incoming pulse interval in the tempo estimate.
+const clockSmoothing = 0.1
+
+// maxSlew is how much faster or slower than real time the scheduler may run
+// while pulling its phase onto a shared timeline.
+const maxSlew = 0.05
+
+// Timeline is a beat clock shared with other players, such as a network
+// sync session. A scheduler locked to one takes its tempo and keeps its bar
+// phase aligned with it.
+type Timeline interface {
+	// BeatAt returns the timeline position at t in beats.
+	BeatAt(t time.Time) float64
+	// Tempo returns the timeline tempo in BPM.
+	Tempo() float64
+	// Quantum is the number of beats in a bar, the unit phase is aligned to.
+	Quantum() float64
+}
+
+// Scheduler fires OnTick and OnBeat once per beat, timed either by its own
+// BPM or by an external MIDI clock, OnPulse on the clock pulses in between
+// and OnTransport when playback starts or stops. Its methods are safe for
+// concurrent use; the callbacks and the clock output run with the scheduler
+// locked and must not call back into it.
 type Scheduler struct {
-	BPM         int
+	bpm         int
 	now         func() time.Time
 	last        time.Time
 	OnTick      func(step int)
+	OnBeat      func(step int, at time.Time)  // at is when the beat was due
+	OnPulse     func(pulse int, at time.Time) // pulses 1 to PPQN-1 of each beat
+	OnTransport func(running bool)
 	running     bool
 	currentStep int
-	BeatLength  int
+	beatLength  int
+
+	mu       sync.Mutex
+	clockOut func(msg byte)
+	pulse    int // clock pulses elapsed in the current beat
+
+	// external clock
+	follow   bool
+	lastIn   time.Time
+	pulseDur float64 // smoothed seconds between incoming pulses
+
+	// shared timeline
+	timeline Timeline
+	beats    int       // beats fired since start
+	base     float64   // timeline beat of the first step
+	lastTick time.Time // previous Tick, to rate-limit phase correction
 }
 
 func NewScheduler() *Scheduler {
 	return &Scheduler{
-		BPM:         120,
+		bpm:         120,
 		now:         time.Now,
 		currentStep: 0,
-		BeatLength:  16,
+		beatLength:  16,
 	}
 }
 
 func (s *Scheduler) SetBPM(bpm int) {
-	s.BPM = bpm
+	s.mu.Lock()
+	s.bpm = bpm
+	s.mu.Unlock()
+}
+
+// SetBeatLength sets how many steps the scheduler counts before wrapping.
+func (s *Scheduler) SetBeatLength(n int) {
+	if n <= 0 {
+		return
+	}
+	s.mu.Lock()
+	s.beatLength = n
+	s.currentStep %= n
+	s.mu.Unlock()
+}
+
+// BeatLength returns how many steps the scheduler counts before wrapping.
+func (s *Scheduler) BeatLength() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.beatLength
+}
+
+// Tempo returns the current BPM, which follows the incoming clock when the
+// scheduler is slaved to one.
+func (s *Scheduler) Tempo() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bpm
+}
+
+// SetClockOut makes the scheduler act as a MIDI clock master: send receives
+// 24 PPQN clock pulses while running, plus start, stop and continue. Pass nil
+// to stop sending.
+func (s *Scheduler) SetClockOut(send func(msg byte)) {
+	s.mu.Lock()
+	s.clockOut = send
+	s.mu.Unlock()
 }
 
+// SetTimeline locks the scheduler to tl, or releases it when tl is nil.
+// Playback then starts on the timeline's next bar and drifts back into
+// phase when the timeline moves, rather than jumping.
+func (s *Scheduler) SetTimeline(tl Timeline) {
+	s.mu.Lock()
+	s.timeline = tl
+	s.last = time.Time{}
+	s.pulse = 0
+	s.mu.Unlock()
+}
+
+// Follow slaves the scheduler to the MIDI clock fed to Clock. While
+// following, Tick does nothing and the BPM tracks the incoming tempo.
+func (s *Scheduler) Follow(on bool) {
+	s.mu.Lock()
+	s.follow = on
+	s.lastIn = time.Time{}
+	s.pulseDur = 0
+	s.mu.Unlock()
+}
+
+// Following reports whether the scheduler is slaved to an external clock.
+func (s *Scheduler) Following() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.follow
+}
+
+// Running reports whether the scheduler is playing.
+func (s *Scheduler) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+func (s *Scheduler) send(msg byte) {
+	if s.clockOut != nil {
+		s.clockOut(msg)
+	}
+}
+
+// setRunning starts or stops playback, firing OnTransport when that changes
+// or when restarting is set.
+func (s *Scheduler) setRunning(on, restart bool) {
+	changed := s.running != on
+	s.running = on
+	if (changed || restart) && s.OnTransport != nil {
+		s.OnTransport(on)
+	}
+}
+
+// Start plays from the first step.
 func (s *Scheduler) Start() {
-	s.running = true
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.last = time.Time{}
 	s.currentStep = 0
+	s.pulse = 0
+	s.beats = 0
+	s.setRunning(true, true)
+	s.send(MsgStart)
 	log.Printf("[SCHEDULER] Started")
 }
 
+// Stop pauses playback, keeping the position for Continue.
 func (s *Scheduler) Stop() {
-	s.running = false
-	s.currentStep = 0
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setRunning(false, false)
+	s.send(MsgStop)
 	log.Printf("[SCHEDULER] Stopped")
 }
 
+// Continue resumes playback from the next step.
+func (s *Scheduler) Continue() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = time.Time{}
+	s.pulse = 0
+	s.setRunning(true, false)
+	s.send(MsgContinue)
+	log.Printf("[SCHEDULER] Continued")
+}
+
+// Tick advances the internal clock to now, firing every beat and clock
+// pulse that has come due since the previous call.
 func (s *Scheduler) Tick() {
-	if !s.running || s.BPM <= 0 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running || s.follow || s.bpm <= 0 {
 		return
 	}
 
-	spb := time.Minute / time.Duration(s.BPM)
+	spb := time.Minute / time.Duration(s.bpm)
 	now := s.now()
 
-	if s.last.IsZero() {
+	if s.timeline != nil {
+		if !s.alignTimeline(now) {
+			return
+		}
+		spb = time.Duration(float64(time.Minute) / s.timeline.Tempo())
+	} else if s.last.IsZero() {
 		// Fire immediately on the first call
-		s.last = now.Add(-spb)
+		s.last = now
+		s.pulse = 0
 	}
 
-	for now.Sub(s.last) >= spb {
-		s.last = s.last.Add(spb)
+	for {
+		// Pulses are placed from the beat start so beats never drift.
+		at := s.last.Add(spb * time.Duration(s.pulse) / PPQN)
+		if now.Before(at) {
+			return
+		}
+		s.pulseFired(at)
+		if s.pulse == 0 {
+			s.last = s.last.Add(spb)
+		}
+	}
+}
+
+// alignTimeline schedules the first beat on the timeline's next bar, then
+// nudges the beat grid towards the timeline by at most maxSlew of the time
+// since the previous tick. It reports false if the timeline has no tempo.
+func (s *Scheduler) alignTimeline(now time.Time) bool {
+	tl := s.timeline
+	bpm, q := tl.Tempo(), tl.Quantum()
+	if bpm <= 0 {
+		return false
+	}
+	if q <= 0 {
+		q = 1
+	}
+	spb := float64(time.Minute) / bpm
+	target := tl.BeatAt(now)
+	defer func() { s.lastTick = now }()
+	if s.last.IsZero() {
+		s.base = math.Ceil(target/q) * q
+		s.last = now.Add(time.Duration((s.base - target) * spb))
+		s.pulse = 0
+		s.beats = 0
+		return true
+	}
+	done := s.beats
+	if s.pulse > 0 {
+		done-- // s.last is the start of the beat in progress
+	}
+	local := s.base + float64(done) + float64(now.Sub(s.last))/spb
+	diff := target - local
+	// Whole bars of difference are ignored: they do not change the phase.
+	if wrap := math.Round(diff / q); wrap != 0 {
+		s.base += wrap * q
+		diff -= wrap * q
+	}
+	limit := float64(now.Sub(s.lastTick)) * maxSlew
+	shift := math.Max(-limit, math.Min(limit, diff*spb))
+	s.last = s.last.Add(-time.Duration(shift))
+	return true
+}
+
+// pulseFired advances one clock pulse due at the given time, firing OnTick
+// and OnBeat on beat boundaries and OnPulse between them.
+func (s *Scheduler) pulseFired(at time.Time) {
+	if s.pulse == 0 {
 		if s.OnTick != nil {
 			s.OnTick(s.currentStep)
 		}
-		s.currentStep = (s.currentStep + 1) % s.BeatLength
+		if s.OnBeat != nil {
+			s.OnBeat(s.currentStep, at)
+		}
+		s.currentStep = (s.currentStep + 1) % s.beatLength
+		s.beats++
+	} else if s.OnPulse != nil {
+		s.OnPulse(s.pulse, at)
+	}
+	if !s.follow {
+		s.send(MsgClock)
+	}
+	s.pulse = (s.pulse + 1) % PPQN
+}
+
+// Clock feeds one incoming MIDI message received at the given time. Clock
+// pulses drive the beat and the tempo estimate while following; start, stop,
+// continue and song position move the transport.
+func (s *Scheduler) Clock(msg []byte, at time.Time) {
+	if len(msg) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.follow {
+		return
+	}
+	switch msg[0] {
+	case MsgStart:
+		s.currentStep = 0
+		s.pulse = 0
+		s.setRunning(true, true)
+	case MsgContinue:
+		s.setRunning(true, false)
+	case MsgStop:
+		s.setRunning(false, false)
+	case MsgSongPosition:
+		if len(msg) < 3 {
+			return
+		}
+		pulses := (int(msg[1]) | int(msg[2])<<7) * PPQN / 4 // position is in 16th notes
+		s.currentStep = pulses / PPQN % s.beatLength
+		s.pulse = pulses % PPQN
+		if s.pulse != 0 {
+			// mid-beat: the step in progress has already sounded
+			s.currentStep = (s.currentStep + 1) % s.beatLength
+		}
+	case MsgClock:
+		if !s.lastIn.IsZero() {
+			if d := at.Sub(s.lastIn).Seconds(); d > 0 && d < 1 {
+				if s.pulseDur == 0 {
+					s.pulseDur = d
+				} else {
+					s.pulseDur += (d - s.pulseDur) * clockSmoothing
+				}
+				s.bpm = int(math.Round(60 / (s.pulseDur * PPQN)))
+			}
+		}
+		s.lastIn = at
+		if s.running {
+			s.pulseFired(at)
+		}
 	}
 }
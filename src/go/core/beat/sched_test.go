@@ -8,7 +8,7 @@ import (
 
 func TestSchedulerCatchUp(t *testing.T) {
 	s := NewScheduler()
-	s.BPM = 60 // 1 beat per second
+	s.bpm = 60 // 1 beat per second
 	base := time.Unix(0, 0)
 	now := base
 	s.now = func() time.Time { return now }
@@ -30,3 +30,152 @@ func TestSchedulerCatchUp(t *testing.T) {
 		t.Fatalf("expected catch-up ticks [0 1 2 3], got %v", steps)
 	}
 }
+
+func TestSchedulerSendsMIDIClock(t *testing.T) {
+	s := NewScheduler()
+	s.bpm = 60
+	base := time.Unix(0, 0)
+	now := base
+	s.now = func() time.Time { return now }
+	var msgs []byte
+	var steps []int
+	s.OnTick = func(step int) { steps = append(steps, step) }
+	s.SetClockOut(func(m byte) { msgs = append(msgs, m) })
+
+	s.Start()
+	for ; now.Sub(base) < 2*time.Second; now = now.Add(time.Millisecond) {
+		s.Tick()
+	}
+	s.Stop()
+	if msgs[0] != MsgStart || msgs[len(msgs)-1] != MsgStop {
+		t.Fatalf("transport messages missing: % x ... % x", msgs[0], msgs[len(msgs)-1])
+	}
+	clocks := 0
+	for _, m := range msgs {
+		if m == MsgClock {
+			clocks++
+		}
+	}
+	if clocks != 2*PPQN {
+		t.Fatalf("sent %d clock pulses in 2 beats, want %d", clocks, 2*PPQN)
+	}
+	if !reflect.DeepEqual(steps, []int{0, 1}) {
+		t.Fatalf("steps %v", steps)
+	}
+
+	msgs, steps = nil, nil
+	s.Continue()
+	s.Tick()
+	if !reflect.DeepEqual(msgs, []byte{MsgContinue, MsgClock}) || !reflect.DeepEqual(steps, []int{2}) {
+		t.Fatalf("continue sent % x and fired %v", msgs, steps)
+	}
+}
+
+func TestSchedulerFollowsMIDIClock(t *testing.T) {
+	s := NewScheduler()
+	s.beatLength = 4
+	s.Follow(true)
+	var steps []int
+	s.OnTick = func(step int) { steps = append(steps, step) }
+	at := time.Unix(0, 0)
+	pulse := time.Minute / 90 / PPQN
+	feed := func(n int) {
+		for i := 0; i < n; i++ {
+			s.Clock([]byte{MsgClock}, at)
+			at = at.Add(pulse)
+		}
+	}
+
+	feed(PPQN) // clock before start only sets the tempo
+	if len(steps) != 0 || s.Tempo() != 90 {
+		t.Fatalf("steps %v bpm %d before start", steps, s.Tempo())
+	}
+	s.Tick() // the internal clock stays silent while following
+	s.Clock([]byte{MsgStart}, at)
+	feed(3 * PPQN)
+	if !reflect.DeepEqual(steps, []int{0, 1, 2}) {
+		t.Fatalf("steps %v", steps)
+	}
+	s.Clock([]byte{MsgStop}, at)
+	feed(PPQN)
+	if len(steps) != 3 || s.Running() {
+		t.Fatalf("advanced while stopped: %v", steps)
+	}
+
+	// jump to the second beat (16th note 4) and continue
+	s.Clock([]byte{MsgSongPosition, 4, 0}, at)
+	s.Clock([]byte{MsgContinue}, at)
+	feed(1)
+	if steps[len(steps)-1] != 1 {
+		t.Fatalf("song position ignored: %v", steps)
+	}
+}
+
+// fixedTimeline is a steady timeline with beat 0 at origin.
+type fixedTimeline struct {
+	origin time.Time
+	bpm    float64
+}
+
+func (f *fixedTimeline) BeatAt(t time.Time) float64 {
+	return t.Sub(f.origin).Minutes() * f.bpm
+}
+func (f *fixedTimeline) Tempo() float64   { return f.bpm }
+func (f *fixedTimeline) Quantum() float64 { return 4 }
+
+func TestSchedulerLocksToTimeline(t *testing.T) {
+	base := time.Unix(0, 0)
+	now := base.Add(300 * time.Millisecond) // beat 0.6 at 120 BPM
+	tl := &fixedTimeline{origin: base, bpm: 120}
+	s := NewScheduler()
+	s.now = func() time.Time { return now }
+	var fired []time.Duration
+	s.OnTick = func(int) { fired = append(fired, now.Sub(base)) }
+	s.SetTimeline(tl)
+	s.Start()
+	run := func(until time.Duration) {
+		for ; now.Sub(base) < until; now = now.Add(time.Millisecond) {
+			s.Tick()
+		}
+	}
+
+	run(3 * time.Second)
+	want := []time.Duration{2 * time.Second, 2500 * time.Millisecond}
+	if !reflect.DeepEqual(fired, want) {
+		t.Fatalf("beats at %v, want the next bar %v", fired, want)
+	}
+
+	// Another player moves the timeline 100ms later; the scheduler slews
+	// onto it instead of jumping.
+	tl.origin = tl.origin.Add(100 * time.Millisecond)
+	fired = nil
+	run(10 * time.Second)
+	for i := 1; i < len(fired); i++ {
+		gap := fired[i] - fired[i-1]
+		if gap < 500*time.Millisecond || gap > 526*time.Millisecond {
+			t.Fatalf("beat gap %v exceeds the slew limit: %v", gap, fired)
+		}
+	}
+	last := fired[len(fired)-1] - 100*time.Millisecond
+	if off := last % (500 * time.Millisecond); off > time.Millisecond {
+		t.Fatalf("still %v off the timeline after 7s: %v", off, fired)
+	}
+}
+
+func TestSchedulerReportsTransport(t *testing.T) {
+	s := NewScheduler()
+	var got []bool
+	s.OnTransport = func(running bool) { got = append(got, running) }
+
+	s.Start()
+	s.Start() // a restart is reported again
+	s.Continue()
+	s.Stop()
+	s.Stop()
+	s.Follow(true)
+	s.Clock([]byte{MsgContinue}, time.Now())
+	s.Clock([]byte{MsgStop}, time.Now())
+	if want := []bool{true, true, false, true, false}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("transport changes %v, want %v", got, want)
+	}
+}
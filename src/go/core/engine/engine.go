@@ -2,6 +2,7 @@ package engine
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/ingyamilmolinar/tunkul/core/beat"
@@ -9,44 +10,67 @@ import (
 	game_log "github.com/ingyamilmolinar/tunkul/internal/log"
 )
 
-// Event represents a tick from the game engine.
-type Event struct {
-	Step int
-}
-
 const tickInterval = 16 * time.Millisecond
 
-// Engine encapsulates the core game logic and runs it on its own goroutine.
+// clockTickInterval is used while sending MIDI clock, whose pulses come
+// every 20ms at 120 BPM and must not bunch up between ticks.
+const clockTickInterval = time.Millisecond
+
+// Engine owns the transport and the playback position of every drum row.
+// It walks each row's path through the graph on its own goroutine, plays the
+// hits through the player and reports everything it plays to its
+// subscribers, so it runs the same with or without a UI and independently of
+// any frame rate.
+//
+// Its methods are safe for concurrent use. The graph and the tracks are only
+// edited through Do and the track commands, which never interleave with a
+// beat being played, and readers get a consistent copy from Snapshot.
 type Engine struct {
-	Graph  *model.Graph
 	sched  *beat.Scheduler
-	Events chan Event
 	ctx    context.Context
 	cancel context.CancelFunc
+	rate   chan time.Duration
+
+	mu       sync.Mutex // guards the fields below; held while a beat plays
+	graph    *model.Graph
+	rows     []*row
+	player   func(Event)
+	running  bool     // as last reported by the scheduler
+	quantize Quantize // when edits made while running take effect
+	pending  *State   // edit queued for the next launch boundary
+	clock    int      // clock pulses played, PPQN to a beat
+	step     int      // scheduler step of the beat in progress
+	beats    int      // master beats played since the start, or the last seek
+	// steps caches the scheduler's beat length so Beat, which the
+	// scheduler calls with its lock held, need not lock it again.
+	// SetBeatLength keeps the two in step.
+	steps int
+
+	subMu sync.RWMutex // held for reading while an event is delivered
+	subs  []*Subscription
 }
 
 // New creates a new Engine instance and starts its run loop.
 func New(logger *game_log.Logger) *Engine {
-	graph := model.NewGraph(logger)
-	sched := beat.NewScheduler()
-	ctx, cancel := context.WithCancel(context.Background())
+	e := newEngine(logger)
+	go e.run()
+	return e
+}
 
+// newEngine creates an engine whose scheduler only advances when ticked.
+func newEngine(logger *game_log.Logger) *Engine {
+	ctx, cancel := context.WithCancel(context.Background())
 	e := &Engine{
-		Graph:  graph,
-		sched:  sched,
-		Events: make(chan Event, 16),
+		sched:  beat.NewScheduler(),
+		graph:  model.NewGraph(logger),
 		ctx:    ctx,
 		cancel: cancel,
+		rate:   make(chan time.Duration, 1),
 	}
-
-	sched.OnTick = func(step int) {
-		select {
-		case e.Events <- Event{Step: step}:
-		default:
-		}
-	}
-
-	go e.run()
+	e.steps = e.sched.BeatLength()
+	e.sched.OnBeat = e.Beat
+	e.sched.OnPulse = e.Pulse
+	e.sched.OnTransport = e.transport
 	return e
 }
 
@@ -57,14 +81,19 @@ func (e *Engine) run() {
 		select {
 		case <-ticker.C:
 			e.sched.Tick()
+		case d := <-e.rate:
+			ticker.Reset(d)
 		case <-e.ctx.Done():
 			return
 		}
 	}
 }
 
-// Start begins the scheduler.
-func (e *Engine) Start() { e.sched.Start() }
+// Start rewinds every row and begins the scheduler.
+func (e *Engine) Start() {
+	e.Rewind()
+	e.sched.Start()
+}
 
 // Stop stops the scheduler.
 func (e *Engine) Stop() { e.sched.Stop() }
@@ -72,11 +101,58 @@ func (e *Engine) Stop() { e.sched.Stop() }
 // SetBPM updates the scheduler BPM.
 func (e *Engine) SetBPM(bpm int) { e.sched.SetBPM(bpm) }
 
-// BPM returns the current scheduler BPM.
-func (e *Engine) BPM() int { return e.sched.BPM }
+// BPM returns the current scheduler BPM, which tracks the incoming MIDI
+// clock while following one.
+func (e *Engine) BPM() int { return e.sched.Tempo() }
+
+// SetClockOut sends MIDI clock and transport messages to send, or stops
+// sending them when send is nil.
+func (e *Engine) SetClockOut(send func(msg byte)) {
+	e.sched.SetClockOut(send)
+	d := tickInterval
+	if send != nil {
+		d = clockTickInterval
+	}
+	select {
+	case <-e.rate: // drop a pending change that was never applied
+	default:
+	}
+	e.rate <- d
+}
+
+// FollowClock slaves playback to the MIDI clock passed to Clock.
+func (e *Engine) FollowClock(on bool) { e.sched.Follow(on) }
+
+// SetTimeline locks playback to a shared beat timeline, such as a LAN sync
+// session, or releases it when tl is nil.
+func (e *Engine) SetTimeline(tl beat.Timeline) { e.sched.SetTimeline(tl) }
+
+// Following reports whether playback follows an external MIDI clock.
+func (e *Engine) Following() bool { return e.sched.Following() }
+
+// Clock feeds an incoming MIDI message to the scheduler. It is safe to call
+// from a MIDI input goroutine.
+func (e *Engine) Clock(msg []byte, at time.Time) { e.sched.Clock(msg, at) }
+
+// Running reports whether the scheduler is playing; while following a clock
+// the remote transport decides.
+func (e *Engine) Running() bool { return e.sched.Running() }
 
 // Close terminates the engine goroutine.
 func (e *Engine) Close() { e.cancel() }
 
 // BeatLength exposes the scheduler's beat length.
-func (e *Engine) BeatLength() int { return e.sched.BeatLength }
+func (e *Engine) BeatLength() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.steps
+}
+
+// SetBeatLength sets how many scheduler steps pass between step 0s, where
+// idle rows join.
+func (e *Engine) SetBeatLength(n int) {
+	e.sched.SetBeatLength(n)
+	e.mu.Lock()
+	e.steps = e.sched.BeatLength()
+	e.mu.Unlock()
+}
@@ -0,0 +1,379 @@
+package engine
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ingyamilmolinar/tunkul/core/model"
+	game_log "github.com/ingyamilmolinar/tunkul/internal/log"
+)
+
+var testLogger = game_log.New(io.Discard, game_log.LevelError)
+
+// line adds n regular nodes in a row starting at (0, j), linked left to right.
+func line(g *model.Graph, n, j int) []model.NodeID {
+	ids := make([]model.NodeID, n)
+	for i := range ids {
+		ids[i] = g.AddNode(i, j, model.NodeTypeRegular)
+		if i > 0 {
+			g.Edges[[2]model.NodeID{ids[i-1], ids[i]}] = struct{}{}
+		}
+	}
+	return ids
+}
+
+// square adds a four node loop with its top left corner at (i, j).
+func square(g *model.Graph, i, j int) []model.NodeID {
+	ids := []model.NodeID{
+		g.AddNode(i, j, model.NodeTypeRegular),
+		g.AddNode(i+1, j, model.NodeTypeRegular),
+		g.AddNode(i+1, j+1, model.NodeTypeRegular),
+		g.AddNode(i, j+1, model.NodeTypeRegular),
+	}
+	for k, id := range ids {
+		g.Edges[[2]model.NodeID{id, ids[(k+1)%len(ids)]}] = struct{}{}
+	}
+	return ids
+}
+
+// drain returns the events queued on s.
+func drain(s *Subscription) []Event {
+	var events []Event
+	for {
+		select {
+		case ev := <-s.C:
+			events = append(events, ev)
+		default:
+			return events
+		}
+	}
+}
+
+func TestHitsLandOnBeatGrid(t *testing.T) {
+	e := newEngine(testLogger)
+	var ids []model.NodeID
+	e.Do(func(s *State) {
+		ids = line(s.Graph, 4, 0)
+		s.Tracks = []Track{{Origin: ids[0], Velocity: 1}}
+	})
+	var played []time.Time
+	e.SetPlayer(func(ev Event) { played = append(played, ev.Time) })
+
+	base := time.Unix(0, 0)
+	now := base
+	e.sched.SetNowFunc(func() time.Time { return now })
+	e.SetBPM(120)
+	e.Start()
+	// Ticks arrive with jitter, as frames or timer wakeups would.
+	for i := 0; now.Before(base.Add(1900 * time.Millisecond)); i++ {
+		e.sched.Tick()
+		now = now.Add(time.Duration(5+i%3*11) * time.Millisecond)
+	}
+
+	if len(played) != len(ids) {
+		t.Fatalf("played %d hits, want %d", len(played), len(ids))
+	}
+	for i, at := range played {
+		if want := base.Add(time.Duration(i) * 500 * time.Millisecond); !at.Equal(want) {
+			t.Fatalf("hit %d due at %v, want %v", i, at.Sub(base), want.Sub(base))
+		}
+	}
+}
+
+func TestRowsWalkTheirPaths(t *testing.T) {
+	e := newEngine(testLogger)
+	var loop, straight []model.NodeID
+	e.Do(func(s *State) {
+		loop = square(s.Graph, 0, 0)
+		straight = line(s.Graph, 2, 5)
+		s.Tracks = []Track{{Origin: loop[0], Velocity: 1}, {Origin: straight[0], Velocity: 1}}
+	})
+	hits := e.Subscribe(64, DropNewest, EventHit)
+
+	got := [2][]model.NodeID{}
+	for i := 0; i < 6; i++ {
+		e.Beat(i%4, time.Now())
+		for _, ev := range drain(hits) {
+			got[ev.Row] = append(got[ev.Row], ev.Node)
+		}
+	}
+
+	want := [2][]model.NodeID{
+		{loop[0], loop[1], loop[2], loop[3], loop[0], loop[1]},
+		// the straight row ends after two beats and rejoins on step 0
+		{straight[0], straight[1], straight[0], straight[1]},
+	}
+	for row := range want {
+		if len(got[row]) != len(want[row]) {
+			t.Fatalf("row %d played %v, want %v", row, got[row], want[row])
+		}
+		for i := range want[row] {
+			if got[row][i] != want[row][i] {
+				t.Fatalf("row %d played %v, want %v", row, got[row], want[row])
+			}
+		}
+	}
+}
+
+func TestMutedAndHeardBeatsAreSilent(t *testing.T) {
+	e := newEngine(testLogger)
+	e.Do(func(s *State) {
+		a := line(s.Graph, 2, 0)
+		b := line(s.Graph, 2, 2)
+		s.Tracks = []Track{{Origin: a[0], Velocity: 0.5}, {Origin: b[0], Velocity: 1, Muted: true}}
+	})
+	sub := e.Subscribe(64, DropNewest, EventHit)
+	var played []int
+	e.SetPlayer(func(ev Event) { played = append(played, ev.Row) })
+
+	e.Audition(0, 1)
+	e.Beat(0, time.Now())
+	e.Beat(1, time.Now())
+	if len(played) != 1 || played[0] != 0 {
+		t.Fatalf("played rows %v, want only row 0's first beat", played)
+	}
+	if hits := drain(sub); len(hits) != 4 {
+		t.Fatalf("got %d hit events, want 4 including silent ones", len(hits))
+	}
+}
+
+func TestRecordQuantizesToRowBeats(t *testing.T) {
+	e := newEngine(testLogger)
+	e.SetBPM(120) // a beat every 500ms
+	e.Do(func(s *State) {
+		a := square(s.Graph, 0, 0)
+		b := square(s.Graph, 0, 3)
+		s.Tracks = []Track{{Origin: a[0], Velocity: 1}, {Origin: b[0], Velocity: 1, Rate: Rate{Num: 2, Den: 1}}}
+	})
+	var played []int
+	e.SetPlayer(func(ev Event) { played = append(played, ev.Row) })
+	t0 := time.Now()
+	if _, ok := e.Record(0, t0); ok {
+		t.Fatal("recorded before the row played")
+	}
+	e.Beat(0, t0)
+	for _, c := range []struct {
+		row   int
+		after time.Duration
+		want  int
+	}{
+		{0, 200 * time.Millisecond, 0},
+		{0, -100 * time.Millisecond, 0},
+		{1, 200 * time.Millisecond, 1}, // twice as fast
+		{0, 300 * time.Millisecond, 1},
+	} {
+		if got, ok := e.Record(c.row, t0.Add(c.after)); !ok || got != c.want {
+			t.Fatalf("row %d hit %v after its beat recorded on beat %d (%v), want %d", c.row, c.after, got, ok, c.want)
+		}
+	}
+	played = nil
+	e.Beat(1, t0.Add(500*time.Millisecond))
+	if len(played) != 1 || played[0] != 1 { // only the fast row's beat 2
+		t.Fatalf("played rows %v, want row 1 once: recorded beats sound once", played)
+	}
+	e.Seek(0)
+	if _, ok := e.Record(0, t0); ok {
+		t.Fatal("recorded against a beat from before the seek")
+	}
+}
+
+// TestConcurrentEditsDuringPlayback edits the graph and the tracks, changes
+// the tempo and reads snapshots from several goroutines while the engine
+// plays. Run it with -race.
+func TestConcurrentEditsDuringPlayback(t *testing.T) {
+	e := New(testLogger)
+	defer e.Close()
+	var hits atomic.Int64
+	e.SetPlayer(func(Event) { hits.Add(1) })
+	e.Do(func(s *State) {
+		ids := square(s.Graph, 0, 0)
+		s.Tracks = []Track{{Origin: ids[0], Velocity: 1}}
+	})
+	e.SetBPM(3000)
+	e.Start()
+	defer e.Stop()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	run := func(f func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+					f(i)
+				}
+			}
+		}()
+	}
+	run(func(i int) {
+		e.Do(func(s *State) {
+			ids := line(s.Graph, 1+i%4, 2+i%8)
+			s.Tracks = append(s.Tracks[:1], Track{Origin: ids[0], Velocity: 0.5})
+		})
+	})
+	run(func(i int) {
+		snap := e.Snapshot()
+		if len(snap.Paths) != len(snap.Tracks) || len(snap.Positions) != len(snap.Tracks) {
+			t.Errorf("inconsistent snapshot: %d tracks, %d paths, %d positions", len(snap.Tracks), len(snap.Paths), len(snap.Positions))
+		}
+	})
+	run(func(i int) {
+		e.SetBPM(2000 + i%2*1000)
+		tracks := e.Snapshot().Tracks
+		if len(tracks) > 0 {
+			tracks[0].Muted = i%2 == 0
+			e.SetTracks(tracks)
+		}
+		time.Sleep(time.Millisecond)
+	})
+	time.Sleep(200 * time.Millisecond)
+	close(done)
+	wg.Wait()
+
+	if hits.Load() == 0 {
+		t.Fatal("nothing played during the edits")
+	}
+}
+
+func TestAdvancePanicsOnUnexpectedOrigin(t *testing.T) {
+	r := &row{
+		track:   Track{Origin: 1},
+		path:    Path{Beats: []model.BeatInfo{{NodeID: 1}, {NodeID: 2}, {NodeID: 1}}, Loop: true},
+		origins: []int{0, 2},
+		next:    2,
+		active:  true,
+	}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("expected panic on unexpected origin jump")
+		}
+	}()
+	r.advance(0, 0, time.Now())
+}
+
+func TestAdvanceAllowsRepeatedOrigin(t *testing.T) {
+	r := &row{
+		track:      Track{Origin: 1},
+		path:       Path{Beats: []model.BeatInfo{{NodeID: 1}, {NodeID: 2}, {NodeID: 1}, {NodeID: 2}, {NodeID: 1}}, Loop: true},
+		origins:    []int{0, 2, 4},
+		nextOrigin: 1,
+		next:       2,
+		active:     true,
+	}
+	r.advance(0, 0, time.Now())
+	if r.nextOrigin != 2 {
+		t.Fatalf("next origin %d, want 2", r.nextOrigin)
+	}
+}
+
+func TestAdvanceAllowsIrregularOriginSpacing(t *testing.T) {
+	r := &row{
+		track: Track{Origin: 1},
+		path: Path{Beats: []model.BeatInfo{
+			{NodeID: 1}, {NodeID: 2}, {NodeID: 3}, {NodeID: 4}, {NodeID: 5}, {NodeID: 1},
+		}, Loop: true},
+		origins:    []int{0, 5},
+		nextOrigin: 1,
+		next:       5,
+		active:     true,
+	}
+	r.advance(0, 0, time.Now())
+}
+
+func TestRowLengthsRunAsPolymeter(t *testing.T) {
+	e := newEngine(testLogger)
+	var loop, pair []model.NodeID
+	e.Do(func(s *State) {
+		loop = square(s.Graph, 0, 0)
+		pair = line(s.Graph, 2, 5)
+		s.Tracks = []Track{
+			{Origin: loop[0], Velocity: 1, Length: 3}, // cuts the loop short
+			{Origin: pair[0], Velocity: 1, Length: 5}, // rests after the pair
+		}
+	})
+	sub := e.Subscribe(128, DropNewest, EventHit, EventLoop)
+
+	var got [2][]model.NodeID
+	wraps := [2]int{}
+	for i := 0; i < 15; i++ {
+		e.Beat(i%16, time.Now())
+	}
+	for _, ev := range drain(sub) {
+		if ev.Kind == EventLoop {
+			wraps[ev.Row]++
+			continue
+		}
+		if ev.Velocity == 0 {
+			ev.Node = model.InvalidNodeID
+		}
+		got[ev.Row] = append(got[ev.Row], ev.Node)
+	}
+
+	inv := model.InvalidNodeID
+	want := [2][]model.NodeID{
+		{loop[0], loop[1], loop[2], loop[0], loop[1], loop[2], loop[0], loop[1], loop[2], loop[0], loop[1], loop[2], loop[0], loop[1], loop[2]},
+		{pair[0], pair[1], inv, inv, inv, pair[0], pair[1], inv, inv, inv, pair[0], pair[1], inv, inv, inv},
+	}
+	for row := range want {
+		if len(got[row]) != len(want[row]) {
+			t.Fatalf("row %d played %v, want %v", row, got[row], want[row])
+		}
+		for i := range want[row] {
+			if got[row][i] != want[row][i] {
+				t.Fatalf("row %d played %v, want %v", row, got[row], want[row])
+			}
+		}
+	}
+	if wraps != [2]int{4, 2} {
+		t.Fatalf("loop wraps %v, want [4 2]", wraps)
+	}
+	if c := e.Snapshot().Cycle(); c != 15 {
+		t.Fatalf("cycle %d, want 15", c)
+	}
+}
+
+func TestRowRatesDivideTheClock(t *testing.T) {
+	e := newEngine(testLogger)
+	rates := []Rate{{1, 1}, {1, 2}, {2, 1}, {3, 2}}
+	e.Do(func(s *State) {
+		for i, r := range rates {
+			ids := square(s.Graph, 0, 3*i)
+			s.Tracks = append(s.Tracks, Track{Origin: ids[0], Velocity: 1, Rate: r})
+		}
+	})
+	played := make([][]time.Duration, len(rates))
+	base := time.Unix(0, 0)
+	e.SetPlayer(func(ev Event) { played[ev.Row] = append(played[ev.Row], ev.Time.Sub(base)) })
+
+	now := base
+	e.sched.SetNowFunc(func() time.Time { return now })
+	e.SetBPM(120)
+	e.Start()
+	for i := 0; now.Before(base.Add(1900 * time.Millisecond)); i++ {
+		e.sched.Tick()
+		now = now.Add(time.Duration(5+i%3*11) * time.Millisecond)
+	}
+
+	for row, r := range rates {
+		every := 500 * time.Millisecond * time.Duration(r.Den) / time.Duration(r.Num)
+		want := int((1900*time.Millisecond-1)/every) + 1
+		if len(played[row]) != want {
+			t.Fatalf("rate %v played %v, want %d hits", r, played[row], want)
+		}
+		for i, at := range played[row] {
+			if d := at - time.Duration(i)*every; d < -time.Microsecond || d > time.Microsecond {
+				t.Fatalf("rate %v hit %d at %v, want %v", r, i, at, time.Duration(i)*every)
+			}
+		}
+	}
+	if c := e.Snapshot().Cycle(); c != 8 {
+		t.Fatalf("cycle %d, want 8 master beats", c)
+	}
+}
@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ingyamilmolinar/tunkul/core/model"
+)
+
+// EventKind tells what an Event reports.
+type EventKind int
+
+const (
+	// EventStep marks a scheduler step; only Step and Time are set.
+	EventStep EventKind = iota
+	// EventHit reports a row reaching the next beat of its path. It sounds
+	// when Velocity is above zero.
+	EventHit
+	// EventStart reports the transport starting, locally or from a followed
+	// MIDI clock.
+	EventStart
+	// EventStop reports the transport stopping.
+	EventStop
+	// EventBar marks a step that begins a bar. Bar counts the bars of the
+	// scheduler cycle from 0.
+	EventBar
+	// EventLoop reports a row wrapping back to the start of its loop; Beat
+	// is the position that begins the new lap.
+	EventLoop
+	// EventGraph reports that the graph or the tracks changed, so the paths
+	// were recomputed.
+	EventGraph
+)
+
+// BeatsPerBar is the number of scheduler steps in a bar.
+const BeatsPerBar = 4
+
+// Event is something the engine played or changed.
+type Event struct {
+	Kind       EventKind
+	Step       int // scheduler step, 0 to BeatLength-1
+	Bar        int
+	Row        int
+	Beat       int // absolute position on the row's path
+	Node       model.NodeID
+	NodeType   model.NodeType
+	Next       model.NodeID // node of the following beat, InvalidNodeID at the end of the path
+	Instrument string
+	Velocity   float64   // 0 for beats that do not sound
+	Time       time.Time // when the beat was due
+}
+
+// Policy is what a subscription does with an event that arrives while its
+// queue is full.
+type Policy int
+
+const (
+	// DropNewest discards the arriving event and keeps the queued ones.
+	DropNewest Policy = iota
+	// DropOldest discards the oldest queued event to make room, so a reader
+	// that falls behind still sees the latest events.
+	DropOldest
+	// Block waits for the reader. Playback waits with it, so it suits only
+	// readers that never stall, and they must not read on a goroutine that
+	// calls into the engine.
+	Block
+)
+
+// Subscription receives engine events on C until it is cancelled.
+type Subscription struct {
+	C <-chan Event
+
+	ch      chan Event
+	policy  Policy
+	kinds   uint64 // bit set of the kinds delivered, 0 for all
+	dropped atomic.Uint64
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Dropped returns how many events were discarded because C was full.
+func (s *Subscription) Dropped() uint64 { return s.dropped.Load() }
+
+func (s *Subscription) wants(k EventKind) bool {
+	return s.kinds == 0 || s.kinds&(1<<k) != 0
+}
+
+// deliver queues ev according to the subscription's policy.
+func (s *Subscription) deliver(ev Event) {
+	switch s.policy {
+	case Block:
+		select {
+		case s.ch <- ev:
+		case <-s.done:
+		}
+		return
+	case DropOldest:
+		select {
+		case s.ch <- ev:
+			return
+		default:
+		}
+		select {
+		case <-s.ch:
+			s.dropped.Add(1)
+		default:
+		}
+	}
+	select {
+	case s.ch <- ev:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Subscribe returns a subscription queueing up to size events of the given
+// kinds, or of every kind when none are given. Each subscriber gets its own
+// copy of every event; policy decides what happens when it falls behind.
+func (e *Engine) Subscribe(size int, policy Policy, kinds ...EventKind) *Subscription {
+	ch := make(chan Event, max(size, 0))
+	s := &Subscription{C: ch, ch: ch, policy: policy, done: make(chan struct{})}
+	for _, k := range kinds {
+		s.kinds |= 1 << k
+	}
+	e.subMu.Lock()
+	e.subs = append(e.subs, s)
+	e.subMu.Unlock()
+	return s
+}
+
+// Unsubscribe stops deliveries to s and closes its channel. It is safe to
+// call more than once.
+func (e *Engine) Unsubscribe(s *Subscription) {
+	s.once.Do(func() {
+		close(s.done) // release a blocked delivery before taking the lock
+		e.subMu.Lock()
+		defer e.subMu.Unlock()
+		for i, sub := range e.subs {
+			if sub == s {
+				e.subs = append(e.subs[:i:i], e.subs[i+1:]...)
+				break
+			}
+		}
+		close(s.ch)
+	})
+}
+
+// publish delivers events to every subscriber that wants them.
+func (e *Engine) publish(events ...Event) {
+	e.subMu.RLock()
+	defer e.subMu.RUnlock()
+	for _, ev := range events {
+		for _, s := range e.subs {
+			if s.wants(ev.Kind) {
+				s.deliver(ev)
+			}
+		}
+	}
+}
+
+// transport reports the scheduler starting or stopping. Edits queued for a
+// launch boundary are applied when playback stops.
+func (e *Engine) transport(running bool) {
+	now := time.Now()
+	e.mu.Lock()
+	e.running = running
+	events := []Event{{Kind: EventStop, Row: -1, Time: now}}
+	if running {
+		events[0].Kind = EventStart
+	} else if e.pending != nil {
+		e.apply(*e.pending)
+		events = append(events, Event{Kind: EventGraph, Row: -1, Time: now})
+	}
+	e.mu.Unlock()
+	e.publish(events...)
+}
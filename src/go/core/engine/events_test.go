@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+// kinds returns the kinds of events in order.
+func kinds(events []Event) []EventKind {
+	out := make([]EventKind, len(events))
+	for i, ev := range events {
+		out[i] = ev.Kind
+	}
+	return out
+}
+
+func TestSubscribersGetTheirKinds(t *testing.T) {
+	e := newEngine(testLogger)
+	e.Do(func(s *State) {
+		ids := square(s.Graph, 0, 0)
+		s.Tracks = []Track{{Origin: ids[0], Velocity: 1}}
+	})
+	all := e.Subscribe(64, DropNewest)
+	structure := e.Subscribe(64, DropNewest, EventBar, EventLoop)
+
+	for step := 0; step < 5; step++ {
+		e.Beat(step, time.Now())
+	}
+
+	got := drain(structure)
+	if len(got) != 3 {
+		t.Fatalf("got %v, want bars on steps 0 and 4 and one loop wrap", kinds(got))
+	}
+	if got[0].Kind != EventBar || got[0].Bar != 0 {
+		t.Fatalf("first event %+v, want bar 0", got[0])
+	}
+	if got[1].Kind != EventBar || got[1].Step != 4 || got[1].Bar != 1 {
+		t.Fatalf("second event %+v, want bar 1 on step 4", got[1])
+	}
+	if got[2].Kind != EventLoop || got[2].Row != 0 || got[2].Beat != 4 {
+		t.Fatalf("third event %+v, want row 0 wrapping at beat 4", got[2])
+	}
+	// 5 steps, 5 hits, 2 bars and a wrap
+	if n := len(drain(all)); n != 13 {
+		t.Fatalf("unfiltered subscriber got %d events, want 13", n)
+	}
+}
+
+func TestTransportAndGraphEvents(t *testing.T) {
+	e := newEngine(testLogger)
+	sub := e.Subscribe(8, DropNewest, EventStart, EventStop, EventGraph)
+
+	e.Start()
+	e.Do(func(s *State) { line(s.Graph, 2, 0) })
+	e.SetTracks(nil) // nothing changes
+	e.Stop()
+
+	got := kinds(drain(sub))
+	want := []EventKind{EventStart, EventGraph, EventStop}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestDropPoliciesCountDrops(t *testing.T) {
+	e := newEngine(testLogger)
+	newest := e.Subscribe(2, DropNewest, EventStep)
+	oldest := e.Subscribe(2, DropOldest, EventStep)
+
+	for step := 1; step <= 5; step++ {
+		e.Beat(step, time.Now())
+	}
+
+	for _, tc := range []struct {
+		name  string
+		sub   *Subscription
+		steps []int
+	}{
+		{"drop newest", newest, []int{1, 2}},
+		{"drop oldest", oldest, []int{4, 5}},
+	} {
+		got := drain(tc.sub)
+		if len(got) != 2 || got[0].Step != tc.steps[0] || got[1].Step != tc.steps[1] {
+			t.Fatalf("%s: kept %+v, want steps %v", tc.name, got, tc.steps)
+		}
+		if d := tc.sub.Dropped(); d != 3 {
+			t.Fatalf("%s: dropped %d, want 3", tc.name, d)
+		}
+	}
+}
+
+func TestBlockingSubscriberMissesNothing(t *testing.T) {
+	e := newEngine(testLogger)
+	sub := e.Subscribe(0, Block, EventStep)
+	done := make(chan []int)
+	go func() {
+		var steps []int
+		for ev := range sub.C {
+			steps = append(steps, ev.Step)
+		}
+		done <- steps
+	}()
+
+	for step := 0; step < 50; step++ {
+		e.Beat(step, time.Now())
+	}
+	e.Unsubscribe(sub)
+	e.Unsubscribe(sub)
+
+	steps := <-done
+	if len(steps) != 50 || sub.Dropped() != 0 {
+		t.Fatalf("reader got %d steps with %d dropped, want all 50", len(steps), sub.Dropped())
+	}
+	e.Beat(0, time.Now()) // nothing is delivered after unsubscribing
+}
+
+func TestUnsubscribeReleasesBlockedDelivery(t *testing.T) {
+	e := newEngine(testLogger)
+	sub := e.Subscribe(0, Block)
+	beat := make(chan struct{})
+	go func() {
+		e.Beat(0, time.Now()) // nobody reads sub
+		close(beat)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	e.Unsubscribe(sub)
+	select {
+	case <-beat:
+	case <-time.After(time.Second):
+		t.Fatal("beat still blocked after unsubscribing")
+	}
+}
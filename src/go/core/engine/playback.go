@@ -0,0 +1,540 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ingyamilmolinar/tunkul/core/beat"
+	"github.com/ingyamilmolinar/tunkul/core/model"
+)
+
+// invalidBeat is returned for positions outside a path.
+var invalidBeat = model.BeatInfo{NodeID: model.InvalidNodeID, NodeType: model.NodeTypeInvisible, I: -1, J: -1}
+
+// Path is the sequence of beats a row walks. When Loop is set the beats from
+// LoopStart on repeat forever; otherwise the row stops after the last one.
+// A Length above zero makes the row start over every Length beats instead,
+// resting past the end of a straight path.
+type Path struct {
+	Beats     []model.BeatInfo
+	Loop      bool
+	LoopStart int
+	Length    int
+}
+
+// At returns the beat at absolute position idx, counting loop laps, or an
+// invalid beat past the end of a path that does not loop.
+func (p Path) At(idx int) model.BeatInfo {
+	if p.Length > 0 && idx > 0 {
+		idx %= p.Length
+	}
+	if idx < 0 || len(p.Beats) == 0 || (idx >= len(p.Beats) && !p.Loop) {
+		return invalidBeat
+	}
+	return p.Beats[p.Wrap(idx)]
+}
+
+// Wrap maps absolute position idx onto an index of Beats. Positions past the
+// end of a path that does not loop clamp to its last beat.
+func (p Path) Wrap(idx int) int {
+	if len(p.Beats) == 0 || idx < 0 {
+		return 0
+	}
+	if p.Length > 0 {
+		idx %= p.Length
+	}
+	if idx < len(p.Beats) {
+		return idx
+	}
+	loopLen := len(p.Beats) - p.LoopStart
+	if !p.Loop || loopLen <= 0 {
+		return len(p.Beats) - 1
+	}
+	return p.LoopStart + (idx-p.LoopStart)%loopLen
+}
+
+// Restarts reports whether absolute position idx begins a new lap: of the
+// path's length when set, or of its loop.
+func (p Path) Restarts(idx int) bool {
+	if p.Length > 0 {
+		return idx > 0 && idx%p.Length == 0
+	}
+	return p.Loop && idx >= len(p.Beats) && p.Wrap(idx) == p.LoopStart
+}
+
+// Period returns how many beats a lap takes, or 0 for a straight path that
+// plays once and waits for the next step 0.
+func (p Path) Period() int {
+	switch {
+	case p.Length > 0:
+		return p.Length
+	case p.Loop:
+		return len(p.Beats) - p.LoopStart
+	}
+	return 0
+}
+
+// pathFrom trims a beat row returned by the graph to a single traversal: up
+// to the first gap for a straight path, or one lap of the loop.
+func pathFrom(beats []model.BeatInfo, loop bool, loopStart int) Path {
+	n := len(beats)
+	if !loop {
+		for i, b := range beats {
+			if b.NodeID == model.InvalidNodeID {
+				n = i
+				break
+			}
+		}
+		return Path{Beats: beats[:n]}
+	}
+	if loopStart >= 0 && loopStart < len(beats) {
+		origin := beats[loopStart].NodeID
+		for i := loopStart + 1; i < len(beats); i++ {
+			if beats[i].NodeID == origin {
+				n = i
+				break
+			}
+		}
+	}
+	return Path{Beats: beats[:n], Loop: true, LoopStart: loopStart}
+}
+
+// Track is a drum row as the engine plays it.
+type Track struct {
+	Origin     model.NodeID // node the row's path starts from
+	Length     int          // beats before the row starts over, 0 to play the path as drawn
+	Rate       Rate         // row beats per master beat
+	Instrument string
+	Velocity   float64 // 0..1
+	Muted      bool    // muted, or silenced by another row's solo
+}
+
+// reshapes reports whether playing u instead of t needs a new path.
+func (t Track) reshapes(u Track) bool {
+	return t.Origin != u.Origin || t.Length != u.Length
+}
+
+// row is the playback state of one track.
+type row struct {
+	track      Track
+	path       Path
+	origins    []int // path indices that hold the origin node
+	nextOrigin int   // entry of origins the row reaches next
+	next       int   // absolute position played on the next beat
+	due        int   // engine clock pulse the next beat plays on
+	active     bool  // walking its path; idle rows join on step 0
+	heard      map[int]bool
+	lastBeat   int       // absolute position of the beat played last
+	lastAt     time.Time // when it played, zero before the first beat
+}
+
+// setTrack makes the row play t. A faster rate takes effect by the next
+// beat at that rate rather than waiting out the slower one.
+func (r *row) setTrack(t Track, clock int) {
+	r.track = t
+	r.due = min(r.due, clock+t.Rate.pulses())
+}
+
+// resetOrigin finds the origin visit that lies ahead of the row's position.
+func (r *row) resetOrigin() {
+	r.nextOrigin = 0
+	if len(r.origins) < 2 {
+		return
+	}
+	next := r.next
+	if r.path.Length > 0 {
+		next %= r.path.Length
+	}
+	for i, idx := range r.origins {
+		if next <= idx {
+			r.nextOrigin = i
+			return
+		}
+	}
+}
+
+// advance plays the row's next beat at step and moves it along its path.
+func (r *row) advance(index, step int, at time.Time) Event {
+	beat := r.next
+	info := r.path.At(beat)
+	if info.NodeID == r.track.Origin && len(r.origins) > 0 {
+		idx := r.path.Wrap(beat)
+		if expected := r.origins[r.nextOrigin]; idx != expected {
+			panic(fmt.Sprintf("pulse jumped to origin out of order: row=%d idx=%d expected=%d", index, idx, expected))
+		}
+		r.nextOrigin = (r.nextOrigin + 1) % len(r.origins)
+	}
+	ev := Event{
+		Kind:       EventHit,
+		Step:       step,
+		Row:        index,
+		Beat:       beat,
+		Node:       info.NodeID,
+		NodeType:   info.NodeType,
+		Instrument: r.track.Instrument,
+		Time:       at,
+	}
+	if info.NodeType == model.NodeTypeRegular && !r.track.Muted && !r.heard[beat] {
+		ev.Velocity = r.track.Velocity
+	}
+	delete(r.heard, beat)
+	r.next++
+	if n := r.path.Length; n > 0 && r.next%n == 0 {
+		r.resetOrigin() // a new lap of the track's length
+	}
+	ev.Next = r.path.At(r.next).NodeID
+	if ev.Next == model.InvalidNodeID && r.path.Length == 0 {
+		// The end of a straight path: start over on the next step 0.
+		r.active = false
+		r.next = 0
+		r.resetOrigin()
+	}
+	return ev
+}
+
+// SetPlayer makes the engine call play for every hit that sounds. It runs on
+// the engine goroutine as each beat comes due and must not block.
+func (e *Engine) SetPlayer(play func(Event)) {
+	e.mu.Lock()
+	e.player = play
+	e.mu.Unlock()
+}
+
+// State is what callers edit through Do: the graph the rows walk and the
+// tracks that play them.
+type State struct {
+	Graph  *model.Graph
+	Tracks []Track
+}
+
+// Do runs f with the engine locked, so the edit never lands in the middle of
+// a beat, then recomputes every row's path. Rows keep their positions by
+// index. f may replace the graph but must not keep it after returning.
+//
+// While playing with quantization on, the edit is queued and applied on the
+// next launch boundary; f then sees the queued state so edits accumulate.
+func (e *Engine) Do(f func(*State)) {
+	e.mu.Lock()
+	st := e.state()
+	f(&st)
+	applied := e.stage(st)
+	e.mu.Unlock()
+	if applied {
+		e.publish(Event{Kind: EventGraph, Row: -1, Time: time.Now()})
+	}
+}
+
+// SetTracks sets the rows to play, keeping each row's position. Paths are
+// recomputed when rows are added or an origin changes; it reports whether
+// they were. Such changes are quantized like Do, while a row's sound, level
+// and mute change right away.
+func (e *Engine) SetTracks(tracks []Track) bool {
+	e.mu.Lock()
+	var changed bool
+	if e.pending != nil || (e.running && e.quantize != QuantizeOff && e.reshapes(tracks)) {
+		st := e.state()
+		st.Tracks = append([]Track(nil), tracks...)
+		e.pending = &st
+		for i, t := range tracks {
+			if i < len(e.rows) && !e.rows[i].track.reshapes(t) {
+				e.rows[i].setTrack(t, e.clock)
+			}
+		}
+	} else if changed = e.setTracks(tracks); changed {
+		e.rebuild()
+	}
+	e.mu.Unlock()
+	if changed {
+		e.publish(Event{Kind: EventGraph, Row: -1, Time: time.Now()})
+	}
+	return changed
+}
+
+// RemoveTrack drops row i and its position; later rows move up.
+func (e *Engine) RemoveTrack(i int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if i >= 0 && i < len(e.rows) {
+		e.rows = append(e.rows[:i], e.rows[i+1:]...)
+	}
+}
+
+func (e *Engine) tracks() []Track {
+	tracks := make([]Track, len(e.rows))
+	for i, r := range e.rows {
+		tracks[i] = r.track
+	}
+	return tracks
+}
+
+// reshapes reports whether playing tracks needs new paths.
+func (e *Engine) reshapes(tracks []Track) bool {
+	if len(tracks) != len(e.rows) {
+		return true
+	}
+	for i, t := range tracks {
+		if e.rows[i].track.reshapes(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// setTracks resizes the rows to match tracks and reports whether any row
+// needs a new path.
+func (e *Engine) setTracks(tracks []Track) bool {
+	changed := len(tracks) != len(e.rows)
+	for i, t := range tracks {
+		if i == len(e.rows) {
+			e.rows = append(e.rows, &row{})
+		} else if e.rows[i].track.reshapes(t) {
+			changed = true
+		}
+		e.rows[i].setTrack(t, e.clock)
+	}
+	e.rows = e.rows[:len(tracks)]
+	return changed
+}
+
+// rebuild recomputes every row's path from the graph, keeping positions.
+func (e *Engine) rebuild() {
+	// A generous beat length makes the graph return complete paths even
+	// with disconnected nodes elsewhere; it is shrunk to the longest path
+	// afterwards so later calculations are not padded with extra laps.
+	g := e.graph
+	g.SetBeatLength(int(g.Next))
+	longest := 0
+	for _, r := range e.rows {
+		r.path = Path{}
+		r.origins = nil
+		if r.track.Origin != model.InvalidNodeID {
+			r.path = pathFrom(g.CalculateBeatRowFrom(r.track.Origin))
+			r.path.Length = r.track.Length
+		}
+		longest = max(longest, len(r.path.Beats))
+		for idx, b := range r.path.Beats {
+			if b.NodeID == r.track.Origin {
+				r.origins = append(r.origins, idx)
+			}
+		}
+		r.resetOrigin()
+	}
+	g.SetBeatLength(longest)
+}
+
+// Snapshot is a consistent copy of the engine state taken at one moment.
+// Its slices are not shared with the engine; the beats of each path are
+// shared between snapshots and must not be modified.
+type Snapshot struct {
+	Running    bool
+	Following  bool
+	BPM        int
+	BeatLength int // scheduler steps in a cycle; idle rows join on step 0
+	Quantize   Quantize
+	Pending    bool // edits are queued for the next launch boundary
+	Tracks     []Track
+	Paths      []Path
+	Positions  []int // absolute path position each row plays on its next beat
+}
+
+// Cycle returns how many master beats it takes for every row to line up
+// again: the least common multiple of the row periods at their rates. A
+// straight path counts as the whole scheduler cycles it spans, since it waits
+// for step 0 to replay.
+func (s Snapshot) Cycle() int { return cycle(s.Tracks, s.Paths, s.BeatLength) }
+
+// cycle works out Snapshot.Cycle for rows playing tracks along paths, with
+// beatLength scheduler steps between step 0s.
+func cycle(tracks []Track, paths []Path, beatLength int) int {
+	cycle := beat.PPQN // in clock pulses, so slow and fast rows line up on a beat
+	for i, p := range paths {
+		per := Rate{}.pulses()
+		if i < len(tracks) {
+			per = tracks[i].Rate.pulses()
+		}
+		pulses := p.Period() * per
+		if pulses == 0 && len(p.Beats) > 0 && beatLength > 0 {
+			beats := (len(p.Beats)*per + beat.PPQN - 1) / beat.PPQN
+			pulses = (beats + beatLength - 1) / beatLength * beatLength * beat.PPQN
+		}
+		if pulses > 0 {
+			cycle = lcm(cycle, pulses)
+		}
+	}
+	return cycle / beat.PPQN
+}
+
+func lcm(a, b int) int {
+	x, y := a, b
+	for y != 0 {
+		x, y = y, x%y
+	}
+	return a / x * b
+}
+
+// Snapshot returns the current state for readers on any goroutine.
+func (e *Engine) Snapshot() Snapshot {
+	s := Snapshot{
+		Running:    e.sched.Running(),
+		Following:  e.sched.Following(),
+		BPM:        e.sched.Tempo(),
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s.BeatLength = e.steps
+	s.Quantize, s.Pending = e.quantize, e.pending != nil
+	s.Tracks = e.tracks()
+	s.Paths = make([]Path, len(e.rows))
+	s.Positions = make([]int, len(e.rows))
+	for i, r := range e.rows {
+		s.Paths[i] = r.path
+		s.Positions[i] = r.next
+	}
+	return s
+}
+
+// Seek moves every row to absolute position beat. Rows that are walking
+// continue from there on the next beat.
+func (e *Engine) Seek(beat int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.beats = max(beat, 0)
+	for _, r := range e.rows {
+		r.next = max(beat, 0)
+		r.heard = nil
+		r.lastAt = time.Time{}
+		r.resetOrigin()
+	}
+}
+
+// Rewind moves every row back to the start of its path. The rows join again
+// on the next step 0.
+func (e *Engine) Rewind() {
+	e.Seek(0)
+	e.mu.Lock()
+	for _, r := range e.rows {
+		r.active = false
+	}
+	e.mu.Unlock()
+}
+
+// Audition marks beat of row as already heard, typically because it was
+// just played in live, so the engine does not sound it again.
+func (e *Engine) Audition(row, beat int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if row < 0 || row >= len(e.rows) {
+		return
+	}
+	r := e.rows[row]
+	if r.heard == nil {
+		r.heard = map[int]bool{}
+	}
+	r.heard[beat] = true
+}
+
+// Record returns the beat of row nearest to at, the time a live hit was
+// played, counting the row's beats at its rate from the last one it played.
+// A beat still to come is marked heard, like Audition, so the hit is not
+// played again when the row reaches it. ok is false until the row has
+// played a beat.
+func (e *Engine) Record(row int, at time.Time) (idx int, ok bool) {
+	bpm := e.sched.Tempo()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if row < 0 || row >= len(e.rows) || bpm <= 0 {
+		return 0, false
+	}
+	r := e.rows[row]
+	if r.lastAt.IsZero() {
+		return 0, false
+	}
+	every := time.Duration(r.track.Rate.pulses()) * time.Minute / time.Duration(bpm*beat.PPQN)
+	idx = max(r.lastBeat+int(math.Round(float64(at.Sub(r.lastAt))/float64(every))), 0)
+	if r.active && idx >= r.next {
+		if r.heard == nil {
+			r.heard = map[int]bool{}
+		}
+		r.heard[idx] = true
+	}
+	return idx, true
+}
+
+// cycle returns the master beats in the pattern cycle being played.
+func (e *Engine) cycle() int {
+	paths := make([]Path, len(e.rows))
+	for i, r := range e.rows {
+		paths[i] = r.path
+	}
+	return cycle(e.tracks(), paths, e.steps)
+}
+
+// Beat plays scheduler step due at the given time: idle rows join on step 0
+// and every walking row whose next beat has come due plays it. The scheduler
+// calls it on each beat; tests may call it directly.
+func (e *Engine) Beat(step int, at time.Time) {
+	e.mu.Lock()
+	e.clock += beat.PPQN - e.clock%beat.PPQN
+	e.step = step
+	pos := e.beats
+	e.beats++
+	events := []Event{{Kind: EventStep, Step: step, Row: -1, Time: at}}
+	if e.pending != nil && e.quantize.boundary(pos, e.cycle) {
+		e.apply(*e.pending)
+		events = append(events, Event{Kind: EventGraph, Step: step, Row: -1, Time: at})
+	}
+	if step%BeatsPerBar == 0 {
+		events = append(events, Event{Kind: EventBar, Step: step, Bar: step / BeatsPerBar, Row: -1, Time: at})
+	}
+	for _, r := range e.rows {
+		if !r.active && step == 0 && len(r.path.Beats) > 0 {
+			r.active = true
+			r.due = e.clock
+		}
+	}
+	events = e.due(at, events)
+	play := e.player
+	e.mu.Unlock()
+	e.emit(play, events)
+}
+
+// Pulse plays the beats of rows running faster or off the master beat that
+// come due on clock pulse 1 to PPQN-1 of the current beat. The scheduler
+// calls it between beats; tests may call it directly.
+func (e *Engine) Pulse(pulse int, at time.Time) {
+	e.mu.Lock()
+	if d := pulse - e.clock%beat.PPQN; d > 0 {
+		e.clock += d
+	}
+	events := e.due(at, nil)
+	play := e.player
+	e.mu.Unlock()
+	e.emit(play, events)
+}
+
+// due appends the beats of every walking row that have come due by the
+// engine clock, moving each row along its path at its rate.
+func (e *Engine) due(at time.Time, events []Event) []Event {
+	for i, r := range e.rows {
+		for r.active && r.due <= e.clock {
+			if r.path.Restarts(r.next) {
+				events = append(events, Event{Kind: EventLoop, Step: e.step, Row: i, Beat: r.next, Time: at})
+			}
+			r.lastBeat, r.lastAt = r.next, at
+			events = append(events, r.advance(i, e.step, at))
+			r.due += r.track.Rate.pulses()
+		}
+	}
+	return events
+}
+
+// emit plays the hits that sound and hands every event to the subscribers.
+func (e *Engine) emit(play func(Event), events []Event) {
+	for _, ev := range events {
+		if play != nil && ev.Velocity > 0 {
+			play(ev)
+		}
+	}
+	e.publish(events...)
+}
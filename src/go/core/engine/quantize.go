@@ -0,0 +1,94 @@
+package engine
+
+import "time"
+
+// Quantize is when edits made during playback take effect, like clip launch
+// quantization in a DAW.
+type Quantize int
+
+const (
+	// QuantizeOff applies edits as soon as they are made.
+	QuantizeOff Quantize = iota
+	// QuantizeBeat applies edits on the next beat.
+	QuantizeBeat
+	// QuantizeBar applies edits on the next bar.
+	QuantizeBar
+	// QuantizeLoop applies edits when the pattern cycle starts over, where
+	// every row lines up again.
+	QuantizeLoop
+)
+
+var quantizeNames = [...]string{"Off", "Beat", "Bar", "Loop"}
+
+func (q Quantize) String() string {
+	if q < 0 || int(q) >= len(quantizeNames) {
+		return "Quantize(?)"
+	}
+	return quantizeNames[q]
+}
+
+// boundary reports whether master beat pos, counted from the start of
+// playback, is one where queued edits are applied. cycle is called for the
+// pattern cycle only when needed.
+func (q Quantize) boundary(pos int, cycle func() int) bool {
+	switch q {
+	case QuantizeBar:
+		return pos%BeatsPerBar == 0
+	case QuantizeLoop:
+		return pos%cycle() == 0
+	}
+	return true
+}
+
+// SetQuantize sets when edits made during playback take effect. Edits
+// already queued are applied right away when quantization is turned off.
+func (e *Engine) SetQuantize(q Quantize) {
+	e.mu.Lock()
+	e.quantize = q
+	applied := q == QuantizeOff && e.pending != nil
+	if applied {
+		e.apply(*e.pending)
+	}
+	e.mu.Unlock()
+	if applied {
+		e.publish(Event{Kind: EventGraph, Row: -1, Time: time.Now()})
+	}
+}
+
+// Pending reports whether edits are waiting for the next launch boundary.
+func (e *Engine) Pending() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.pending != nil
+}
+
+// state returns what the next edit starts from: the queued edit if there
+// is one, or the state being played.
+func (e *Engine) state() State {
+	if e.pending != nil {
+		return State{Graph: e.pending.Graph, Tracks: append([]Track(nil), e.pending.Tracks...)}
+	}
+	return State{Graph: e.graph, Tracks: e.tracks()}
+}
+
+// stage applies st, or queues it for the next launch boundary while playing
+// with quantization on. It reports whether st was applied.
+func (e *Engine) stage(st State) bool {
+	if st.Graph == nil {
+		st.Graph = e.graph
+	}
+	if e.running && e.quantize != QuantizeOff {
+		e.pending = &st
+		return false
+	}
+	e.apply(st)
+	return true
+}
+
+// apply makes st the state being played, recomputing every row's path.
+func (e *Engine) apply(st State) {
+	e.graph = st.Graph
+	e.setTracks(st.Tracks)
+	e.rebuild()
+	e.pending = nil
+}
@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ingyamilmolinar/tunkul/core/model"
+)
+
+// ring adds a loop of 2n nodes: n along row j linked left to right and n
+// back along row j+1.
+func ring(g *model.Graph, n, j int) []model.NodeID {
+	ids := line(g, n, j)
+	for i := n - 1; i >= 0; i-- {
+		id := g.AddNode(i, j+1, model.NodeTypeRegular)
+		g.Edges[[2]model.NodeID{ids[len(ids)-1], id}] = struct{}{}
+		ids = append(ids, id)
+	}
+	g.Edges[[2]model.NodeID{ids[len(ids)-1], ids[0]}] = struct{}{}
+	return ids
+}
+
+func TestQuantizedEditsWaitForBoundary(t *testing.T) {
+	for _, tc := range []struct {
+		q    Quantize
+		step int // first step from 1 on where the edit lands
+	}{
+		{QuantizeOff, 1},
+		{QuantizeBeat, 1},
+		{QuantizeBar, 4},
+		{QuantizeLoop, 6}, // the row's loop, not the 16 scheduler steps
+	} {
+		t.Run(tc.q.String(), func(t *testing.T) {
+			e := newEngine(testLogger)
+			var loop, straight []model.NodeID
+			e.Do(func(s *State) {
+				loop = ring(s.Graph, 3, 0)
+				straight = line(s.Graph, 3, 5)
+				s.Tracks = []Track{{Origin: loop[0], Velocity: 1}}
+			})
+			e.SetQuantize(tc.q)
+			e.Start()
+			e.Beat(0, time.Now())
+
+			e.Do(func(s *State) { s.Tracks[0].Origin = straight[0] })
+			if pending := e.Snapshot().Pending; pending != (tc.q != QuantizeOff) {
+				t.Fatalf("pending %t after the edit", pending)
+			}
+			for step := 1; step <= 16; step++ {
+				e.Beat(step%16, time.Now())
+				got := e.Snapshot().Paths[0].Beats[0].NodeID
+				if applied := got == straight[0]; applied != (step >= tc.step) {
+					t.Fatalf("step %d: path starts at %d, want the edit applied from step %d", step, got, tc.step)
+				}
+			}
+		})
+	}
+}
+
+func TestCycleSpansEveryRow(t *testing.T) {
+	e := newEngine(testLogger)
+	e.Do(func(s *State) {
+		a := square(s.Graph, 0, 0)
+		b := ring(s.Graph, 3, 3)
+		s.Tracks = []Track{{Origin: a[0]}, {Origin: b[0]}}
+	})
+	if got := e.cycle(); got != 12 {
+		t.Fatalf("loops of 4 and 6 line up after %d beats, want 12", got)
+	}
+	e.Do(func(s *State) {
+		c := line(s.Graph, 3, 6)
+		s.Tracks = append(s.Tracks, Track{Origin: c[0]})
+	})
+	e.SetBeatLength(8)
+	if got, want := e.cycle(), 24; got != want || e.BeatLength() != 8 {
+		t.Fatalf("cycle %d with a straight row over %d steps, want %d over 8", got, e.BeatLength(), want)
+	}
+}
+
+func TestQueuedEditsApplyOnStopAndWhenQuantizeIsOff(t *testing.T) {
+	e := newEngine(testLogger)
+	e.SetQuantize(QuantizeLoop)
+	e.Start()
+	var ids []model.NodeID
+	e.Do(func(s *State) {
+		ids = line(s.Graph, 2, 0)
+		s.Tracks = []Track{{Origin: ids[0], Velocity: 1}}
+	})
+	if snap := e.Snapshot(); !snap.Pending || len(snap.Tracks) != 0 {
+		t.Fatalf("edit applied while playing: %+v", snap)
+	}
+	e.Stop()
+	if snap := e.Snapshot(); snap.Pending || len(snap.Paths) != 1 || len(snap.Paths[0].Beats) != 2 {
+		t.Fatalf("edit not applied on stop: %+v", snap)
+	}
+
+	e.Start()
+	e.Do(func(s *State) { s.Tracks = append(s.Tracks, Track{Origin: ids[1]}) })
+	e.SetQuantize(QuantizeOff)
+	if snap := e.Snapshot(); snap.Pending || len(snap.Tracks) != 2 {
+		t.Fatalf("edit not applied when quantization was turned off: %+v", snap)
+	}
+}
+
+func TestMuteIsNotQuantized(t *testing.T) {
+	e := newEngine(testLogger)
+	var a, b []model.NodeID
+	e.Do(func(s *State) {
+		a = line(s.Graph, 2, 0)
+		b = line(s.Graph, 2, 2)
+		s.Tracks = []Track{{Origin: a[0], Velocity: 1}}
+	})
+	e.SetQuantize(QuantizeBar)
+	e.Start()
+
+	if e.SetTracks([]Track{{Origin: a[0], Velocity: 1, Muted: true}}) {
+		t.Fatal("muting recomputed the paths")
+	}
+	if !e.Snapshot().Tracks[0].Muted || e.Pending() {
+		t.Fatal("mute was not applied right away")
+	}
+	// A new row waits for the bar, but the mute of an existing one does not.
+	e.SetTracks([]Track{{Origin: a[0], Velocity: 1}, {Origin: b[0], Velocity: 1}})
+	e.SetTracks([]Track{{Origin: a[0], Velocity: 1, Muted: true}, {Origin: b[0], Velocity: 1}})
+	if snap := e.Snapshot(); len(snap.Tracks) != 1 || !snap.Tracks[0].Muted || !snap.Pending {
+		t.Fatalf("got %+v, want row 0 muted and row 1 queued", snap)
+	}
+}
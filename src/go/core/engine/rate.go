@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/ingyamilmolinar/tunkul/core/beat"
+)
+
+// Rate is the speed a row runs at as a ratio of the master clock: Num row
+// beats for every Den master beats. The zero Rate runs with the clock.
+type Rate struct {
+	Num, Den int
+}
+
+// Rates are the ratios offered for rows, slowest first. Each one is a whole
+// number of clock pulses per row beat.
+var Rates = []Rate{{1, 4}, {1, 3}, {1, 2}, {2, 3}, {3, 4}, {1, 1}, {3, 2}, {2, 1}, {3, 1}, {4, 1}}
+
+func (r Rate) normal() Rate {
+	if r.Num <= 0 || r.Den <= 0 {
+		return Rate{1, 1}
+	}
+	return r
+}
+
+func (r Rate) String() string {
+	r = r.normal()
+	if r.Den == 1 {
+		return fmt.Sprintf("%dx", r.Num)
+	}
+	return fmt.Sprintf("%d/%d", r.Num, r.Den)
+}
+
+// Next returns the rate after r in Rates, wrapping to the slowest.
+func (r Rate) Next() Rate {
+	r = r.normal()
+	for i, x := range Rates {
+		if x == r {
+			return Rates[(i+1)%len(Rates)]
+		}
+	}
+	return Rate{1, 1}
+}
+
+// pulses returns how many clock pulses a row beat lasts, at least one.
+func (r Rate) pulses() int {
+	r = r.normal()
+	return max(beat.PPQN*r.Den/r.Num, 1)
+}
@@ -0,0 +1,22 @@
+package model
+
+// Euclid describes a Euclidean rhythm: Pulses hits spread as evenly as
+// possible over Steps beats, rotated left by Rotation beats.
+type Euclid struct {
+	Steps, Pulses, Rotation int
+}
+
+// Pattern returns the rhythm one beat per entry, true where a hit falls.
+// Pulses is clamped to 0..Steps; a pattern with no steps is empty.
+func (e Euclid) Pattern() []bool {
+	if e.Steps <= 0 {
+		return nil
+	}
+	pulses := min(max(e.Pulses, 0), e.Steps)
+	rot := ((e.Rotation % e.Steps) + e.Steps) % e.Steps
+	p := make([]bool, e.Steps)
+	for k := range p {
+		p[k] = (k+rot)*pulses%e.Steps < pulses
+	}
+	return p
+}
@@ -0,0 +1,39 @@
+package model
+
+import "testing"
+
+func pattern(s string) []bool {
+	p := make([]bool, len(s))
+	for i, c := range s {
+		p[i] = c == 'x'
+	}
+	return p
+}
+
+func TestEuclidPattern(t *testing.T) {
+	cases := []struct {
+		e    Euclid
+		want string
+	}{
+		{Euclid{Steps: 8, Pulses: 3}, "x..x..x."},
+		{Euclid{Steps: 8, Pulses: 3, Rotation: 3}, "x..x.x.."},
+		{Euclid{Steps: 8, Pulses: 3, Rotation: -5}, "x..x.x.."},
+		{Euclid{Steps: 4, Pulses: 4}, "xxxx"},
+		{Euclid{Steps: 5, Pulses: 9}, "xxxxx"},
+		{Euclid{Steps: 3}, "..."},
+		{Euclid{Steps: 16, Pulses: 5}, "x...x..x..x..x.."},
+		{Euclid{}, ""},
+	}
+	for _, c := range cases {
+		got := c.e.Pattern()
+		want := pattern(c.want)
+		if len(got) != len(want) {
+			t.Fatalf("%+v: got %d steps, want %d", c.e, len(got), len(want))
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("%+v: got %v, want %s", c.e, got, c.want)
+			}
+		}
+	}
+}
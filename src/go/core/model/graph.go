@@ -1,6 +1,8 @@
 package model
 
 import (
+	"maps"
+	"slices"
 	"sort"
 
 	game_log "github.com/ingyamilmolinar/tunkul/internal/log"
@@ -71,8 +73,76 @@ func (g *Graph) RemoveNode(id NodeID) {
 	g.logger.Debugf("[GRAPH] Removed node: %d at (%d, %d)", id, n.I, n.J)
 }
 
-func (g *Graph) ToggleStep(i int) {
-	// This function will be re-evaluated later based on graph traversal
+// ToggleStep flips beat i of the path from the start node; see
+// ToggleStepFrom.
+func (g *Graph) ToggleStep(i int) bool {
+	return g.ToggleStepFrom(g.StartNodeID, i)
+}
+
+// ToggleStepFrom flips beat i of the path from start between a regular node
+// and an invisible one. Beats past the end of a loop wrap around it. A beat
+// past the end of a path that stops extends it with an edge from its last
+// node, carrying on in the path's direction, so beat i becomes a hit and the
+// beats it skips rests. It reports false, changing nothing, when start is not
+// a node or the extension would run into another node.
+func (g *Graph) ToggleStepFrom(start NodeID, i int) bool {
+	if _, ok := g.Nodes[start]; !ok || i < 0 {
+		return false
+	}
+	path, loopStart := g.walk(start)
+	if i >= len(path) {
+		if loopStart < 0 {
+			return g.extend(path, i)
+		}
+		i = loopStart + (i-loopStart)%(len(path)-loopStart)
+	}
+	n, ok := g.Nodes[path[i]]
+	if !ok {
+		return false
+	}
+	if n.Type == NodeTypeRegular {
+		n.Type = NodeTypeInvisible
+	} else {
+		n.Type = NodeTypeRegular
+	}
+	g.Nodes[path[i]] = n
+	g.logger.Debugf("[GRAPH] ToggleStepFrom: beat %d from node %d is now node %d type %v", i, start, path[i], n.Type)
+	return true
+}
+
+// extend adds an edge from the last node of path to a new regular node at
+// beat i, with invisible nodes on the cells between them.
+func (g *Graph) extend(path []NodeID, i int) bool {
+	lastID := path[len(path)-1]
+	last := g.Nodes[lastID]
+	di, dj := 1, 0
+	if len(path) > 1 {
+		prev := g.Nodes[path[len(path)-2]]
+		di, dj = sign(last.I-prev.I), sign(last.J-prev.J)
+	}
+	steps := i - (len(path) - 1)
+	for s := 1; s <= steps; s++ {
+		if g.nodeAt(last.I+di*s, last.J+dj*s) != InvalidNodeID {
+			g.logger.Debugf("[GRAPH] extend: cell (%d,%d) is taken", last.I+di*s, last.J+dj*s)
+			return false
+		}
+	}
+	for s := 1; s < steps; s++ {
+		g.AddNode(last.I+di*s, last.J+dj*s, NodeTypeInvisible)
+	}
+	end := g.AddNode(last.I+di*steps, last.J+dj*steps, NodeTypeRegular)
+	g.Edges[[2]NodeID{lastID, end}] = struct{}{}
+	return true
+}
+
+// nodeAt returns the node on grid cell (i, j), or InvalidNodeID.
+func (g *Graph) nodeAt(i, j int) NodeID {
+	for id, n := range g.Nodes {
+		if n.I == i && n.J == j {
+			return id
+		}
+	}
+	return InvalidNodeID
 }
 
 func (g *Graph) GetNodeByID(id NodeID) (Node, bool) {
@@ -92,60 +162,8 @@ func (g *Graph) CalculateBeatRow() ([]BeatInfo, bool, int) {
 		return beatRow, false, -1
 	}
 
-	path := []NodeID{}
-	visited := make(map[NodeID]int)
-	isLoop := false
-	loopStartIndex := -1
-
-	currentNodeID := g.StartNodeID
-	g.logger.Debugf("[GRAPH] CalculateBeatRow: Starting traversal from node %d", currentNodeID)
-
-	for currentNodeID != InvalidNodeID {
-		g.logger.Debugf("[GRAPH] CalculateBeatRow: Current node: %d, Path so far: %v, Visited: %v", currentNodeID, path, visited)
-
-		if index, ok := visited[currentNodeID]; ok {
-			isLoop = true
-			loopStartIndex = index
-			// Do not append currentNodeID again, it's already in path at 'index'
-			g.logger.Debugf("[GRAPH] CalculateBeatRow: Loop detected! Node %d revisited at index %d. Final path before break: %v", currentNodeID, index, path)
-			break
-		}
-
-		visited[currentNodeID] = len(path)
-		path = append(path, currentNodeID)
-
-		var neighbors []NodeID
-		for edge := range g.Edges {
-			if edge[0] == currentNodeID {
-				neighbors = append(neighbors, edge[1])
-			}
-		}
-
-		if len(neighbors) == 0 {
-			g.logger.Debugf("[GRAPH] CalculateBeatRow: No neighbors for node %d. Path ends.", currentNodeID)
-			break
-		}
-
-		sort.Slice(neighbors, func(i, j int) bool {
-			nodeA := g.Nodes[neighbors[i]]
-			nodeB := g.Nodes[neighbors[j]]
-			if nodeA.J != nodeB.J {
-				return nodeA.J < nodeB.J
-			}
-			return nodeA.I < nodeB.I
-		})
-		nextNodeID := neighbors[0]
-		g.logger.Debugf("[GRAPH] CalculateBeatRow: Next node selected: %d (from neighbors %v)", nextNodeID, neighbors)
-
-		currentNode := g.Nodes[currentNodeID]
-		nextNode := g.Nodes[nextNodeID]
-		intermediateIDs := g.getIntermediateGridPoints(currentNode.I, currentNode.J, nextNode.I, nextNode.J)
-		if len(intermediateIDs) > 0 {
-			g.logger.Debugf("[GRAPH] CalculateBeatRow: Adding intermediate nodes: %v", intermediateIDs)
-		}
-		path = append(path, intermediateIDs...)
-		currentNodeID = nextNodeID
-	}
+	path, loopStartIndex := g.walk(g.StartNodeID)
+	isLoop := loopStartIndex >= 0
 
 	beatRow := []BeatInfo{}
 	for _, id := range path {
@@ -203,6 +221,63 @@ func (g *Graph) CalculateBeatRowFrom(start NodeID) ([]BeatInfo, bool, int) {
 	return row, loop, idx
 }
 
+// walk follows the edges from start and lists every node the path passes,
+// including those along each edge. It returns the index the path loops back
+// to, or -1 for a path that ends.
+func (g *Graph) walk(start NodeID) ([]NodeID, int) {
+	path := []NodeID{}
+	visited := make(map[NodeID]int)
+
+	currentNodeID := start
+	g.logger.Debugf("[GRAPH] walk: Starting traversal from node %d", currentNodeID)
+
+	for currentNodeID != InvalidNodeID {
+		g.logger.Debugf("[GRAPH] walk: Current node: %d, Path so far: %v, Visited: %v", currentNodeID, path, visited)
+
+		if index, ok := visited[currentNodeID]; ok {
+			// Do not append currentNodeID again, it's already in path at 'index'
+			g.logger.Debugf("[GRAPH] walk: Loop detected! Node %d revisited at index %d. Final path: %v", currentNodeID, index, path)
+			return path, index
+		}
+
+		visited[currentNodeID] = len(path)
+		path = append(path, currentNodeID)
+
+		var neighbors []NodeID
+		for edge := range g.Edges {
+			if edge[0] == currentNodeID {
+				neighbors = append(neighbors, edge[1])
+			}
+		}
+
+		if len(neighbors) == 0 {
+			g.logger.Debugf("[GRAPH] walk: No neighbors for node %d. Path ends.", currentNodeID)
+			break
+		}
+
+		sort.Slice(neighbors, func(i, j int) bool {
+			nodeA := g.Nodes[neighbors[i]]
+			nodeB := g.Nodes[neighbors[j]]
+			if nodeA.J != nodeB.J {
+				return nodeA.J < nodeB.J
+			}
+			return nodeA.I < nodeB.I
+		})
+		nextNodeID := neighbors[0]
+		g.logger.Debugf("[GRAPH] walk: Next node selected: %d (from neighbors %v)", nextNodeID, neighbors)
+
+		currentNode := g.Nodes[currentNodeID]
+		nextNode := g.Nodes[nextNodeID]
+		intermediateIDs := g.getIntermediateGridPoints(currentNode.I, currentNode.J, nextNode.I, nextNode.J)
+		if len(intermediateIDs) > 0 {
+			g.logger.Debugf("[GRAPH] walk: Adding intermediate nodes: %v", intermediateIDs)
+		}
+		path = append(path, intermediateIDs...)
+		currentNodeID = nextNodeID
+	}
+	return path, -1
+}
+
 func (g *Graph) getIntermediateGridPoints(node1I int, node1J int, node2I int, node2J int) []NodeID {
 	var intermediateNodeIDs []NodeID
 	g.logger.Debugf("[GRAPH] getIntermediateGridPoints: Calculating intermediate points between (%d,%d) and (%d,%d)", node1I, node1J, node2I, node2J)
@@ -215,16 +290,16 @@ func (g *Graph) getIntermediateGridPoints(node1I int, node1J int, node2I int, no
 		for j := node1J + step; j != node2J; j += step {
 			foundIntermediateNodeID := InvalidNodeID
 			for id, node := range g.Nodes {
-				if node.I == node1I && node.J == j && node.Type == NodeTypeInvisible {
+				if node.I == node1I && node.J == j {
 					foundIntermediateNodeID = id
 					break
 				}
 			}
 			if foundIntermediateNodeID != InvalidNodeID {
 				intermediateNodeIDs = append(intermediateNodeIDs, foundIntermediateNodeID)
-				g.logger.Debugf("[GRAPH] getIntermediateGridPoints: Found intermediate invisible node %d at (%d,%d)", foundIntermediateNodeID, node1I, j)
+				g.logger.Debugf("[GRAPH] getIntermediateGridPoints: Found intermediate node %d at (%d,%d)", foundIntermediateNodeID, node1I, j)
 			} else {
-				g.logger.Warnf("[GRAPH] Missing invisible node at (%d, %d) along vertical path", node1I, j)
+				g.logger.Warnf("[GRAPH] Missing node at (%d, %d) along vertical path", node1I, j)
 			}
 		}
 	} else if node1J == node2J { // Horizontal line
@@ -235,16 +310,16 @@ func (g *Graph) getIntermediateGridPoints(node1I int, node1J int, node2I int, no
 		for i := node1I + step; i != node2I; i += step {
 			foundIntermediateNodeID := InvalidNodeID
 			for id, node := range g.Nodes {
-				if node.I == i && node.J == node1J && node.Type == NodeTypeInvisible {
+				if node.I == i && node.J == node1J {
 					foundIntermediateNodeID = id
 					break
 				}
 			}
 			if foundIntermediateNodeID != InvalidNodeID {
 				intermediateNodeIDs = append(intermediateNodeIDs, foundIntermediateNodeID)
-				g.logger.Debugf("[GRAPH] getIntermediateGridPoints: Found intermediate invisible node %d at (%d,%d)", foundIntermediateNodeID, i, node1J)
+				g.logger.Debugf("[GRAPH] getIntermediateGridPoints: Found intermediate node %d at (%d,%d)", foundIntermediateNodeID, i, node1J)
 			} else {
-				g.logger.Warnf("[GRAPH] Missing invisible node at (%d, %d) along horizontal path", i, node1J)
+				g.logger.Warnf("[GRAPH] Missing node at (%d, %d) along horizontal path", i, node1J)
 			}
 		}
 	}
@@ -305,6 +380,15 @@ func (g *Graph) dfsDetectCycle(nodeID NodeID, visited, recStack map[NodeID]bool)
 	return false
 }
 
+// Clone returns a deep copy of g that can be handed to another goroutine.
+func (g *Graph) Clone() *Graph {
+	c := *g
+	c.Nodes = maps.Clone(g.Nodes)
+	c.Edges = maps.Clone(g.Edges)
+	c.Row = slices.Clone(g.Row)
+	return &c
+}
+
 func (g *Graph) SetBeatLength(length int) {
 	g.beatLengthValue = length
 }
@@ -313,6 +397,16 @@ func (g *Graph) BeatLength() int {
 	return g.beatLengthValue
 }
 
+func sign(i int) int {
+	switch {
+	case i > 0:
+		return 1
+	case i < 0:
+		return -1
+	}
+	return 0
+}
+
 func abs(i int) int {
 	if i < 0 {
 		return -i
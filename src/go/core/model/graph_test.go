@@ -154,3 +154,107 @@ func TestCalculateBeatRow_ComplexLoopWithInvisibleNodes(t *testing.T) {
 		t.Fatalf("Expected beatInfos %v, got %v", expected, beatInfos)
 	}
 }
+
+func TestCalculateBeatRow_RegularNodeAlongEdge(t *testing.T) {
+	g := NewGraph(testLogger)
+	n0 := g.AddNode(0, 0, NodeTypeRegular)
+	mid := g.AddNode(1, 0, NodeTypeRegular) // an intermediate step turned on
+	n1 := g.AddNode(2, 0, NodeTypeRegular)
+	g.StartNodeID = n0
+	g.Edges[[2]NodeID{n0, n1}] = struct{}{}
+	g.SetBeatLength(3)
+
+	beatInfos, _, _ := g.CalculateBeatRow()
+
+	expected := []BeatInfo{
+		{NodeID: n0, NodeType: NodeTypeRegular, I: 0, J: 0},
+		{NodeID: mid, NodeType: NodeTypeRegular, I: 1, J: 0},
+		{NodeID: n1, NodeType: NodeTypeRegular, I: 2, J: 0},
+	}
+	if !reflect.DeepEqual(beatInfos, expected) {
+		t.Fatalf("Expected beatInfos %v, got %v", expected, beatInfos)
+	}
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	g := NewGraph(testLogger)
+	n0 := g.AddNode(0, 0, NodeTypeRegular)
+	n1 := g.AddNode(1, 0, NodeTypeRegular)
+	g.StartNodeID = n0
+	g.Edges[[2]NodeID{n0, n1}] = struct{}{}
+
+	c := g.Clone()
+	c.AddNode(2, 0, NodeTypeRegular)
+	delete(c.Edges, [2]NodeID{n0, n1})
+	c.StartNodeID = n1
+
+	if len(g.Nodes) != 2 || len(g.Edges) != 1 || g.StartNodeID != n0 || g.Next != 2 {
+		t.Fatalf("editing the clone changed the original: %+v", g)
+	}
+	if row, _, _ := c.CalculateBeatRowFrom(n0); row[1].NodeID != InvalidNodeID {
+		t.Fatalf("clone still has the deleted edge: %v", row[:2])
+	}
+}
+
+func TestToggleStep(t *testing.T) {
+	g := NewGraph(testLogger)
+	n0 := g.AddNode(0, 0, NodeTypeRegular)
+	mid := g.AddNode(1, 0, NodeTypeInvisible)
+	n1 := g.AddNode(2, 0, NodeTypeRegular)
+	g.Edges[[2]NodeID{n0, n1}] = struct{}{}
+	g.StartNodeID = n0
+
+	if !g.ToggleStep(1) || g.Nodes[mid].Type != NodeTypeRegular {
+		t.Fatalf("beat 1 not turned into a hit: %+v", g.Nodes[mid])
+	}
+	if !g.ToggleStep(0) || g.Nodes[n0].Type != NodeTypeInvisible {
+		t.Fatalf("beat 0 not turned into a rest: %+v", g.Nodes[n0])
+	}
+
+	// Past the end the path grows in its own direction.
+	if !g.ToggleStep(5) {
+		t.Fatal("ToggleStep(5) did not extend the path")
+	}
+	beats, _, _ := g.CalculateBeatRow()
+	want := []BeatInfo{
+		{NodeType: NodeTypeInvisible, I: 0, J: 0},
+		{NodeType: NodeTypeRegular, I: 1, J: 0},
+		{NodeType: NodeTypeRegular, I: 2, J: 0},
+		{NodeType: NodeTypeInvisible, I: 3, J: 0},
+		{NodeType: NodeTypeInvisible, I: 4, J: 0},
+		{NodeType: NodeTypeRegular, I: 5, J: 0},
+	}
+	for k, w := range want {
+		b := beats[k]
+		if b.NodeType != w.NodeType || b.I != w.I || b.J != w.J {
+			t.Fatalf("beat %d = %+v, want %+v", k, b, w)
+		}
+	}
+
+	// An extension that would run into another node is refused.
+	g.AddNode(7, 0, NodeTypeRegular)
+	nodes := len(g.Nodes)
+	if g.ToggleStep(8) || len(g.Nodes) != nodes {
+		t.Fatalf("extension through (7,0) allowed, %d nodes added", len(g.Nodes)-nodes)
+	}
+	if g.ToggleStepFrom(InvalidNodeID, 0) || g.ToggleStep(-1) {
+		t.Fatal("ToggleStep accepted a missing start or negative beat")
+	}
+}
+
+func TestToggleStepWrapsLoops(t *testing.T) {
+	g := NewGraph(testLogger)
+	n0 := g.AddNode(0, 0, NodeTypeRegular)
+	n1 := g.AddNode(0, 1, NodeTypeRegular)
+	n2 := g.AddNode(1, 1, NodeTypeRegular)
+	g.Edges[[2]NodeID{n0, n1}] = struct{}{}
+	g.Edges[[2]NodeID{n1, n2}] = struct{}{}
+	g.Edges[[2]NodeID{n2, n0}] = struct{}{}
+
+	if !g.ToggleStepFrom(n0, 4) || g.Nodes[n1].Type != NodeTypeInvisible {
+		t.Fatalf("beat 4 of a 3-beat loop did not toggle beat 1: %+v", g.Nodes[n1])
+	}
+	if len(g.Nodes) != 3 {
+		t.Fatalf("toggling a loop added nodes: %d", len(g.Nodes))
+	}
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"math/rand/v2"
+	"slices"
+)
+
+// The pattern tools below return a new hit pattern, one entry per beat and
+// true where a hit falls, leaving p untouched.
+
+// Randomize scatters the hits of p over random steps, keeping their number.
+// A pattern without hits gets them on half its steps.
+func Randomize(p []bool, rng *rand.Rand) []bool {
+	hits := 0
+	for _, on := range p {
+		if on {
+			hits++
+		}
+	}
+	if hits == 0 {
+		hits = len(p) / 2
+	}
+	out := make([]bool, len(p))
+	for _, k := range rng.Perm(len(p))[:hits] {
+		out[k] = true
+	}
+	return out
+}
+
+// Mutate flips n distinct steps of p picked at random, or all of them when n
+// is at least len(p).
+func Mutate(p []bool, n int, rng *rand.Rand) []bool {
+	out := slices.Clone(p)
+	for _, k := range rng.Perm(len(p))[:min(max(n, 0), len(p))] {
+		out[k] = !out[k]
+	}
+	return out
+}
+
+// Shift rotates p n steps later, wrapping around its end; a negative n
+// moves it earlier.
+func Shift(p []bool, n int) []bool {
+	out := make([]bool, len(p))
+	for k, on := range p {
+		out[((k+n)%len(p)+len(p))%len(p)] = on
+	}
+	return out
+}
+
+// Reverse returns p played backwards.
+func Reverse(p []bool) []bool {
+	out := slices.Clone(p)
+	slices.Reverse(out)
+	return out
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func hits(p []bool) int {
+	n := 0
+	for _, on := range p {
+		if on {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRandomizeKeepsHitsAndSeed(t *testing.T) {
+	p := pattern("x..x..x.")
+	a := Randomize(p, rand.New(rand.NewPCG(7, 7)))
+	b := Randomize(p, rand.New(rand.NewPCG(7, 7)))
+	if !slices.Equal(a, b) {
+		t.Fatalf("same seed gave %v and %v", a, b)
+	}
+	if hits(a) != 3 || len(a) != len(p) {
+		t.Fatalf("randomized %v, want 3 hits over 8 steps", a)
+	}
+	if got := hits(Randomize(make([]bool, 6), rand.New(rand.NewPCG(1, 1)))); got != 3 {
+		t.Fatalf("empty pattern got %d hits, want 3", got)
+	}
+	if !slices.Equal(p, pattern("x..x..x.")) {
+		t.Fatal("Randomize changed its input")
+	}
+}
+
+func TestMutateFlipsDistinctSteps(t *testing.T) {
+	p := pattern("x...x...")
+	for n, want := range []int{0, 1, 3, 8, 20} {
+		got := Mutate(p, want, rand.New(rand.NewPCG(uint64(n), 0)))
+		flipped := 0
+		for k := range p {
+			if got[k] != p[k] {
+				flipped++
+			}
+		}
+		if flipped != min(want, len(p)) {
+			t.Fatalf("Mutate(%d) flipped %d steps: %v", want, flipped, got)
+		}
+	}
+}
+
+func TestShiftAndReverse(t *testing.T) {
+	p := pattern("xx..x...")
+	if got, want := Shift(p, 1), pattern(".xx..x.."); !slices.Equal(got, want) {
+		t.Fatalf("Shift(1) = %v, want %v", got, want)
+	}
+	if got, want := Shift(p, -1), pattern("x..x...x"); !slices.Equal(got, want) {
+		t.Fatalf("Shift(-1) = %v, want %v", got, want)
+	}
+	if got := Shift(p, 8); !slices.Equal(got, p) {
+		t.Fatalf("Shift(8) = %v, want the pattern back", got)
+	}
+	if got, want := Reverse(p), pattern("...x..xx"); !slices.Equal(got, want) {
+		t.Fatalf("Reverse = %v, want %v", got, want)
+	}
+	if len(Shift(nil, 3)) != 0 || len(Reverse(nil)) != 0 {
+		t.Fatal("empty pattern did not stay empty")
+	}
+}
@@ -0,0 +1,225 @@
+// Package audiotest provides helpers for audio regression tests: WAV
+// reading and writing, RMS comparison against golden renders, onset
+// detection and a recorder that captures hits with their timestamps.
+package audiotest
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ingyamilmolinar/tunkul/internal/audio"
+)
+
+const (
+	onsetWindow  = 0.001 // seconds per energy frame of the onset detector
+	onsetHistory = 0.02  // seconds of the background energy average
+	onsetRatio   = 4.0   // energy jump over the background that marks an onset
+	onsetFloor   = 1e-5  // mean-square energy below which nothing is an onset
+	onsetHold    = 0.03  // seconds after an onset during which no other is reported
+)
+
+// WriteWAV writes interleaved samples in [-1,1] as a 16-bit PCM WAV file.
+func WriteWAV(path string, samples []float32, sampleRate, channels int) error {
+	data := make([]byte, 44+2*len(samples))
+	copy(data[0:], "RIFF")
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+	copy(data[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(data[16:], 16)
+	binary.LittleEndian.PutUint16(data[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(data[22:], uint16(channels))
+	binary.LittleEndian.PutUint32(data[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(data[28:], uint32(sampleRate*channels*2))
+	binary.LittleEndian.PutUint16(data[32:], uint16(channels*2))
+	binary.LittleEndian.PutUint16(data[34:], 16)
+	copy(data[36:], "data")
+	binary.LittleEndian.PutUint32(data[40:], uint32(2*len(samples)))
+	for i, s := range samples {
+		v := int16(math.Max(-1, math.Min(1, float64(s))) * 32767)
+		binary.LittleEndian.PutUint16(data[44+2*i:], uint16(v))
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// ReadWAV reads a 16-bit PCM WAV file into interleaved samples in [-1,1].
+func ReadWAV(path string) (samples []float32, sampleRate, channels int, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, 0, 0, fmt.Errorf("%s: not a WAV file", path)
+	}
+	for off := 12; off+8 <= len(data); {
+		id := string(data[off : off+4])
+		size := int(binary.LittleEndian.Uint32(data[off+4:]))
+		body := data[off+8 : min(off+8+size, len(data))]
+		switch id {
+		case "fmt ":
+			if len(body) < 16 || binary.LittleEndian.Uint16(body[0:]) != 1 || binary.LittleEndian.Uint16(body[14:]) != 16 {
+				return nil, 0, 0, fmt.Errorf("%s: only 16-bit PCM is supported", path)
+			}
+			channels = int(binary.LittleEndian.Uint16(body[2:]))
+			sampleRate = int(binary.LittleEndian.Uint32(body[4:]))
+		case "data":
+			if channels == 0 {
+				return nil, 0, 0, fmt.Errorf("%s: data before fmt chunk", path)
+			}
+			samples = make([]float32, len(body)/2)
+			for i := range samples {
+				samples[i] = float32(int16(binary.LittleEndian.Uint16(body[2*i:]))) / 32767
+			}
+			return samples, sampleRate, channels, nil
+		}
+		off += 8 + size + size%2
+	}
+	return nil, 0, 0, fmt.Errorf("%s: no data chunk", path)
+}
+
+// RMS returns the root mean square of samples.
+func RMS(samples []float32) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+// RMSDiff returns the RMS of the sample-wise difference of a and b. The
+// shorter buffer is treated as padded with silence.
+func RMSDiff(a, b []float32) float64 {
+	n := max(len(a), len(b))
+	if n == 0 {
+		return 0
+	}
+	var sum float64
+	for i := 0; i < n; i++ {
+		var x, y float64
+		if i < len(a) {
+			x = float64(a[i])
+		}
+		if i < len(b) {
+			y = float64(b[i])
+		}
+		sum += (x - y) * (x - y)
+	}
+	return math.Sqrt(sum / float64(n))
+}
+
+// Onsets returns the frames at which new sounds start in interleaved
+// samples. The signal is cut into 1ms energy frames; a frame whose energy
+// jumps well above the recent average marks a hit, which is then refined to
+// the first sample in that frame carrying a significant part of its energy,
+// so onsets are accurate to within one energy frame. Hits starting over the
+// tail of a much louder sound may be missed.
+func Onsets(samples []float32, sampleRate, channels int) []int {
+	win := max(1, int(onsetWindow*float64(sampleRate)))
+	frames := len(samples) / channels
+	alpha := float64(win) / (onsetHistory * float64(sampleRate))
+	hold := int(onsetHold * float64(sampleRate))
+	mono := func(i int) float64 {
+		var s float64
+		for c := 0; c < channels; c++ {
+			s += float64(samples[i*channels+c])
+		}
+		return s / float64(channels)
+	}
+	var onsets []int
+	var bg float64
+	last := -hold
+	for start := 0; start+win <= frames; start += win {
+		var e float64
+		for i := start; i < start+win; i++ {
+			e += mono(i) * mono(i)
+		}
+		e /= float64(win)
+		if e > onsetFloor && e > onsetRatio*bg && start-last >= hold {
+			at := start
+			for i := start; i < start+win; i++ {
+				if mono(i)*mono(i) >= e/4 {
+					at = i
+					break
+				}
+			}
+			onsets = append(onsets, at)
+			last = at
+		}
+		bg += (e - bg) * alpha
+	}
+	return onsets
+}
+
+// AssertOnsets fails t unless got contains exactly one onset within tol
+// frames of each wanted frame and no others.
+func AssertOnsets(t testing.TB, got, want []int, tol int) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d onsets %v, want %d near %v (±%d)", len(got), got, len(want), want, tol)
+	}
+	for i := range want {
+		if d := got[i] - want[i]; d < -tol || d > tol {
+			t.Fatalf("onset %d at frame %d, want %d (±%d); all onsets %v", i, got[i], want[i], tol, got)
+		}
+	}
+}
+
+// CompareGolden compares interleaved samples with the WAV at path and fails
+// t if the RMS of their difference exceeds tol. With update set the file is
+// rewritten from samples instead; callers wire it to their own -update flag.
+func CompareGolden(t testing.TB, path string, samples []float32, sampleRate, channels int, tol float64, update bool) {
+	t.Helper()
+	if update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteWAV(path, samples, sampleRate, channels); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, sr, ch, err := ReadWAV(path)
+	if errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("golden %s missing; run the test with -update to create it", path)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sr != sampleRate || ch != channels {
+		t.Fatalf("golden %s is %dHz/%dch, render is %dHz/%dch", path, sr, ch, sampleRate, channels)
+	}
+	if d := RMSDiff(samples, want); d > tol {
+		t.Fatalf("render differs from golden %s: RMS diff %.5f > %.5f (golden RMS %.5f, render RMS %.5f)",
+			path, d, tol, RMS(want), RMS(samples))
+	}
+}
+
+// Recorder captures hits in place of audio.Trigger, stamping each with the
+// time reported by Now.
+type Recorder struct {
+	Now  func() float64
+	Hits []audio.Hit
+}
+
+// Trigger records h with When set to the current time.
+func (r *Recorder) Trigger(h audio.Hit) {
+	h.When = r.Now()
+	r.Hits = append(r.Hits, h)
+}
+
+// Frames returns the frame at which each recorded hit starts, sorted.
+func (r *Recorder) Frames(sampleRate int) []int {
+	out := make([]int, len(r.Hits))
+	for i, h := range r.Hits {
+		out[i] = int(math.Round(h.When * float64(sampleRate)))
+	}
+	slices.Sort(out)
+	return out
+}
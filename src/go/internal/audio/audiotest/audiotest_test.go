@@ -0,0 +1,76 @@
+package audiotest
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/ingyamilmolinar/tunkul/internal/audio"
+)
+
+// clicks renders decaying 200Hz bursts starting at the given frames.
+func clicks(frames, sampleRate int, at ...int) []float32 {
+	out := make([]float32, frames)
+	for _, a := range at {
+		for i := a; i < frames; i++ {
+			t := float64(i-a) / float64(sampleRate)
+			out[i] += float32(0.8 * math.Exp(-t*30) * math.Sin(2*math.Pi*200*t+math.Pi/2))
+		}
+	}
+	return out
+}
+
+func TestWAVRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rt.wav")
+	in := []float32{0, 0.5, -0.5, 1, -1, 0.25}
+	if err := WriteWAV(path, in, 8000, 2); err != nil {
+		t.Fatal(err)
+	}
+	out, sr, ch, err := ReadWAV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sr != 8000 || ch != 2 || len(out) != len(in) {
+		t.Fatalf("got %dHz %dch %d samples", sr, ch, len(out))
+	}
+	if d := RMSDiff(in, out); d > 1e-4 {
+		t.Fatalf("round trip RMS diff %f", d)
+	}
+}
+
+func TestRMSDiffPadsShorterBuffer(t *testing.T) {
+	if d := RMSDiff([]float32{1, 1}, []float32{1}); math.Abs(d-math.Sqrt(0.5)) > 1e-9 {
+		t.Fatalf("got %f", d)
+	}
+	if d := RMSDiff(nil, nil); d != 0 {
+		t.Fatalf("got %f for empty buffers", d)
+	}
+}
+
+func TestOnsetsFindsHits(t *testing.T) {
+	const sr = 44100
+	want := []int{1000, 12345, 30000}
+	got := Onsets(clicks(sr, sr, want...), sr, 1)
+	AssertOnsets(t, got, want, sr/1000)
+}
+
+func TestOnsetsIgnoresSilence(t *testing.T) {
+	if got := Onsets(make([]float32, 44100), 44100, 2); len(got) != 0 {
+		t.Fatalf("onsets in silence: %v", got)
+	}
+}
+
+func TestRecorderStampsHits(t *testing.T) {
+	now := 0.0
+	r := &Recorder{Now: func() float64 { return now }}
+	now = 0.5
+	r.Trigger(audio.Hit{Instrument: "snare"})
+	now = 0.25
+	r.Trigger(audio.Hit{Instrument: "kick"})
+	if r.Hits[0].When != 0.5 || r.Hits[1].Instrument != "kick" {
+		t.Fatalf("hits %+v", r.Hits)
+	}
+	if f := r.Frames(1000); f[0] != 250 || f[1] != 500 {
+		t.Fatalf("frames %v", f)
+	}
+}
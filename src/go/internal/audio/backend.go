@@ -0,0 +1,215 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backend delivers the mixed output stream to a device or sink.
+type Backend interface {
+	// Start begins pulling interleaved 16-bit little-endian PCM from src.
+	Start(src io.Reader, sampleRate, channels int) error
+	// Resume restarts output suspended by the platform, such as a browser
+	// autoplay policy.
+	Resume() error
+	// Close stops pulling from src and releases the output.
+	Close() error
+}
+
+// NewBackend returns the backend described by spec, the value of the -audio
+// flag: "null" discards audio, "file:PATH" records it to a WAV file and any
+// other value names a platform device backend ("oto" on desktop, "webaudio"
+// in the browser). An empty spec selects the platform default.
+func NewBackend(spec string) (Backend, error) {
+	switch {
+	case spec == "null":
+		return NewNullBackend(), nil
+	case strings.HasPrefix(spec, "file:"):
+		path := strings.TrimPrefix(spec, "file:")
+		if path == "" {
+			return nil, fmt.Errorf("audio backend %q: missing file path", spec)
+		}
+		return NewFileBackend(path), nil
+	}
+	return platformBackend(spec)
+}
+
+// pumpPeriod is how often the null and file backends pull from the mixer.
+const pumpPeriod = 10 * time.Millisecond
+
+// pump pulls audio from a source in real time, as a sound card would, and
+// hands each chunk to a sink. Pacing by the wall clock keeps the mixer's
+// sample position in step with Now so scheduled hits land where they would
+// on a device.
+type pump struct {
+	stop chan struct{}
+	done chan struct{}
+	err  error
+}
+
+func startPump(src io.Reader, sampleRate, channels int, sink func([]byte) error) *pump {
+	p := &pump{stop: make(chan struct{}), done: make(chan struct{})}
+	frameBytes := 2 * channels
+	go func() {
+		defer close(p.done)
+		t := time.NewTicker(pumpPeriod)
+		defer t.Stop()
+		begin := time.Now()
+		var rendered int
+		var buf []byte
+		for {
+			select {
+			case <-p.stop:
+				return
+			case now := <-t.C:
+				due := int(now.Sub(begin).Seconds()*float64(sampleRate)) - rendered
+				if due <= 0 {
+					continue
+				}
+				if cap(buf) < due*frameBytes {
+					buf = make([]byte, due*frameBytes)
+				}
+				buf = buf[:due*frameBytes]
+				if _, err := io.ReadFull(src, buf); err != nil {
+					p.err = err
+					return
+				}
+				if err := sink(buf); err != nil {
+					p.err = err
+					return
+				}
+				rendered += due
+			}
+		}
+	}()
+	return p
+}
+
+// close stops the pump and waits for its goroutine to exit.
+func (p *pump) close() error {
+	close(p.stop)
+	<-p.done
+	return p.err
+}
+
+// NullBackend pulls the mix in real time and discards it, for headless runs
+// without a sound device.
+type NullBackend struct {
+	mu sync.Mutex
+	p  *pump
+}
+
+func NewNullBackend() *NullBackend { return &NullBackend{} }
+
+func (b *NullBackend) Start(src io.Reader, sampleRate, channels int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.p != nil {
+		return fmt.Errorf("null backend already started")
+	}
+	b.p = startPump(src, sampleRate, channels, func([]byte) error { return nil })
+	return nil
+}
+
+func (b *NullBackend) Resume() error { return nil }
+
+func (b *NullBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.p == nil {
+		return nil
+	}
+	err := b.p.close()
+	b.p = nil
+	return err
+}
+
+// FileBackend records the mix in real time to a 16-bit PCM WAV file. The
+// header sizes are filled in when the backend is closed.
+type FileBackend struct {
+	Path string
+
+	mu       sync.Mutex
+	f        *os.File
+	p        *pump
+	channels int
+	rate     int
+	written  int64
+}
+
+func NewFileBackend(path string) *FileBackend { return &FileBackend{Path: path} }
+
+const wavHeaderSize = 44
+
+func (b *FileBackend) Start(src io.Reader, sampleRate, channels int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.p != nil {
+		return fmt.Errorf("file backend already started")
+	}
+	f, err := os.Create(b.Path)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", b.Path, err)
+	}
+	b.f, b.rate, b.channels, b.written = f, sampleRate, channels, 0
+	if err := b.writeHeader(); err != nil {
+		f.Close()
+		return err
+	}
+	b.p = startPump(src, sampleRate, channels, func(chunk []byte) error {
+		n, err := f.Write(chunk)
+		b.written += int64(n)
+		return err
+	})
+	return nil
+}
+
+func (b *FileBackend) Resume() error { return nil }
+
+// Close stops recording and finalises the WAV header.
+func (b *FileBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.p == nil {
+		return nil
+	}
+	err := b.p.close()
+	b.p = nil
+	if _, serr := b.f.Seek(0, io.SeekStart); serr != nil && err == nil {
+		err = serr
+	}
+	if herr := b.writeHeader(); herr != nil && err == nil {
+		err = herr
+	}
+	if cerr := b.f.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeHeader writes a canonical 44-byte WAV header for the data written so
+// far.
+func (b *FileBackend) writeHeader() error {
+	var h [wavHeaderSize]byte
+	copy(h[0:], "RIFF")
+	binary.LittleEndian.PutUint32(h[4:], uint32(36+b.written))
+	copy(h[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(h[16:], 16)
+	binary.LittleEndian.PutUint16(h[20:], 1) // PCM
+	binary.LittleEndian.PutUint16(h[22:], uint16(b.channels))
+	binary.LittleEndian.PutUint32(h[24:], uint32(b.rate))
+	binary.LittleEndian.PutUint32(h[28:], uint32(b.rate*b.channels*2)) // byte rate
+	binary.LittleEndian.PutUint16(h[32:], uint16(b.channels*2))        // block align
+	binary.LittleEndian.PutUint16(h[34:], 16)                          // bits per sample
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], uint32(b.written))
+	if _, err := b.f.Write(h[:]); err != nil {
+		return fmt.Errorf("write wav header: %w", err)
+	}
+	return nil
+}
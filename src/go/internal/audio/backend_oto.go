@@ -0,0 +1,87 @@
+//go:build !js && !wasm && !test
+
+package audio
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ebitengine/oto/v3"
+)
+
+// oto allows a single context per process, so it is created on first use and
+// shared by every otoBackend.
+var (
+	otoCtx     *oto.Context
+	otoErr     error
+	otoOnce    sync.Once
+	otoRate    int
+	otoChannel int
+)
+
+func otoContext(sampleRate, channels int) (*oto.Context, error) {
+	otoOnce.Do(func() {
+		ctx, ready, err := oto.NewContext(&oto.NewContextOptions{
+			SampleRate:   sampleRate,
+			ChannelCount: channels,
+			Format:       oto.FormatSignedInt16LE,
+			BufferSize:   10 * time.Millisecond,
+		})
+		if err != nil {
+			otoErr = err
+			return
+		}
+		<-ready
+		otoCtx, otoRate, otoChannel = ctx, sampleRate, channels
+	})
+	if otoErr != nil {
+		return nil, otoErr
+	}
+	if sampleRate != otoRate || channels != otoChannel {
+		return nil, fmt.Errorf("oto context is %dHz/%dch, requested %dHz/%dch", otoRate, otoChannel, sampleRate, channels)
+	}
+	return otoCtx, nil
+}
+
+// otoBackend plays the mix on the system sound device.
+type otoBackend struct {
+	player *oto.Player
+}
+
+func platformBackend(spec string) (Backend, error) {
+	switch spec {
+	case "", "oto":
+		return &otoBackend{}, nil
+	}
+	return nil, fmt.Errorf("unknown audio backend %q", spec)
+}
+
+func (b *otoBackend) Start(src io.Reader, sampleRate, channels int) error {
+	c, err := otoContext(sampleRate, channels)
+	if err != nil {
+		return err
+	}
+	p := c.NewPlayer(src)
+	p.SetBufferSize(sampleRate / 100 * 2 * channels) // 10ms
+	p.Play()
+	b.player = p
+	return nil
+}
+
+func (b *otoBackend) Resume() error {
+	if otoCtx == nil {
+		return nil
+	}
+	return otoCtx.Resume()
+}
+
+func (b *otoBackend) Close() error {
+	if b.player == nil {
+		return nil
+	}
+	err := b.player.Close()
+	b.player = nil
+	return err
+}
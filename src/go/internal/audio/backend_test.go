@@ -0,0 +1,94 @@
+package audio
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rampReader produces a 16-bit counter and records how many bytes were read.
+type rampReader struct {
+	n    atomic.Int64
+	next int16
+}
+
+func (r *rampReader) Read(p []byte) (int, error) {
+	for i := 0; i+1 < len(p); i += 2 {
+		binary.LittleEndian.PutUint16(p[i:], uint16(r.next))
+		r.next++
+	}
+	r.n.Add(int64(len(p)))
+	return len(p), nil
+}
+
+func TestNewBackendParsesSpec(t *testing.T) {
+	if b, err := NewBackend("null"); err != nil || b == nil {
+		t.Fatalf("null: %v %v", b, err)
+	}
+	if b, err := NewBackend("file:out.wav"); err != nil || b.(*FileBackend).Path != "out.wav" {
+		t.Fatalf("file: %v %v", b, err)
+	}
+	if _, err := NewBackend("file:"); err == nil {
+		t.Fatal("expected error for missing path")
+	}
+	if _, err := NewBackend("bogus"); err == nil {
+		t.Fatal("expected error for unknown backend")
+	}
+}
+
+func TestNullBackendPullsInRealTime(t *testing.T) {
+	src := &rampReader{}
+	b := NewNullBackend()
+	if err := b.Start(src, 8000, 1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	n := src.n.Load()
+	if n == 0 {
+		t.Fatal("null backend never read from the source")
+	}
+	if n > 2*8000/5 { // at most ~200ms worth of 16-bit mono
+		t.Fatalf("null backend read %d bytes, faster than real time", n)
+	}
+}
+
+func TestFileBackendWritesWAV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.wav")
+	b := NewFileBackend(path)
+	if err := b.Start(&rampReader{}, 8000, 2); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) <= wavHeaderSize || string(data[0:4]) != "RIFF" || string(data[8:16]) != "WAVEfmt " || string(data[36:40]) != "data" {
+		t.Fatalf("bad header % x", data[:min(len(data), wavHeaderSize)])
+	}
+	le := binary.LittleEndian
+	if ch, sr, bits := le.Uint16(data[22:]), le.Uint32(data[24:]), le.Uint16(data[34:]); ch != 2 || sr != 8000 || bits != 16 {
+		t.Fatalf("format %dch %dHz %dbit", ch, sr, bits)
+	}
+	size := le.Uint32(data[40:])
+	if int(size) != len(data)-wavHeaderSize || le.Uint32(data[4:]) != 36+size {
+		t.Fatalf("sizes riff=%d data=%d file=%d", le.Uint32(data[4:]), size, len(data))
+	}
+	if size%4 != 0 {
+		t.Fatalf("data size %d is not whole frames", size)
+	}
+	for i := 0; i < 4; i++ {
+		if v := int16(le.Uint16(data[wavHeaderSize+2*i:])); v != int16(i) {
+			t.Fatalf("sample %d = %d, want %d", i, v, i)
+		}
+	}
+}
@@ -2,17 +2,13 @@
 
 package audio
 
-import "time"
-
 // Clap renders multiple short noise bursts for a hand clap.
-type Clap struct{}
+type Clap struct{ DrumParams }
 
-// NewVoice generates a clap hit via the C renderer.
-func (Clap) NewVoice(bpm, sampleRate int) Voice {
-	spb := 60 / float64(bpm)
-	dur := time.Duration(spb * 0.25 * float64(time.Second))
-	samples := int(float64(sampleRate) * dur.Seconds())
-	buf := make([]float32, samples)
-	renderClap(buf, sampleRate, samples)
-	return &cVoice{buf: buf}
+// NewVoice synthesises a clap hit shaped by the instrument's parameters.
+func (d Clap) NewVoice(bpm, sampleRate int) Voice {
+	return &cVoice{buf: renderDrum(drumClap, d.DrumParams, bpm, sampleRate)}
 }
+
+// WithParams returns a clap using p.
+func (Clap) WithParams(p DrumParams) Instrument { return Clap{p} }
@@ -15,77 +15,30 @@ import (
 	"unsafe"
 )
 
-func renderSnare(buf []float32, sampleRate, samples int) {
-	if samples > len(buf) {
-		panic("renderSnare: samples exceeds buffer length")
-	}
-	if len(buf) == 0 || samples == 0 {
-		return
-	}
-	C.render_snare((*C.float)(unsafe.Pointer(&buf[0])), C.int(sampleRate), C.int(samples))
-}
-
-func renderKick(buf []float32, sampleRate, samples int) {
-	if samples > len(buf) {
-		panic("renderKick: samples exceeds buffer length")
-	}
-	if len(buf) == 0 || samples == 0 {
-		return
-	}
-	C.render_kick((*C.float)(unsafe.Pointer(&buf[0])), C.int(sampleRate), C.int(samples))
-}
-
-func renderHiHat(buf []float32, sampleRate, samples int) {
-	if samples > len(buf) {
-		panic("renderHiHat: samples exceeds buffer length")
-	}
-	if len(buf) == 0 || samples == 0 {
-		return
-	}
-	C.render_hihat((*C.float)(unsafe.Pointer(&buf[0])), C.int(sampleRate), C.int(samples))
-}
-
-func renderTom(buf []float32, sampleRate, samples int) {
-	if samples > len(buf) {
-		panic("renderTom: samples exceeds buffer length")
-	}
-	if len(buf) == 0 || samples == 0 {
-		return
-	}
-	C.render_tom((*C.float)(unsafe.Pointer(&buf[0])), C.int(sampleRate), C.int(samples))
-}
-
-func renderClap(buf []float32, sampleRate, samples int) {
-	if samples > len(buf) {
-		panic("renderClap: samples exceeds buffer length")
-	}
-	if len(buf) == 0 || samples == 0 {
-		return
-	}
-	C.render_clap((*C.float)(unsafe.Pointer(&buf[0])), C.int(sampleRate), C.int(samples))
-}
-
-func loadWav(path string) ([]float32, int, error) {
+// loadWav decodes path into interleaved frames and returns them with the
+// sample rate and channel count (1 or 2).
+func loadWav(path string) ([]float32, int, int, error) {
 	cpath := C.CString(path)
 	defer C.free(unsafe.Pointer(cpath))
 	var ptr *C.float
-	var sr C.int
-	frames := C.load_wav(cpath, &ptr, &sr)
+	var sr, ch C.int
+	frames := C.load_wav(cpath, &ptr, &sr, &ch)
 	if frames < 0 {
 		msg := C.GoString(C.result_description(C.int(frames)))
-		return nil, 0, fmt.Errorf("load_wav: %s", msg)
+		return nil, 0, 0, fmt.Errorf("load_wav: %s", msg)
 	}
 	if frames == 0 {
-		return nil, 0, errors.New("load_wav: no frames")
+		return nil, 0, 0, errors.New("load_wav: no frames")
 	}
 	if ptr == nil {
-		return nil, 0, errors.New("load_wav: C returned nil pointer")
+		return nil, 0, 0, errors.New("load_wav: C returned nil pointer")
 	}
-	tmp := unsafe.Slice((*float32)(unsafe.Pointer(ptr)), int(frames))
-	buf := make([]float32, int(frames))
+	n := int(frames) * int(ch)
+	tmp := unsafe.Slice((*float32)(unsafe.Pointer(ptr)), n)
+	buf := make([]float32, n)
 	copy(buf, tmp)
 	C.free(unsafe.Pointer(ptr))
-	return buf, int(sr), nil
+	return buf, int(sr), int(ch), nil
 }
 
 type cVoice struct {
@@ -0,0 +1,328 @@
+package audio
+
+import "math"
+
+// Effect transforms a mono signal one sample at a time. Implementations keep
+// their own state (filter memory, delay lines) between calls.
+type Effect interface {
+	Process(x float64) float64
+}
+
+// FilterType selects the response of a Biquad.
+type FilterType int
+
+const (
+	FilterOff FilterType = iota
+	FilterLowPass
+	FilterHighPass
+	FilterBandPass
+)
+
+// FilterNames are display labels indexed by FilterType.
+var FilterNames = []string{"Off", "LP", "HP", "BP"}
+
+// DelayDivisions are the tempo-synced delay times, in beats, selectable by
+// EffectSettings.DelayDiv.
+var DelayDivisions = []float64{0.25, 0.5, 0.75, 1}
+
+// DelayDivisionNames are display labels for DelayDivisions.
+var DelayDivisionNames = []string{"1/16", "1/8", "3/16", "1/4"}
+
+// EffectSettings configures the effects chain of one drum row. Continuous
+// fields are normalised to 0..1 and the zero value bypasses every stage.
+type EffectSettings struct {
+	Drive         float64    // saturation amount
+	Filter        FilterType // biquad response
+	Cutoff        float64    // 20Hz..20kHz on a log scale
+	Resonance     float64    // Q from 0.707 to 10
+	DelayDiv      int        // index into DelayDivisions
+	DelayMix      float64    // wet level of the delay
+	DelayFeedback float64    // repeats, capped below runaway
+	ReverbMix     float64    // wet level of the reverb
+	ReverbSize    float64    // room size
+}
+
+// cutoffHz maps Cutoff onto 20Hz..20kHz.
+func (s EffectSettings) cutoffHz() float64 { return 20 * math.Pow(1000, s.Cutoff) }
+
+// q maps Resonance onto a filter Q from 0.707 to 10.
+func (s EffectSettings) q() float64 { return 0.707 + s.Resonance*9.3 }
+
+// delaySeconds returns the delay time of DelayDiv at bpm.
+func (s EffectSettings) delaySeconds(bpm int) float64 {
+	div := DelayDivisions[0]
+	if s.DelayDiv >= 0 && s.DelayDiv < len(DelayDivisions) {
+		div = DelayDivisions[s.DelayDiv]
+	}
+	if bpm <= 0 {
+		bpm = 120
+	}
+	return div * 60 / float64(bpm)
+}
+
+// Saturator soft-clips the signal with a tanh curve.
+type Saturator struct {
+	Drive float64 // 0 bypasses
+}
+
+func (s *Saturator) Process(x float64) float64 {
+	if s.Drive <= 0 {
+		return x
+	}
+	g := 1 + 9*s.Drive
+	return math.Tanh(g*x) / math.Tanh(g)
+}
+
+// Biquad is a second-order IIR filter using the RBJ cookbook coefficients.
+type Biquad struct {
+	kind               FilterType
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+// NewBiquad returns a filter of the given type.
+func NewBiquad(kind FilterType, cutoffHz, q float64, sampleRate int) *Biquad {
+	b := &Biquad{}
+	b.Set(kind, cutoffHz, q, sampleRate)
+	return b
+}
+
+// Set recomputes the coefficients while keeping the filter memory.
+func (b *Biquad) Set(kind FilterType, cutoffHz, q float64, sampleRate int) {
+	b.kind = kind
+	if kind == FilterOff {
+		return
+	}
+	nyquist := float64(sampleRate) / 2
+	cutoffHz = math.Max(10, math.Min(cutoffHz, nyquist*0.99))
+	if q <= 0 {
+		q = math.Sqrt2 / 2
+	}
+	w0 := 2 * math.Pi * cutoffHz / float64(sampleRate)
+	cosw, sinw := math.Cos(w0), math.Sin(w0)
+	alpha := sinw / (2 * q)
+	var b0, b1, b2 float64
+	switch kind {
+	case FilterLowPass:
+		b0, b1, b2 = (1-cosw)/2, 1-cosw, (1-cosw)/2
+	case FilterHighPass:
+		b0, b1, b2 = (1+cosw)/2, -(1 + cosw), (1+cosw)/2
+	case FilterBandPass:
+		b0, b1, b2 = alpha, 0, -alpha
+	}
+	a0 := 1 + alpha
+	b.b0, b.b1, b.b2 = b0/a0, b1/a0, b2/a0
+	b.a1, b.a2 = -2*cosw/a0, (1-alpha)/a0
+}
+
+func (b *Biquad) Process(x float64) float64 {
+	if b.kind == FilterOff {
+		return x
+	}
+	y := b.b0*x + b.b1*b.x1 + b.b2*b.x2 - b.a1*b.y1 - b.a2*b.y2
+	b.x2, b.x1 = b.x1, x
+	b.y2, b.y1 = b.y1, y
+	return y
+}
+
+// Delay is a feedback delay line mixed with the dry signal.
+type Delay struct {
+	buf      []float64
+	length   int
+	pos      int
+	feedback float64
+	mix      float64
+}
+
+// NewDelay returns a delay of the given length in seconds.
+func NewDelay(seconds, feedback, mix float64, sampleRate int) *Delay {
+	d := &Delay{}
+	d.Set(seconds, feedback, mix, sampleRate)
+	return d
+}
+
+// Set changes the delay parameters. The delay line only grows, so shortening
+// and lengthening the time keeps already buffered repeats.
+func (d *Delay) Set(seconds, feedback, mix float64, sampleRate int) {
+	n := int(seconds * float64(sampleRate))
+	if n < 1 {
+		n = 1
+	}
+	if n > len(d.buf) {
+		buf := make([]float64, n)
+		copy(buf, d.buf)
+		d.buf = buf
+	}
+	d.length = n
+	if d.pos >= n {
+		d.pos = 0
+	}
+	d.feedback = math.Max(0, math.Min(feedback, 0.95))
+	d.mix = mix
+}
+
+func (d *Delay) Process(x float64) float64 {
+	if d.mix <= 0 && d.feedback <= 0 {
+		return x
+	}
+	wet := d.buf[d.pos]
+	d.buf[d.pos] = x + wet*d.feedback
+	d.pos++
+	if d.pos >= d.length {
+		d.pos = 0
+	}
+	return x + wet*d.mix
+}
+
+// Freeverb tunings at 44.1kHz. The right channel's delay lines are offset by
+// reverbStereoSpread samples to decorrelate it from the left.
+var (
+	combTunings    = []int{1116, 1188, 1277, 1356}
+	allpassTunings = []int{556, 441}
+)
+
+const reverbStereoSpread = 23
+
+type comb struct {
+	buf   []float64
+	pos   int
+	store float64
+}
+
+type allpass struct {
+	buf []float64
+	pos int
+}
+
+// Reverb is a small Schroeder/Freeverb style reverberator.
+type Reverb struct {
+	combs     []comb
+	allpasses []allpass
+	feedback  float64
+	damp      float64
+	mix       float64
+}
+
+// NewReverb returns a reverb with the given room size and wet mix (0..1).
+func NewReverb(size, mix float64, sampleRate int) *Reverb {
+	return newReverb(size, mix, sampleRate, 0)
+}
+
+// newReverb builds a reverb whose delay lines are lengthened by spread
+// samples, used to give the right channel of a stereo pair its own tail.
+func newReverb(size, mix float64, sampleRate, spread int) *Reverb {
+	r := &Reverb{damp: 0.2}
+	scale := float64(sampleRate) / 44100
+	for _, n := range combTunings {
+		r.combs = append(r.combs, comb{buf: make([]float64, int(float64(n+spread)*scale)+1)})
+	}
+	for _, n := range allpassTunings {
+		r.allpasses = append(r.allpasses, allpass{buf: make([]float64, int(float64(n+spread)*scale)+1)})
+	}
+	r.Set(size, mix)
+	return r
+}
+
+// Set changes the room size and wet mix.
+func (r *Reverb) Set(size, mix float64) {
+	r.feedback = reverbFeedback(size)
+	r.mix = mix
+}
+
+// reverbFeedback is the comb feedback for a room size.
+func reverbFeedback(size float64) float64 {
+	return 0.7 + 0.28*math.Max(0, math.Min(size, 1))
+}
+
+// reverbSeconds is how long a reverb of the given room size takes to die
+// away by 60dB, the time its longest comb filter needs at its feedback.
+func reverbSeconds(size float64) float64 {
+	comb := float64(combTunings[len(combTunings)-1]) / 44100
+	return -3 * comb / math.Log10(reverbFeedback(size))
+}
+
+func (r *Reverb) Process(x float64) float64 {
+	if r.mix <= 0 {
+		return x
+	}
+	in := x * 0.25
+	var out float64
+	for i := range r.combs {
+		c := &r.combs[i]
+		y := c.buf[c.pos]
+		c.store = y*(1-r.damp) + c.store*r.damp
+		c.buf[c.pos] = in + c.store*r.feedback
+		c.pos = (c.pos + 1) % len(c.buf)
+		out += y
+	}
+	for i := range r.allpasses {
+		a := &r.allpasses[i]
+		b := a.buf[a.pos]
+		a.buf[a.pos] = out + b*0.5
+		a.pos = (a.pos + 1) % len(a.buf)
+		out = b - out
+	}
+	return x + out*r.mix
+}
+
+// fxChain is one channel of an effects bus.
+type fxChain struct {
+	sat   Saturator
+	filt  *Biquad
+	delay *Delay
+	rev   *Reverb
+	chain []Effect
+}
+
+func newFXChain(sampleRate, spread int) *fxChain {
+	c := &fxChain{
+		filt:  NewBiquad(FilterOff, 1000, 0.707, sampleRate),
+		delay: NewDelay(0, 0, 0, sampleRate),
+		rev:   newReverb(0, 0, sampleRate, spread),
+	}
+	c.chain = []Effect{&c.sat, c.filt, c.delay, c.rev}
+	return c
+}
+
+func (c *fxChain) Process(x float64) float64 {
+	for _, e := range c.chain {
+		x = e.Process(x)
+	}
+	return x
+}
+
+// fxBus runs the stereo effects chain shared by every voice routed to one
+// bus.
+type fxBus struct {
+	sampleRate int
+	settings   EffectSettings
+	bpm        int
+	ch         [2]*fxChain
+}
+
+func newFXBus(sampleRate int) *fxBus {
+	return &fxBus{
+		sampleRate: sampleRate,
+		ch:         [2]*fxChain{newFXChain(sampleRate, 0), newFXChain(sampleRate, reverbStereoSpread)},
+	}
+}
+
+// configure applies s at the given tempo. Effect state is preserved so
+// tweaking a knob does not cut off ringing tails.
+func (b *fxBus) configure(s EffectSettings, bpm int) {
+	if s == b.settings && bpm == b.bpm {
+		return
+	}
+	b.settings, b.bpm = s, bpm
+	for _, c := range b.ch {
+		c.sat.Drive = s.Drive
+		c.filt.Set(s.Filter, s.cutoffHz(), s.q(), b.sampleRate)
+		c.delay.Set(s.delaySeconds(bpm), s.DelayFeedback, s.DelayMix, b.sampleRate)
+		c.rev.Set(s.ReverbSize, s.ReverbMix)
+	}
+}
+
+// Process runs one stereo frame through the bus.
+func (b *fxBus) Process(l, r float64) (float64, float64) {
+	return b.ch[0].Process(l), b.ch[1].Process(r)
+}
@@ -0,0 +1,116 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func sineRMS(e Effect, freq float64, sampleRate int) float64 {
+	var sum float64
+	n := sampleRate / 10
+	for i := 0; i < n; i++ {
+		y := e.Process(math.Sin(2 * math.Pi * freq * float64(i) / float64(sampleRate)))
+		if i >= n/2 { // skip the filter's settling time
+			sum += y * y
+		}
+	}
+	return math.Sqrt(sum / float64(n-n/2))
+}
+
+func TestBiquadLowPassAttenuatesHighs(t *testing.T) {
+	low := sineRMS(NewBiquad(FilterLowPass, 500, 0.707, 44100), 100, 44100)
+	high := sineRMS(NewBiquad(FilterLowPass, 500, 0.707, 44100), 8000, 44100)
+	if high > low/10 {
+		t.Fatalf("lowpass did not attenuate: low=%f high=%f", low, high)
+	}
+	hp := sineRMS(NewBiquad(FilterHighPass, 500, 0.707, 44100), 100, 44100)
+	if hp > low/5 {
+		t.Fatalf("highpass did not attenuate lows: %f", hp)
+	}
+}
+
+func TestDelayRepeatsImpulse(t *testing.T) {
+	d := NewDelay(0.01, 0.5, 1, 1000) // 10 samples
+	out := make([]float64, 25)
+	for i := range out {
+		x := 0.0
+		if i == 0 {
+			x = 1
+		}
+		out[i] = d.Process(x)
+	}
+	if out[0] != 1 || out[10] != 1 || out[20] != 0.5 {
+		t.Fatalf("unexpected echoes: %v", out)
+	}
+}
+
+func TestSaturatorBounded(t *testing.T) {
+	s := &Saturator{Drive: 1}
+	for _, x := range []float64{-4, -1, 0, 0.3, 1, 4} {
+		if y := s.Process(x); math.Abs(y) > 1.0001 {
+			t.Fatalf("saturator output %f for %f exceeds 1", y, x)
+		}
+	}
+	if (&Saturator{}).Process(3) != 3 {
+		t.Fatalf("zero drive should bypass")
+	}
+}
+
+func TestReverbTail(t *testing.T) {
+	r := NewReverb(0.8, 1, 44100)
+	r.Process(1)
+	var energy float64
+	for i := 0; i < 44100/4; i++ {
+		y := r.Process(0)
+		energy += y * y
+	}
+	if energy == 0 {
+		t.Fatalf("expected reverb tail after impulse")
+	}
+}
+
+func TestFXBusZeroSettingsBypass(t *testing.T) {
+	b := newFXBus(44100)
+	b.configure(EffectSettings{}, 120)
+	for _, x := range []float64{0.5, -0.25, 1} {
+		if l, r := b.Process(x, -x); l != x || r != -x {
+			t.Fatalf("expected bypass, got %f,%f for %f", l, r, x)
+		}
+	}
+}
+
+func TestFXBusReconfigureKeepsDelayTail(t *testing.T) {
+	b := newFXBus(1000)
+	s := EffectSettings{DelayDiv: 0, DelayMix: 1}
+	b.configure(s, 600) // 1/16 at 600 BPM = 25ms = 25 samples
+	b.Process(1, 1)
+	for i := 1; i < 10; i++ {
+		b.Process(0, 0)
+	}
+	s.ReverbSize = 0.5 // unrelated change must not flush the delay line
+	b.configure(s, 600)
+	var echo float64
+	for i := 10; i <= 25; i++ {
+		l, _ := b.Process(0, 0)
+		echo += l
+	}
+	if echo < 0.99 {
+		t.Fatalf("delay tail lost after reconfigure: %f", echo)
+	}
+}
+
+func TestFXBusReverbIsStereo(t *testing.T) {
+	b := newFXBus(44100)
+	b.configure(EffectSettings{ReverbMix: 1, ReverbSize: 0.5}, 120)
+	b.Process(1, 1)
+	differs := false
+	for i := 0; i < 44100/10; i++ {
+		if l, r := b.Process(0, 0); l != r {
+			differs = true
+			break
+		}
+	}
+	if !differs {
+		t.Fatalf("expected decorrelated reverb tails")
+	}
+}
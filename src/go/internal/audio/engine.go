@@ -3,23 +3,28 @@
 package audio
 
 import (
+	"encoding/binary"
+	"math"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/ebitengine/oto/v3"
 )
 
 const (
-	sampleRate          = 44100
-	bufferSizeBytes10ms = sampleRate / 100 * 2 // 10ms of 16-bit mono audio
+	sampleRate      = 44100
+	fadeOutSamples  = sampleRate / 200 // 5ms fade when a voice is choked or stolen
+	voiceLevelDecay = 0.9995           // per-sample fall of a voice's level meter
+	channelCount    = 2
 )
 
 var (
-	ctx   *oto.Context
-	once  sync.Once
-	mix   *mixer
-	start = time.Now()
-	bpm   = 120
+	backend Backend // nil selects the platform default on first use
+	running Backend // backend currently pulling from mix
+	once    sync.Once
+	mix     *mixer
+	start   = time.Now()
+	bpm     = 120
 
 	instruments = map[string]Instrument{}
 	instOrder   []string
@@ -32,11 +37,24 @@ type Voice interface {
 	Sample() (float64, bool)
 }
 
+// StereoVoice is a Voice with two channels. The mixer reads it through
+// SampleStereo; Sample returns a mono downmix.
+type StereoVoice interface {
+	Voice
+	SampleStereo() (l, r float64, done bool)
+}
+
 // Instrument constructs a new Voice instance when triggered.
 type Instrument interface {
 	NewVoice(bpm, sampleRate int) Voice
 }
 
+// ParamInstrument is an Instrument whose sound is shaped by DrumParams.
+type ParamInstrument interface {
+	Instrument
+	WithParams(p DrumParams) Instrument
+}
+
 // Register makes an instrument available for playback by ID.
 func Register(id string, inst Instrument) {
 	instMu.Lock()
@@ -51,60 +69,119 @@ func init() {
 	ResetInstruments()
 }
 
+// SetBackend selects where the mix is sent. It takes effect the next time
+// audio starts, so call it before the first hit or follow it with Reset.
+func SetBackend(b Backend) { backend = b }
+
 func initContext() {
-	c := platformInitContext(sampleRate)
-	if c == nil {
+	b := backend
+	if b == nil {
+		var err error
+		if b, err = platformBackend(""); err != nil {
+			return
+		}
+	}
+	m := newMixer()
+	if err := b.Start(m, sampleRate, channelCount); err != nil {
 		return
 	}
-	ctx = c
-	mix = newMixer(c)
+	running = b
+	mix = m
 }
 
 // Play schedules an instrument by ID at an optional future time.
 func Play(id string, when ...float64) {
-	instMu.RLock()
-	inst, ok := instruments[id]
-	instMu.RUnlock()
+	PlayVol(id, 1, when...)
+}
+
+// PlayVol schedules an instrument by ID at the given volume (0..1) and
+// optional future time.
+func PlayVol(id string, vol float64, when ...float64) {
+	h := Hit{Instrument: id, Volume: vol}
+	if len(when) > 0 {
+		h.When = when[0]
+	}
+	Trigger(h)
+}
+
+// Trigger schedules a hit. Built-in drums are rendered with h.Params.
+func Trigger(h Hit) {
+	v, ok := hitVoice(h)
 	if !ok {
 		return
 	}
 	once.Do(initContext)
-	if ctx == nil {
+	if mix == nil {
 		return
 	}
-	_ = ctx.Resume()
+	_ = running.Resume()
 	delay := 0
-	if len(when) > 0 {
-		d := when[0] - Now()
-		if d > 0 {
-			delay = int(d * sampleRate)
-		}
+	if d := h.When - Now(); d > 0 {
+		delay = int(d * sampleRate)
 	}
-	mix.Schedule(inst.NewVoice(bpm, sampleRate), delay)
+	mix.Configure(h.Bus, h.FX, bpm)
+	mix.ScheduleHit(v, delay, h)
 }
 
-// PlayVol schedules an instrument by ID at the given volume (0..1) and
-// optional future time.
-func PlayVol(id string, vol float64, when ...float64) {
+// hitVoice builds the voice for a hit with its volume and pan applied.
+func hitVoice(h Hit) (Voice, bool) {
 	instMu.RLock()
-	inst, ok := instruments[id]
+	inst, ok := instruments[h.Instrument]
 	instMu.RUnlock()
 	if !ok {
-		return
+		return nil, false
 	}
-	once.Do(initContext)
-	if ctx == nil {
-		return
+	if p, ok := inst.(ParamInstrument); ok {
+		inst = p.WithParams(h.Params)
 	}
-	_ = ctx.Resume()
-	delay := 0
-	if len(when) > 0 {
-		d := when[0] - Now()
-		if d > 0 {
-			delay = int(d * sampleRate)
+	return newScaledVoice(inst.NewVoice(bpm, sampleRate), h.Volume, h.Pan), true
+}
+
+// ReleaseBus frees an effects bus, as when the drum row using it is deleted.
+// Voices still ringing on it finish dry, and the next hit routed to the bus
+// starts it again with empty delay and reverb lines.
+func ReleaseBus(bus int) {
+	if mix != nil {
+		mix.Release(bus)
+	}
+}
+
+// Render mixes hits offline into frames of interleaved stereo samples in
+// [-1,1], independent of the backend and the wall clock. Each hit starts
+// h.When seconds into the render, delayed by OutputLatency like live
+// playback. It is meant for tests and for bouncing patterns to disk.
+func Render(hits []Hit, frames int) []float32 {
+	m := newMixer()
+	for _, h := range hits {
+		v, ok := hitVoice(h)
+		if !ok {
+			continue
 		}
+		m.Configure(h.Bus, h.FX, bpm)
+		m.ScheduleHit(v, int(math.Round(h.When*sampleRate)), h)
+	}
+	buf := make([]byte, frames*2*channelCount)
+	m.Read(buf)
+	out := make([]float32, frames*channelCount)
+	for i := range out {
+		out[i] = float32(int16(binary.LittleEndian.Uint16(buf[2*i:]))) / 32767
 	}
-	mix.Schedule(&scaledVoice{v: inst.NewVoice(bpm, sampleRate), gain: vol}, delay)
+	return out
+}
+
+// SampleRate is the rate, in frames per second, of Render's output.
+const SampleRate = sampleRate
+
+// OutputLatency returns the number of frames the master bus delays the mix.
+func OutputLatency() int { return limiterDelay(sampleRate) }
+
+// Parametric reports whether the instrument registered as id accepts
+// DrumParams.
+func Parametric(id string) bool {
+	instMu.RLock()
+	_, ok := instruments[id].(ParamInstrument)
+	instMu.RUnlock()
+	return ok
 }
 
 // ResetInstruments restores the built-in instrument set.
@@ -121,9 +198,16 @@ func ResetInstruments() {
 	instMu.Unlock()
 }
 
+// scaledVoice applies a hit's volume and pan to a voice.
 type scaledVoice struct {
-	v    Voice
-	gain float64
+	v           Voice
+	gain        float64
+	left, right float64
+}
+
+func newScaledVoice(v Voice, gain, pan float64) *scaledVoice {
+	l, r := panGains(pan)
+	return &scaledVoice{v: v, gain: gain, left: l, right: r}
 }
 
 func (s *scaledVoice) Sample() (float64, bool) {
@@ -131,21 +215,40 @@ func (s *scaledVoice) Sample() (float64, bool) {
 	return f * s.gain, done
 }
 
+func (s *scaledVoice) SampleStereo() (float64, float64, bool) {
+	l, r, done := sampleStereo(s.v)
+	return l * s.gain * s.left, r * s.gain * s.right, done
+}
+
+// sampleStereo reads one frame from v, duplicating mono voices to both
+// channels.
+func sampleStereo(v Voice) (float64, float64, bool) {
+	if sv, ok := v.(StereoVoice); ok {
+		return sv.SampleStereo()
+	}
+	f, done := v.Sample()
+	return f, f, done
+}
+
 // Now returns seconds since program start.
 func Now() float64 { return time.Since(start).Seconds() }
 
-// Reset closes the current audio context so queued sounds are dropped.
+// Reset closes the current backend so queued sounds are dropped. A file
+// backend finalises its recording here.
 func Reset() {
-	ctx = nil
+	if running != nil {
+		_ = running.Close()
+	}
+	running = nil
 	mix = nil
 	once = sync.Once{}
 }
 
-// Resume attempts to resume the underlying audio context.
+// Resume attempts to resume the audio backend.
 func Resume() {
 	once.Do(initContext)
-	if ctx != nil {
-		_ = ctx.Resume()
+	if running != nil {
+		_ = running.Resume()
 	}
 }
 
@@ -174,64 +277,235 @@ func RenameInstrument(oldID, newID string) {
 		}
 	}
 	instMu.Unlock()
+	renameVoiceLimit(oldID, newID)
 }
 
-// mixer mixes multiple voices into a single PCM stream.
+// mixer mixes multiple voices into a single PCM stream. Voices on a non-zero
+// bus are summed and run through that bus's effects chain first, then the
+// whole mix passes through the master bus.
+//
+// Producers never touch the mixing state: voices and bus settings travel
+// through a lock-free queue that Read drains once per buffer, so the audio
+// callback never waits on the UI goroutine.
 type mixer struct {
-	mu     sync.Mutex
+	queue mpsc[mixCmd]
+	cmds  []mixCmd     // scratch for drained commands
+	pos   atomic.Int64 // samples rendered so far, read by producers
+
+	// owned by the audio callback
 	voices []*voiceState
-	pos    int
-	player *oto.Player
+	buses  []*fxBus     // indexed by bus number; buses[0] is always nil (dry)
+	sums   [][2]float64 // per-bus scratch sums for the current frame
+	master *masterBus
+}
+
+// mixCmd is either a voice to start or new settings for an effects bus.
+type mixCmd struct {
+	voice   *voiceState
+	bus     int
+	fx      EffectSettings
+	tempo   int
+	release bool // free the bus instead of configuring it
 }
 
 type voiceState struct {
 	start int
 	v     Voice
+	inst  string // instrument ID, for per-instrument voice limits
+	bus   int
+	choke int     // choke group, 0 for none
+	fade  int     // samples left before a cut voice goes silent, 0 if not fading
+	level float64 // decaying peak of the output, used to find the quietest voice
+	done  bool
 }
 
-func newMixer(c *oto.Context) *mixer {
-	m := &mixer{}
-	p := c.NewPlayer(m)
-	p.SetBufferSize(bufferSizeBytes10ms)
-	p.Play()
-	m.player = p
-	return m
-}
+func newMixer() *mixer { return &mixer{} }
 
-// Schedule adds a voice to start after delaySamples have elapsed.
+// Schedule adds a dry voice to start after delaySamples have elapsed.
 func (m *mixer) Schedule(v Voice, delaySamples int) {
-	m.mu.Lock()
-	m.voices = append(m.voices, &voiceState{start: m.pos + delaySamples, v: v})
-	m.mu.Unlock()
+	m.ScheduleBus(0, v, delaySamples)
+}
+
+// ScheduleBus adds a voice routed through the given effects bus.
+func (m *mixer) ScheduleBus(bus int, v Voice, delaySamples int) {
+	m.ScheduleHit(v, delaySamples, Hit{Bus: bus})
+}
+
+// ScheduleHit adds a voice using the routing of h: its instrument, effects
+// bus, row and choke group.
+func (m *mixer) ScheduleHit(v Voice, delaySamples int, h Hit) {
+	bus := h.Bus
+	if bus < 0 {
+		bus = 0
+	}
+	start := int(m.pos.Load()) + delaySamples
+	m.queue.push(mixCmd{voice: &voiceState{start: start, v: v, inst: h.Instrument, bus: bus, choke: h.Choke}})
+}
+
+// Configure applies effect settings to a bus, creating it on first use.
+func (m *mixer) Configure(bus int, s EffectSettings, tempo int) {
+	if bus <= 0 {
+		return
+	}
+	m.queue.push(mixCmd{bus: bus, fx: s, tempo: tempo})
+}
+
+// apply executes drained commands. Voices whose start time passed while they
+// were queued start immediately.
+func (m *mixer) apply(cmds []mixCmd, pos int) {
+	for _, c := range cmds {
+		if vs := c.voice; vs != nil {
+			if vs.start < pos {
+				vs.start = pos
+			}
+			m.voices = append(m.voices, vs)
+			continue
+		}
+		if c.release {
+			if c.bus < len(m.buses) {
+				m.buses[c.bus] = nil
+			}
+			for _, vs := range m.voices {
+				if vs.bus == c.bus {
+					vs.bus = 0
+				}
+			}
+			continue
+		}
+		for len(m.buses) <= c.bus {
+			m.buses = append(m.buses, nil)
+			m.sums = append(m.sums, [2]float64{})
+		}
+		if m.buses[c.bus] == nil {
+			m.buses[c.bus] = newFXBus(sampleRate)
+		}
+		m.buses[c.bus].configure(c.fx, c.tempo)
+	}
+}
+
+// sounding reports whether o is playing at pos and not already being cut.
+func (o *voiceState) sounding(pos int) bool {
+	return !o.done && o.fade == 0 && o.start < pos
+}
+
+// choke starts fading out every sounding voice in the group of vs, which is
+// starting at pos.
+func (m *mixer) choke(vs *voiceState, pos int) {
+	for _, o := range m.voices {
+		if o != vs && o.choke == vs.choke && o.sounding(pos) {
+			o.fade = fadeOutSamples
+		}
+	}
+}
+
+// admit makes room for vs, which starts at pos, by fading out voices beyond
+// its instrument's voice limit and then beyond the global polyphony.
+func (m *mixer) admit(vs *voiceState, pos int, cfg *polyConfig) {
+	if lim := cfg.limits[vs.inst]; lim > 0 {
+		m.steal(vs, pos, lim, cfg.policy, func(o *voiceState) bool { return o.inst == vs.inst })
+	}
+	if cfg.max > 0 {
+		m.steal(vs, pos, cfg.max, cfg.policy, func(*voiceState) bool { return true })
+	}
 }
 
-// Read implements io.Reader for oto.Player.
+// steal fades out voices matching match until fewer than limit remain
+// sounding, leaving room for vs.
+func (m *mixer) steal(vs *voiceState, pos, limit int, policy StealPolicy, match func(*voiceState) bool) {
+	for {
+		n := 0
+		var victim *voiceState
+		for _, o := range m.voices {
+			if o == vs || !o.sounding(pos) || !match(o) {
+				continue
+			}
+			n++
+			switch {
+			case victim == nil:
+				victim = o
+			case policy == StealQuietest && o.level < victim.level:
+				victim = o
+			case policy == StealOldest && o.start < victim.start:
+				victim = o
+			}
+		}
+		if n < limit || victim == nil {
+			return
+		}
+		victim.fade = fadeOutSamples
+	}
+}
+
+// Release frees a bus. Its voices carry on dry and a later Configure
+// creates the bus afresh.
+func (m *mixer) Release(bus int) {
+	if bus <= 0 {
+		return
+	}
+	m.queue.push(mixCmd{bus: bus, release: true})
+}
+
+// Read implements io.Reader for oto.Player, filling p with interleaved
+// 16-bit stereo frames.
 func (m *mixer) Read(p []byte) (int, error) {
-	samples := len(p) / 2
-	for i := 0; i < samples; i++ {
-		var sum float64
-		m.mu.Lock()
-		for idx := 0; idx < len(m.voices); idx++ {
-			vs := m.voices[idx]
-			if m.pos >= vs.start {
-				val, done := vs.v.Sample()
-				sum += val
-				if done {
-					m.voices = append(m.voices[:idx], m.voices[idx+1:]...)
-					idx--
+	frames := len(p) / (2 * channelCount)
+	if m.master == nil {
+		m.master = newMasterBus(sampleRate)
+	}
+	pos := int(m.pos.Load())
+	m.cmds = m.queue.drain(m.cmds[:0])
+	m.apply(m.cmds, pos)
+	clear(m.cmds)
+	cfg := poly.Load()
+	for i := 0; i < frames; i++ {
+		var sumL, sumR float64
+		for b := range m.sums {
+			m.sums[b] = [2]float64{}
+		}
+		for _, vs := range m.voices {
+			if vs.done || pos < vs.start {
+				continue
+			}
+			if vs.start == pos {
+				m.admit(vs, pos, cfg)
+				if vs.choke != 0 {
+					m.choke(vs, pos)
 				}
 			}
+			l, r, done := sampleStereo(vs.v)
+			if vs.fade > 0 {
+				g := float64(vs.fade) / fadeOutSamples
+				l, r = l*g, r*g
+				vs.fade--
+				done = done || vs.fade == 0
+			}
+			vs.level = math.Max(math.Max(math.Abs(l), math.Abs(r)), vs.level*voiceLevelDecay)
+			if vs.bus > 0 && vs.bus < len(m.buses) && m.buses[vs.bus] != nil {
+				m.sums[vs.bus][0] += l
+				m.sums[vs.bus][1] += r
+			} else {
+				sumL += l
+				sumR += r
+			}
+			vs.done = done
+		}
+		for b, bus := range m.buses {
+			if bus != nil {
+				l, r := bus.Process(m.sums[b][0], m.sums[b][1])
+				sumL += l
+				sumR += r
+			}
 		}
-		m.mu.Unlock()
-		if sum > 1 {
-			sum = 1
-		} else if sum < -1 {
-			sum = -1
+		outL, outR := m.master.Process(sumL, sumR)
+		for c, out := range [channelCount]float64{outL, outR} {
+			v := int16(out * 32767)
+			p[(i*channelCount+c)*2] = byte(v)
+			p[(i*channelCount+c)*2+1] = byte(v >> 8)
 		}
-		v := int16(sum * 32767)
-		p[2*i] = byte(v)
-		p[2*i+1] = byte(v >> 8)
-		m.pos++
+		pos++
+		m.pos.Store(int64(pos))
 	}
+	m.voices = slices.DeleteFunc(m.voices, func(vs *voiceState) bool { return vs.done })
+	m.master.publish()
 	return len(p), nil
 }
@@ -2,19 +2,31 @@
 
 package audio
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// frameAt decodes the i-th stereo frame of mixer output.
+func frameAt(buf []byte, i int) (int16, int16) {
+	o := i * 2 * channelCount
+	return int16(buf[o]) | int16(buf[o+1])<<8, int16(buf[o+2]) | int16(buf[o+3])<<8
+}
+
+func frameCount(buf []byte) int { return len(buf) / (2 * channelCount) }
 
 func TestMixerPlaysSequentialVoices(t *testing.T) {
 	m := &mixer{}
 	m.Schedule(Snare{}.NewVoice(120, sampleRate), 0)
 	m.Schedule(Snare{}.NewVoice(120, sampleRate), sampleRate/4)
-	buf := make([]byte, sampleRate)
+	buf := make([]byte, sampleRate*2)
 	m.Read(buf)
 	first := -1
 	second := -1
-	for i := 0; i < len(buf)/2; i++ {
-		v := int16(buf[2*i]) | int16(buf[2*i+1])<<8
-		if v != 0 {
+	for i := 0; i < frameCount(buf); i++ {
+		if l, _ := frameAt(buf, i); l != 0 {
 			if first == -1 {
 				first = i
 			} else if i > sampleRate/4 && second == -1 {
@@ -27,3 +39,245 @@ func TestMixerPlaysSequentialVoices(t *testing.T) {
 		t.Fatalf("expected two non-zero segments, got first=%d second=%d", first, second)
 	}
 }
+
+func TestMixerRoutesBusThroughEffects(t *testing.T) {
+	m := &mixer{}
+	m.Configure(1, EffectSettings{DelayDiv: 3, DelayMix: 1}, 120) // 1/4 = 0.5s
+	m.ScheduleBus(1, Snare{}.NewVoice(480, sampleRate), 0)
+	buf := make([]byte, sampleRate*2*channelCount)
+	m.Read(buf)
+	echoAt := sampleRate / 2
+	nonZero := false
+	for i := echoAt; i < echoAt+sampleRate/100; i++ {
+		if l, _ := frameAt(buf, i); l != 0 {
+			nonZero = true
+			break
+		}
+	}
+	if !nonZero {
+		t.Fatalf("expected delayed echo at sample %d", echoAt)
+	}
+}
+
+func TestMixerReleaseDropsBusState(t *testing.T) {
+	m := &mixer{}
+	fx := EffectSettings{DelayDiv: 3, DelayMix: 1} // 1/4 = 0.5s
+	m.Configure(1, fx, 120)
+	m.ScheduleBus(1, Snare{}.NewVoice(480, sampleRate), 0)
+	m.Read(make([]byte, sampleRate/4*2))
+	m.Release(1)
+	m.Configure(1, fx, 120) // a new row reusing the bus
+	buf := make([]byte, sampleRate/2*2)
+	m.Read(buf)
+	for i := sampleRate / 8; i < len(buf)/2; i++ { // past the snare itself
+		if int16(buf[2*i])|int16(buf[2*i+1])<<8 != 0 {
+			t.Fatalf("released bus still echoed at sample %d", sampleRate/4+i)
+		}
+	}
+}
+
+func TestMixerLimitsInsteadOfClipping(t *testing.T) {
+	m := &mixer{}
+	for i := 0; i < 8; i++ {
+		m.Schedule(Kick{}.NewVoice(120, sampleRate), 0)
+	}
+	buf := make([]byte, sampleRate/5*2*channelCount)
+	m.Read(buf)
+	for i := 0; i < frameCount(buf); i++ {
+		if v, _ := frameAt(buf, i); v == 32767 || v == -32767 {
+			t.Fatalf("sample %d hit full scale", i)
+		}
+	}
+	if lv := MasterLevels(); lv.Gain >= 1 || lv.Peak == 0 {
+		t.Fatalf("expected limiter engaged and metered, got %+v", lv)
+	}
+}
+
+func TestMixerPansVoices(t *testing.T) {
+	m := &mixer{}
+	m.Schedule(newScaledVoice(Kick{}.NewVoice(120, sampleRate), 1, -1), 0)
+	m.Schedule(newScaledVoice(Snare{}.NewVoice(120, sampleRate), 0.5, 0), sampleRate/10)
+	buf := make([]byte, sampleRate/5*2*channelCount)
+	m.Read(buf)
+	for i := 0; i < sampleRate/10-1; i++ {
+		if _, r := frameAt(buf, i); r != 0 {
+			t.Fatalf("hard-left voice leaked into right channel at frame %d", i)
+		}
+	}
+	right := false
+	for i := sampleRate / 10; i < frameCount(buf); i++ {
+		if _, r := frameAt(buf, i); r != 0 {
+			right = true
+			break
+		}
+	}
+	if !right {
+		t.Fatalf("centred voice missing from right channel")
+	}
+}
+
+func TestMixerPlaysStereoVoices(t *testing.T) {
+	m := &mixer{}
+	buf := make([]float32, 200)
+	for i := 0; i < len(buf); i += 2 {
+		buf[i+1] = 0.5 // right channel only
+	}
+	m.Schedule(&stereoVoice{buf: buf}, 0)
+	out := make([]byte, 200*2*channelCount)
+	m.Read(out)
+	right := false
+	for i := 0; i < frameCount(out); i++ {
+		l, r := frameAt(out, i)
+		if l != 0 {
+			t.Fatalf("left channel not silent at frame %d", i)
+		}
+		right = right || r != 0
+	}
+	if !right {
+		t.Fatalf("right channel silent")
+	}
+}
+
+// constVoice outputs a fixed level for n samples.
+type constVoice struct {
+	level float64
+	n     int
+}
+
+func (c *constVoice) Sample() (float64, bool) {
+	c.n--
+	return c.level, c.n <= 0
+}
+
+func TestMixerChokesVoicesInGroup(t *testing.T) {
+	m := &mixer{}
+	m.ScheduleHit(&constVoice{level: 0.2, n: sampleRate}, 0, Hit{Choke: 1})
+	m.ScheduleHit(&constVoice{level: 0.1, n: sampleRate}, 0, Hit{Choke: 2})
+	m.ScheduleHit(&constVoice{level: 0, n: sampleRate}, 1000, Hit{Choke: 1})
+	buf := make([]byte, sampleRate/10*2*channelCount)
+	m.Read(buf)
+	before, _ := frameAt(buf, 900)
+	if want := int16(9830); before < want-2 || before > want+2 {
+		t.Fatalf("expected both voices before the choke, got %d", before)
+	}
+	after, _ := frameAt(buf, 1000+fadeOutSamples+200)
+	if want := int16(3276); after < want-2 || after > want+2 {
+		t.Fatalf("expected only the other group after the choke, got %d", after)
+	}
+	// the fade must not jump straight to silence; output lags by the
+	// limiter look-ahead
+	lookahead := len(NewLimiter(limiterCeiling, sampleRate).buf)
+	mid, _ := frameAt(buf, 1000+fadeOutSamples/2+lookahead)
+	if mid <= after || mid >= before {
+		t.Fatalf("expected fade between %d and %d, got %d", after, before, mid)
+	}
+	if n := len(m.voices); n != 2 {
+		t.Fatalf("expected choked voice removed, %d voices left", len(m.voices))
+	}
+}
+
+// startVoices schedules one constant voice per level at consecutive samples
+// and renders past their starts.
+func startVoices(m *mixer, inst string, levels ...float64) []*constVoice {
+	var vs []*constVoice
+	for i, l := range levels {
+		v := &constVoice{level: l, n: sampleRate}
+		vs = append(vs, v)
+		m.ScheduleHit(v, i, Hit{Instrument: inst})
+	}
+	m.Read(make([]byte, (len(levels)+fadeOutSamples+1)*2*channelCount))
+	return vs
+}
+
+// playing returns the voices of m still alive after the last Read.
+func playing(m *mixer) map[Voice]bool {
+	alive := map[Voice]bool{}
+	for _, vs := range m.voices {
+		alive[vs.v] = true
+	}
+	return alive
+}
+
+func TestMixerStealsOldestVoice(t *testing.T) {
+	defer SetPolyphony(DefaultPolyphony, StealOldest)
+	SetPolyphony(2, StealOldest)
+	m := &mixer{}
+	vs := startVoices(m, "", 0.1, 0.1, 0.1)
+	alive := playing(m)
+	if alive[vs[0]] || !alive[vs[1]] || !alive[vs[2]] {
+		t.Fatalf("expected the oldest voice stolen, alive=%v", alive)
+	}
+}
+
+func TestMixerStealsQuietestVoice(t *testing.T) {
+	defer SetPolyphony(DefaultPolyphony, StealOldest)
+	SetPolyphony(2, StealQuietest)
+	m := &mixer{}
+	vs := startVoices(m, "", 0.2, 0.05, 0.1)
+	alive := playing(m)
+	if !alive[vs[0]] || alive[vs[1]] || !alive[vs[2]] {
+		t.Fatalf("expected the quietest voice stolen, alive=%v", alive)
+	}
+}
+
+func TestMixerPerInstrumentVoiceLimit(t *testing.T) {
+	defer SetVoiceLimit("hihat", 0)
+	SetVoiceLimit("hihat", 1)
+	m := &mixer{}
+	kick := startVoices(m, "kick", 0.1)
+	hats := startVoices(m, "hihat", 0.1, 0.1)
+	alive := playing(m)
+	if !alive[kick[0]] || alive[hats[0]] || !alive[hats[1]] {
+		t.Fatalf("expected only the older hihat stolen, alive=%v", alive)
+	}
+}
+
+func TestMixerScheduleDoesNotBlockOnRead(t *testing.T) {
+	m := &mixer{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			m.ScheduleHit(&constVoice{level: 0.001, n: 10}, 0, Hit{Instrument: "kick", Bus: i%3 + 1})
+			m.Configure(i%3+1, EffectSettings{}, 120)
+		}
+	}()
+	buf := make([]byte, 64*2*channelCount)
+	for {
+		m.Read(buf)
+		select {
+		case <-done:
+			m.Read(buf)
+			m.Read(buf)
+			if len(m.voices) != 0 {
+				t.Fatalf("expected all short voices finished, %d left", len(m.voices))
+			}
+			return
+		default:
+		}
+	}
+}
+
+func TestFileBackendRecordsPlayback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.wav")
+	Reset()
+	SetBackend(NewFileBackend(path))
+	t.Cleanup(func() { Reset(); SetBackend(nil) })
+	Play("kick")
+	time.Sleep(100 * time.Millisecond)
+	Reset()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) <= wavHeaderSize {
+		t.Fatalf("capture has no audio: %d bytes", len(data))
+	}
+	loud := false
+	for _, b := range data[wavHeaderSize:] {
+		loud = loud || b != 0
+	}
+	if !loud {
+		t.Fatal("captured kick is silent")
+	}
+}
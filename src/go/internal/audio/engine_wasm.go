@@ -3,19 +3,37 @@
 package audio
 
 import (
+	"math"
 	"sync"
 	"syscall/js"
+	"unsafe"
 )
 
+const sampleRate = 44100
+
 type Voice interface{}
 
 type Instrument interface{}
 
 var (
 	instruments   = []string{"snare", "kick", "hihat", "tom", "clap"}
+	builtins      = defaultBuiltins()
 	instrumentsMu sync.RWMutex
+	bpm                   = 120
+	backend       Backend = webAudioBackend{}
 )
 
+// defaultBuiltins maps the stock instrument IDs to the drum they synthesise.
+func defaultBuiltins() map[string]string {
+	return map[string]string{
+		"snare": drumSnare,
+		"kick":  drumKick,
+		"hihat": drumHiHat,
+		"tom":   drumTom,
+		"clap":  drumClap,
+	}
+}
+
 func Register(id string, inst Instrument) {
 	instrumentsMu.Lock()
 	instruments = append(instruments, id)
@@ -23,30 +41,178 @@ func Register(id string, inst Instrument) {
 }
 
 func Play(id string, when ...float64) {
-	js.Global().Call("playSound", id)
+	PlayVol(id, 1, when...)
 }
 
-// PlayVol plays an instrument at the given volume. The current
-// WebAudio bridge does not support volume, so the parameter is
-// ignored for now.
+// PlayVol plays an instrument at the given volume (0..1) and optional
+// start time, as returned by Now.
 func PlayVol(id string, vol float64, when ...float64) {
-	js.Global().Call("playSound", id)
+	h := Hit{Instrument: id, Volume: vol}
+	if len(when) > 0 {
+		h.When = when[0]
+	}
+	Trigger(h)
+}
+
+// Trigger plays a hit. Built-in drums are synthesised in Go and handed to
+// the page as a PCM buffer; uploaded samples, stereo included, are played by
+// JavaScript. Either way the page applies h.Volume with a GainNode, starts
+// the source at h.When on the AudioContext clock, pans it with a
+// StereoPannerNode, chokes earlier sources of its group as it starts, and
+// routes it through its row's effects bus and the master bus.
+func Trigger(h Hit) {
+	if _, ok := backend.(webAudioBackend); !ok {
+		return
+	}
+	instrumentsMu.RLock()
+	kind, ok := builtins[h.Instrument]
+	instrumentsMu.RUnlock()
+	masterOnce.Do(configureMaster)
+	configureBus(h.Bus, h.FX)
+	if !ok {
+		js.Global().Call("playSound", h.Instrument, h.Bus, h.Pan, h.Choke, h.Volume, h.When)
+		return
+	}
+	buf := renderDrum(kind, h.Params, bpm, sampleRate)
+	if len(buf) == 0 {
+		return
+	}
+	js.Global().Call("playBuffer", float32Array(buf), sampleRate, h.Bus, h.Pan, h.Choke, h.Volume, h.When)
+}
+
+var masterOnce sync.Once
+
+// configureMaster sets up the page's master bus to limit, clip and meter
+// like masterBus, and has SetMasterGain and MasterLevels go through it.
+func configureMaster() {
+	js.Global().Call("configureMaster", map[string]any{
+		"gain":     MasterGain(),
+		"ceiling":  limiterCeiling,
+		"attack":   limiterLookahead,
+		"release":  limiterRelease,
+		"knee":     softClipKnee,
+		"rms":      meterRMSWindow,
+		"peakFall": meterPeakFall,
+	})
+	forwardMasterGain = func(g float64) { js.Global().Call("setMasterGain", g) }
+	pageLevels = func() Levels {
+		v := js.Global().Call("masterLevels")
+		return Levels{Peak: v.Get("peak").Float(), RMS: v.Get("rms").Float(), Gain: v.Get("gain").Float()}
+	}
+}
+
+// busConfig is what a browser effects bus was last set to.
+type busConfig struct {
+	fx  EffectSettings
+	bpm int
+}
+
+var (
+	busMu sync.Mutex
+	buses = map[int]busConfig{}
+)
+
+// webFilterTypes are the BiquadFilterNode types for each FilterType.
+var webFilterTypes = map[FilterType]string{
+	FilterLowPass:  "lowpass",
+	FilterHighPass: "highpass",
+	FilterBandPass: "bandpass",
+}
+
+// configureBus builds or updates the WebAudio chain of an effects bus to
+// match s, the way fxBus runs it natively. Bus 0 is dry.
+func configureBus(bus int, s EffectSettings) {
+	if bus <= 0 {
+		return
+	}
+	c := busConfig{fx: s, bpm: bpm}
+	busMu.Lock()
+	old, ok := buses[bus]
+	buses[bus] = c
+	busMu.Unlock()
+	if ok && old == c {
+		return
+	}
+	q := s.q()
+	if s.Filter == FilterLowPass || s.Filter == FilterHighPass {
+		q = 20 * math.Log10(q) // WebAudio takes these in dB
+	}
+	js.Global().Call("configureBus", bus, map[string]any{
+		"drive":         s.Drive,
+		"filter":        webFilterTypes[s.Filter],
+		"cutoff":        s.cutoffHz(),
+		"q":             q,
+		"delay":         s.delaySeconds(bpm),
+		"feedback":      math.Max(0, math.Min(s.DelayFeedback, 0.95)),
+		"delayMix":      s.DelayMix,
+		"reverbMix":     s.ReverbMix,
+		"reverbSeconds": reverbSeconds(s.ReverbSize),
+	})
+}
+
+// float32Array copies buf into a new JavaScript Float32Array.
+func float32Array(buf []float32) js.Value {
+	raw := unsafe.Slice((*byte)(unsafe.Pointer(&buf[0])), len(buf)*4)
+	u8 := js.Global().Get("Uint8Array").New(len(raw))
+	js.CopyBytesToJS(u8, raw)
+	return js.Global().Get("Float32Array").New(u8.Get("buffer"))
+}
+
+// ReleaseBus tears down an effects bus, as when the drum row using it is
+// deleted. The next hit routed to the bus builds it again.
+func ReleaseBus(bus int) {
+	busMu.Lock()
+	_, ok := buses[bus]
+	delete(buses, bus)
+	busMu.Unlock()
+	if ok {
+		js.Global().Call("releaseBus", bus)
+	}
+}
+
+// Parametric reports whether id is a built-in drum that accepts DrumParams.
+func Parametric(id string) bool {
+	instrumentsMu.RLock()
+	_, ok := builtins[id]
+	instrumentsMu.RUnlock()
+	return ok
 }
 
 // ResetInstruments restores the default instrument ID list.
 func ResetInstruments() {
 	instrumentsMu.Lock()
 	instruments = []string{"snare", "kick", "hihat", "tom", "clap"}
+	builtins = defaultBuiltins()
 	instrumentsMu.Unlock()
 }
 
-func Now() float64 { return 0 }
+// SetBackend selects where hits are sent. Only the WebAudio backend makes
+// sound in the browser; any other backend, such as null, mutes playback.
+// File capture needs the Go mixer and is desktop only.
+func SetBackend(b Backend) {
+	if b == nil {
+		b = webAudioBackend{}
+	}
+	backend = b
+}
+
+// Now returns the page's AudioContext clock in seconds, the time base of
+// Hit.When in the browser. It is 0 until audio.js has loaded.
+func Now() float64 {
+	if f := js.Global().Get("audioNow"); f.Type() == js.TypeFunction {
+		return f.Invoke().Float()
+	}
+	return 0
+}
 
 func Reset() {}
 
-func Resume() {}
+// Resume resumes the AudioContext, which browsers start suspended until a
+// user gesture.
+func Resume() { _ = backend.Resume() }
 
-func SetBPM(b int) {}
+// SetBPM updates the tempo used to size synthesised hits.
+func SetBPM(b int) { bpm = b }
 
 func Instruments() []string {
 	instrumentsMu.RLock()
@@ -64,5 +230,9 @@ func RenameInstrument(oldID, newID string) {
 			break
 		}
 	}
+	if kind, ok := builtins[oldID]; ok {
+		delete(builtins, oldID)
+		builtins[newID] = kind
+	}
 	instrumentsMu.Unlock()
 }
@@ -0,0 +1,53 @@
+//go:build !test
+
+package audio_test
+
+import (
+	"flag"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ingyamilmolinar/tunkul/core/beat"
+	"github.com/ingyamilmolinar/tunkul/internal/audio"
+	"github.com/ingyamilmolinar/tunkul/internal/audio/audiotest"
+)
+
+// update rewrites golden files instead of comparing against them:
+//
+//	go test ./internal/audio/... -update
+var update = flag.Bool("update", false, "rewrite golden audio files")
+
+// goldenPattern is one bar at 240 BPM: one instrument per beat.
+var goldenPattern = []string{"kick", "hihat", "snare", "hihat"}
+
+// sequence drives a real scheduler through one bar on a fake clock polled
+// every millisecond, recording the hit of each step.
+func sequence(bpm int, pattern []string) []audio.Hit {
+	base := time.Unix(0, 0)
+	now := base
+	rec := &audiotest.Recorder{Now: func() float64 { return now.Sub(base).Seconds() }}
+	s := beat.NewScheduler()
+	s.SetBPM(bpm)
+	s.SetBeatLength(len(pattern))
+	s.SetNowFunc(func() time.Time { return now })
+	s.OnTick = func(step int) { rec.Trigger(audio.Hit{Instrument: pattern[step], Volume: 0.8}) }
+	s.Start()
+	bar := time.Duration(len(pattern)) * time.Minute / time.Duration(bpm)
+	for ; now.Sub(base) < bar; now = now.Add(time.Millisecond) {
+		s.Tick()
+	}
+	return rec.Hits
+}
+
+func TestGoldenBeatRender(t *testing.T) {
+	const bpm = 240
+	hits := sequence(bpm, goldenPattern)
+	out := audio.Render(hits, audio.SampleRate) // one bar
+	var want []int
+	for step := range goldenPattern {
+		want = append(want, step*audio.SampleRate*60/bpm+audio.OutputLatency())
+	}
+	audiotest.AssertOnsets(t, audiotest.Onsets(out, audio.SampleRate, 2), want, audio.SampleRate/1000)
+	audiotest.CompareGolden(t, filepath.Join("testdata", "golden", "beat.wav"), out, audio.SampleRate, 2, 1e-3, *update)
+}
@@ -10,12 +10,11 @@ import (
 func TestVoiceStartsWithin50ms(t *testing.T) {
 	m := &mixer{}
 	m.Schedule(Snare{}.NewVoice(120, sampleRate), 0)
-	buf := make([]byte, sampleRate/10*2) // 0.1s of 16-bit mono
+	buf := make([]byte, sampleRate/10*2*channelCount) // 0.1s of 16-bit stereo
 	m.Read(buf)
 	first := -1
-	for i := 0; i < len(buf)/2; i++ {
-		v := int16(buf[2*i]) | int16(buf[2*i+1])<<8
-		if v != 0 {
+	for i := 0; i < frameCount(buf); i++ {
+		if l, _ := frameAt(buf, i); l != 0 {
 			first = i
 			break
 		}
@@ -0,0 +1,197 @@
+package audio
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+const (
+	limiterLookahead = 0.0015 // seconds the limiter sees ahead of its output
+	limiterRelease   = 0.15   // seconds to recover 63% of gain reduction
+	limiterCeiling   = 0.95   // linear peak the limiter holds the signal under
+	softClipKnee     = 0.97   // level above which the final soft clip bends, above the ceiling
+	meterRMSWindow   = 0.3    // seconds of the RMS averaging window
+	meterPeakFall    = 1.5    // seconds for the peak reading to fall by 63%
+)
+
+// Limiter is a stereo-linked look-ahead peak limiter. The input is delayed by
+// the look-ahead window and the gain is ramped down across that window, so
+// it reaches the level a peak needs just as the peak is output, avoiding both
+// clamping and sudden gain steps. Both channels share one gain so limiting
+// never shifts the stereo image.
+type Limiter struct {
+	Ceiling float64
+
+	buf     [][2]float64
+	pos     int
+	env     []float64 // held gain for the last len(buf)+1 frames
+	envPos  int
+	hold    float64 // gain needed by the loudest frame in the window, released slowly
+	gain    float64
+	release float64
+}
+
+// NewLimiter returns a limiter holding peaks under ceiling.
+func NewLimiter(ceiling float64, sampleRate int) *Limiter {
+	n := limiterDelay(sampleRate)
+	env := make([]float64, n+1)
+	for i := range env {
+		env[i] = 1
+	}
+	return &Limiter{
+		Ceiling: ceiling,
+		buf:     make([][2]float64, n),
+		env:     env,
+		hold:    1,
+		gain:    1,
+		release: 1 - math.Exp(-1/(limiterRelease*float64(sampleRate))),
+	}
+}
+
+// limiterDelay returns the number of frames the look-ahead delays the output.
+func limiterDelay(sampleRate int) int { return int(limiterLookahead*float64(sampleRate)) + 1 }
+
+// Process limits a mono signal.
+func (l *Limiter) Process(x float64) float64 {
+	y, _ := l.ProcessStereo(x, x)
+	return y
+}
+
+// ProcessStereo limits one stereo frame. The gain needed by the loudest frame
+// between the input and the output is held, released exponentially and then
+// averaged over as many frames as the window holds. Every value averaged
+// covers the frame being output, so the average never exceeds the gain that
+// frame needs, while a new peak pulls the gain down in a linear ramp.
+func (l *Limiter) ProcessStereo(left, right float64) (float64, float64) {
+	out := l.buf[l.pos]
+	l.buf[l.pos] = [2]float64{left, right}
+	l.pos = (l.pos + 1) % len(l.buf)
+	peak := math.Max(math.Abs(out[0]), math.Abs(out[1]))
+	for _, v := range l.buf {
+		peak = math.Max(peak, math.Max(math.Abs(v[0]), math.Abs(v[1])))
+	}
+	target := 1.0
+	if peak > l.Ceiling {
+		target = l.Ceiling / peak
+	}
+	if target < l.hold {
+		l.hold = target
+	} else {
+		l.hold += (target - l.hold) * l.release
+	}
+	l.env[l.envPos] = l.hold
+	l.envPos = (l.envPos + 1) % len(l.env)
+	sum := 0.0
+	for _, g := range l.env {
+		sum += g
+	}
+	l.gain = math.Min(sum/float64(len(l.env)), 1)
+	return out[0] * l.gain, out[1] * l.gain
+}
+
+// Gain returns the gain currently applied by the limiter, 1 meaning none.
+func (l *Limiter) Gain() float64 { return l.gain }
+
+// softClip passes signals under the knee untouched and bends anything above
+// it smoothly towards ±1.
+func softClip(x float64) float64 {
+	a := math.Abs(x)
+	if a <= softClipKnee {
+		return x
+	}
+	y := softClipKnee + (1-softClipKnee)*math.Tanh((a-softClipKnee)/(1-softClipKnee))
+	return math.Copysign(y, x)
+}
+
+// Levels is a snapshot of the master bus meter. Values are linear amplitudes.
+type Levels struct {
+	Peak float64 // decaying peak of the output
+	RMS  float64 // RMS of the output over a short window
+	Gain float64 // limiter gain, 1 when not limiting
+}
+
+var (
+	masterGain   atomic.Uint64 // float64 bits
+	masterPeak   atomic.Uint64
+	masterRMS    atomic.Uint64
+	masterLimitG atomic.Uint64
+)
+
+// In the browser the page runs the master bus, and these forward to it once
+// it is set up.
+var (
+	forwardMasterGain func(g float64)
+	pageLevels        func() Levels
+)
+
+func init() {
+	masterGain.Store(math.Float64bits(1))
+	masterLimitG.Store(math.Float64bits(1))
+}
+
+// SetMasterGain sets the linear gain applied before the master limiter.
+func SetMasterGain(g float64) {
+	if g < 0 {
+		g = 0
+	}
+	masterGain.Store(math.Float64bits(g))
+	if forwardMasterGain != nil {
+		forwardMasterGain(g)
+	}
+}
+
+// MasterGain returns the linear gain applied before the master limiter.
+func MasterGain() float64 { return math.Float64frombits(masterGain.Load()) }
+
+// MasterLevels returns the most recent master bus meter readings. It is safe
+// to call from any goroutine.
+func MasterLevels() Levels {
+	if pageLevels != nil {
+		return pageLevels()
+	}
+	return Levels{
+		Peak: math.Float64frombits(masterPeak.Load()),
+		RMS:  math.Float64frombits(masterRMS.Load()),
+		Gain: math.Float64frombits(masterLimitG.Load()),
+	}
+}
+
+// masterBus applies gain, limiting and a final soft clip to the mix and
+// meters the result.
+type masterBus struct {
+	gain     float64 // smoothed towards MasterGain to avoid zipper noise
+	lim      *Limiter
+	smooth   float64
+	peak     float64
+	peakFall float64
+	meanSq   float64
+	rmsCoef  float64
+}
+
+func newMasterBus(sampleRate int) *masterBus {
+	sr := float64(sampleRate)
+	return &masterBus{
+		gain:     MasterGain(),
+		lim:      NewLimiter(limiterCeiling, sampleRate),
+		smooth:   1 - math.Exp(-1/(0.01*sr)),
+		peakFall: math.Exp(-1 / (meterPeakFall * sr)),
+		rmsCoef:  1 - math.Exp(-1/(meterRMSWindow*sr)),
+	}
+}
+
+// Process runs one stereo frame through the master bus.
+func (m *masterBus) Process(left, right float64) (float64, float64) {
+	m.gain += (MasterGain() - m.gain) * m.smooth
+	l, r := m.lim.ProcessStereo(left*m.gain, right*m.gain)
+	l, r = softClip(l), softClip(r)
+	m.peak = math.Max(math.Max(math.Abs(l), math.Abs(r)), m.peak*m.peakFall)
+	m.meanSq += ((l*l+r*r)/2 - m.meanSq) * m.rmsCoef
+	return l, r
+}
+
+// publish makes the current meter readings visible to MasterLevels.
+func (m *masterBus) publish() {
+	masterPeak.Store(math.Float64bits(m.peak))
+	masterRMS.Store(math.Float64bits(math.Sqrt(m.meanSq)))
+	masterLimitG.Store(math.Float64bits(m.lim.Gain()))
+}
@@ -0,0 +1,107 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLimiterHoldsPeaksUnderCeiling(t *testing.T) {
+	l := NewLimiter(0.9, 44100)
+	maxOut := 0.0
+	for i := 0; i < 44100; i++ {
+		x := 3 * math.Sin(2*math.Pi*100*float64(i)/44100)
+		maxOut = math.Max(maxOut, math.Abs(l.Process(x)))
+	}
+	if maxOut > 0.9+1e-9 {
+		t.Fatalf("limiter let through %f", maxOut)
+	}
+	if maxOut < 0.8 {
+		t.Fatalf("limiter over-attenuated to %f", maxOut)
+	}
+}
+
+func TestLimiterRampsIntoPeaks(t *testing.T) {
+	l := NewLimiter(0.9, 44100)
+	n := len(l.buf)
+	maxStep := (1 - 0.9/2) / float64(n+1)
+	prev := 1.0
+	for i := 0; i < 2000; i++ {
+		x := 0.5
+		if i >= 1000 {
+			x = 2
+		}
+		y := l.Process(x)
+		if math.Abs(y) > 0.9+1e-9 {
+			t.Fatalf("sample %d: limiter let through %f", i, y)
+		}
+		if step := prev - l.Gain(); step > maxStep+1e-12 {
+			t.Fatalf("sample %d: gain fell by %f at once, want at most %f", i, step, maxStep)
+		}
+		prev = l.Gain()
+	}
+	if g := l.Gain(); math.Abs(g-0.45) > 1e-9 {
+		t.Fatalf("gain settled at %f, want 0.45", g)
+	}
+}
+
+func TestLimiterPassesQuietSignal(t *testing.T) {
+	l := NewLimiter(0.9, 44100)
+	n := len(l.buf)
+	in := make([]float64, 1000)
+	for i := range in {
+		in[i] = 0.5 * math.Sin(float64(i)/10)
+	}
+	for i, x := range in {
+		y := l.Process(x)
+		if i >= n && math.Abs(y-in[i-n]) > 1e-12 {
+			t.Fatalf("sample %d altered: %f vs %f", i, y, in[i-n])
+		}
+	}
+}
+
+func TestSoftClipBounded(t *testing.T) {
+	for _, x := range []float64{0.5, 0.95, 2, 100, -100} {
+		y := softClip(x)
+		if math.Abs(y) > 1 {
+			t.Fatalf("softClip(%f)=%f exceeds 1", x, y)
+		}
+		if math.Abs(x) <= softClipKnee && y != x {
+			t.Fatalf("softClip altered %f", x)
+		}
+	}
+	if softClipKnee < limiterCeiling {
+		t.Fatalf("knee %f is under the limiter ceiling %f", softClipKnee, limiterCeiling)
+	}
+}
+
+func TestMasterBusMetersAndGain(t *testing.T) {
+	defer SetMasterGain(1)
+	SetMasterGain(0.5)
+	m := newMasterBus(44100)
+	for i := 0; i < 44100; i++ {
+		x := 0.8 * math.Sin(2*math.Pi*440*float64(i)/44100)
+		m.Process(x, x)
+	}
+	m.publish()
+	lv := MasterLevels()
+	if lv.Peak < 0.39 || lv.Peak > 0.41 {
+		t.Fatalf("expected peak ~0.4 got %f", lv.Peak)
+	}
+	if want := 0.4 / math.Sqrt2; math.Abs(lv.RMS-want) > 0.02 {
+		t.Fatalf("expected rms ~%f got %f", want, lv.RMS)
+	}
+	if lv.Gain != 1 {
+		t.Fatalf("expected no limiting got gain %f", lv.Gain)
+	}
+}
+
+func TestLimiterIsStereoLinked(t *testing.T) {
+	l := NewLimiter(0.5, 44100)
+	var left, right float64
+	for i := 0; i < 1000; i++ {
+		left, right = l.ProcessStereo(1, 0.25)
+	}
+	if math.Abs(left-0.5) > 1e-9 || math.Abs(right-0.125) > 1e-9 {
+		t.Fatalf("expected shared gain, got %f,%f", left, right)
+	}
+}
@@ -0,0 +1,89 @@
+package audio
+
+import "math"
+
+// DrumParams holds the synthesis controls of a built-in drum. Each field is a
+// bipolar offset in [-1,1] from the stock sound, so the zero value renders the
+// default kit.
+type DrumParams struct {
+	Pitch float64 // tuning, ±1 octave
+	Decay float64 // hit length, ½x..2x
+	Tone  float64 // brightness or pitch-sweep depth depending on the drum
+	Noise float64 // amount of noise in the mix
+	Snap  float64 // sharpness of the transient
+}
+
+// ParamNames lists the DrumParams fields in knob order.
+var ParamNames = []string{"Pitch", "Decay", "Tone", "Noise", "Snap"}
+
+// Get returns the parameter at index i of ParamNames.
+func (p DrumParams) Get(i int) float64 {
+	switch i {
+	case 0:
+		return p.Pitch
+	case 1:
+		return p.Decay
+	case 2:
+		return p.Tone
+	case 3:
+		return p.Noise
+	case 4:
+		return p.Snap
+	}
+	return 0
+}
+
+// Set returns a copy of p with the parameter at index i of ParamNames set to v
+// clamped to [-1,1].
+func (p DrumParams) Set(i int, v float64) DrumParams {
+	if v < -1 {
+		v = -1
+	} else if v > 1 {
+		v = 1
+	}
+	switch i {
+	case 0:
+		p.Pitch = v
+	case 1:
+		p.Decay = v
+	case 2:
+		p.Tone = v
+	case 3:
+		p.Noise = v
+	case 4:
+		p.Snap = v
+	}
+	return p
+}
+
+// Hit describes a single trigger of an instrument.
+type Hit struct {
+	Instrument string
+	Volume     float64    // linear gain 0..1
+	Params     DrumParams // ignored by sample-based instruments
+	Pan        float64    // stereo position, -1 hard left to 1 hard right
+	When       float64    // start time on the Now clock; past times play immediately
+
+	// Bus routes the hit through an effects chain shared with other hits on
+	// the same bus, typically one bus per drum row. Bus 0 bypasses effects.
+	Bus int
+	FX  EffectSettings // chain settings applied to Bus when the hit is scheduled
+
+	// Choke is the hit's choke group. A hit in a non-zero group cuts off
+	// sounding voices of the same group when it starts.
+	Choke int
+}
+
+// ChokeGroups is the number of selectable choke groups; group 0 means none.
+const ChokeGroups = 4
+
+// panGains returns the left and right gains for pan in [-1,1]. It is a
+// balance law: the near channel stays at unity while the far one falls along
+// √2 times a sine/cosine taper to silence at the extreme. The centre matches
+// an unpanned hit, so panning never boosts a channel, but total power
+// (L²+R²) drops from 2 at the centre to 1 fully panned.
+func panGains(pan float64) (float64, float64) {
+	pan = math.Max(-1, math.Min(1, pan))
+	theta := (pan + 1) * math.Pi / 4
+	return math.Min(1, math.Sqrt2*math.Cos(theta)), math.Min(1, math.Sqrt2*math.Sin(theta))
+}
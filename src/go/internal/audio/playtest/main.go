@@ -4,7 +4,6 @@ package main
 
 import (
 	"syscall/js"
-	"time"
 
 	"github.com/ingyamilmolinar/tunkul/internal/audio"
 )
@@ -18,10 +17,9 @@ func main() {
 		js.Global().Call("setTimeout", js.FuncOf(func(js.Value, []js.Value) any {
 			js.Global().Set("__playTime", perf.Call("now"))
 			audio.Play("snare")
-			go func() {
-				time.Sleep(250 * time.Millisecond)
-				audio.Play("kick")
-			}()
+			// Schedule the kick on the AudioContext clock rather than
+			// sleeping, exercising the bridge's start time.
+			audio.PlayVol("kick", 1, audio.Now()+0.25)
 			return nil
 		}), 0)
 		return nil
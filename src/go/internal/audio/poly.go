@@ -0,0 +1,118 @@
+package audio
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultPolyphony is the number of voices that may sound at once before the
+// mixer starts stealing.
+const DefaultPolyphony = 64
+
+// StealPolicy chooses which sounding voice is cut off when a new voice would
+// exceed a polyphony limit.
+type StealPolicy int
+
+const (
+	StealOldest StealPolicy = iota
+	StealQuietest
+)
+
+// polyConfig is an immutable snapshot of the voice limits. Setters publish a
+// fresh copy so the audio callback can read it without locking.
+type polyConfig struct {
+	max    int
+	policy StealPolicy
+	limits map[string]int // per-instrument caps; missing or 0 means unlimited
+}
+
+var (
+	poly   atomic.Pointer[polyConfig]
+	polyMu sync.Mutex // serialises writers only
+)
+
+func init() {
+	poly.Store(&polyConfig{max: DefaultPolyphony, policy: StealOldest})
+}
+
+// SetPolyphony sets the maximum number of simultaneously sounding voices and
+// the policy used to pick a voice to steal. max <= 0 disables the limit.
+// Limits are enforced by the desktop mixer; the browser ignores them.
+func SetPolyphony(max int, policy StealPolicy) {
+	polyMu.Lock()
+	c := *poly.Load()
+	c.max, c.policy = max, policy
+	poly.Store(&c)
+	polyMu.Unlock()
+}
+
+// Polyphony returns the current voice limit and steal policy.
+func Polyphony() (int, StealPolicy) {
+	c := poly.Load()
+	return c.max, c.policy
+}
+
+// SetVoiceLimit caps how many voices of instrument id may sound at once.
+// Further hits steal from that instrument's own voices. n <= 0 removes the
+// cap.
+func SetVoiceLimit(id string, n int) {
+	polyMu.Lock()
+	c := *poly.Load()
+	c.limits = maps.Clone(c.limits)
+	if c.limits == nil {
+		c.limits = map[string]int{}
+	}
+	if n > 0 {
+		c.limits[id] = n
+	} else {
+		delete(c.limits, id)
+	}
+	poly.Store(&c)
+	polyMu.Unlock()
+}
+
+// VoiceLimit returns the voice cap of instrument id, 0 if unlimited.
+func VoiceLimit(id string) int { return poly.Load().limits[id] }
+
+// renameVoiceLimit moves the cap of oldID to newID.
+func renameVoiceLimit(oldID, newID string) {
+	if n := VoiceLimit(oldID); n > 0 {
+		SetVoiceLimit(oldID, 0)
+		SetVoiceLimit(newID, n)
+	}
+}
+
+// mpsc is a lock-free multi-producer single-consumer queue. Producers push
+// with a compare-and-swap on the head; the consumer takes the whole list in
+// one swap, so neither side ever blocks the other.
+type mpsc[T any] struct {
+	head atomic.Pointer[mpscNode[T]]
+}
+
+type mpscNode[T any] struct {
+	v    T
+	next *mpscNode[T]
+}
+
+func (q *mpsc[T]) push(v T) {
+	n := &mpscNode[T]{v: v}
+	for {
+		h := q.head.Load()
+		n.next = h
+		if q.head.CompareAndSwap(h, n) {
+			return
+		}
+	}
+}
+
+// drain appends every queued value to dst in push order.
+func (q *mpsc[T]) drain(dst []T) []T {
+	start := len(dst)
+	for n := q.head.Swap(nil); n != nil; n = n.next {
+		dst = append(dst, n.v)
+	}
+	slices.Reverse(dst[start:])
+	return dst
+}
@@ -0,0 +1,86 @@
+package audio
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMPSCDrainsInPushOrder(t *testing.T) {
+	var q mpsc[int]
+	for i := 0; i < 5; i++ {
+		q.push(i)
+	}
+	got := q.drain([]int{-1})
+	want := []int{-1, 0, 1, 2, 3, 4}
+	if len(got) != len(want) {
+		t.Fatalf("got %v want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v want %v", got, want)
+		}
+	}
+	if len(q.drain(nil)) != 0 {
+		t.Fatalf("queue not empty after drain")
+	}
+}
+
+func TestMPSCConcurrentProducers(t *testing.T) {
+	var q mpsc[int]
+	var wg sync.WaitGroup
+	const producers, each = 8, 1000
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < each; i++ {
+				q.push(p*each + i)
+			}
+		}(p)
+	}
+	var got []int
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		got = q.drain(got)
+	}
+	if len(got) != producers*each {
+		t.Fatalf("expected %d values got %d", producers*each, len(got))
+	}
+	last := make([]int, producers)
+	for i := range last {
+		last[i] = -1
+	}
+	for _, v := range got {
+		p := v / each
+		if v <= last[p] {
+			t.Fatalf("producer %d values out of order", p)
+		}
+		last[p] = v
+	}
+}
+
+func TestVoiceLimitsAreCopiedOnWrite(t *testing.T) {
+	defer SetVoiceLimit("hihat", 0)
+	before := poly.Load()
+	SetVoiceLimit("hihat", 2)
+	if VoiceLimit("hihat") != 2 {
+		t.Fatalf("expected hihat limit 2 got %d", VoiceLimit("hihat"))
+	}
+	if before.limits["hihat"] != 0 {
+		t.Fatalf("earlier snapshot was mutated")
+	}
+	renameVoiceLimit("hihat", "openhat")
+	defer SetVoiceLimit("openhat", 0)
+	if VoiceLimit("hihat") != 0 || VoiceLimit("openhat") != 2 {
+		t.Fatalf("rename did not move the limit")
+	}
+}
@@ -8,28 +8,55 @@ import (
 	"strings"
 )
 
-// Sample represents a preloaded PCM buffer.
-type Sample struct{ data []float32 }
+// Sample represents a preloaded PCM buffer. Stereo samples hold interleaved
+// left/right frames.
+type Sample struct {
+	data     []float32
+	channels int
+}
 
 // NewVoice returns a voice that plays the sample once.
 func (s Sample) NewVoice(bpm, sampleRate int) Voice {
+	if s.channels == 2 {
+		return &stereoVoice{buf: s.data}
+	}
 	return &cVoice{buf: s.data}
 }
 
+// stereoVoice plays an interleaved two-channel buffer.
+type stereoVoice struct {
+	buf []float32
+	i   int
+}
+
+func (v *stereoVoice) SampleStereo() (float64, float64, bool) {
+	if v.i+1 >= len(v.buf) {
+		return 0, 0, true
+	}
+	l, r := float64(v.buf[v.i]), float64(v.buf[v.i+1])
+	v.i += 2
+	return l, r, false
+}
+
+func (v *stereoVoice) Sample() (float64, bool) {
+	l, r, done := v.SampleStereo()
+	return (l + r) / 2, done
+}
+
 // RegisterWAV decodes a .wav file and registers it as an instrument.
 func RegisterWAV(id, path string) error {
 	if path == "" {
-		Register(id, Sample{data: make([]float32, sampleRate/10)})
+		Register(id, Sample{data: make([]float32, sampleRate/10), channels: 1})
 		return nil
 	}
-	buf, sr, err := loadWav(path)
+	buf, sr, ch, err := loadWav(path)
 	if err != nil {
 		return fmt.Errorf("load wav %s: %w", path, err)
 	}
 	if sr != sampleRate {
 		return fmt.Errorf("expected %dHz wav, got %d", sampleRate, sr)
 	}
-	Register(id, Sample{data: buf})
+	Register(id, Sample{data: buf, channels: ch})
 	return nil
 }
 
@@ -2,17 +2,13 @@
 
 package audio
 
-import "time"
+// Snare renders filtered white noise layered over a short tone.
+type Snare struct{ DrumParams }
 
-// Snare renders white noise shaped by Miniaudio.
-type Snare struct{}
-
-// NewVoice generates a snare hit via the C renderer.
-func (Snare) NewVoice(bpm, sampleRate int) Voice {
-	spb := 60 / float64(bpm)
-	dur := time.Duration(spb * 0.25 * float64(time.Second))
-	samples := int(float64(sampleRate) * dur.Seconds())
-	buf := make([]float32, samples)
-	renderSnare(buf, sampleRate, samples)
-	return &cVoice{buf: buf}
+// NewVoice synthesises a snare hit shaped by the instrument's parameters.
+func (d Snare) NewVoice(bpm, sampleRate int) Voice {
+	return &cVoice{buf: renderDrum(drumSnare, d.DrumParams, bpm, sampleRate)}
 }
+
+// WithParams returns a snare using p.
+func (Snare) WithParams(p DrumParams) Instrument { return Snare{p} }
@@ -2,6 +2,8 @@
 
 package audio
 
+import "fmt"
+
 type Voice interface{}
 
 type Instrument interface{ NewVoice(int, int) Voice }
@@ -20,12 +22,48 @@ func Play(id string, when ...float64) {}
 // PlayVol is a stub used during tests for volume-controlled playback.
 func PlayVol(id string, vol float64, when ...float64) {}
 
+// Trigger is a stub used during tests for parameterised playback.
+func Trigger(h Hit) {}
+
+// ReleaseBus is a no-op in tests.
+func ReleaseBus(bus int) {}
+
+// Parametric reports whether id names one of the built-in drums.
+func Parametric(id string) bool {
+	switch id {
+	case "snare", "kick", "hihat", "tom", "clap":
+		return true
+	}
+	return false
+}
+
+// SampleRate is the rate of Render's output.
+const SampleRate = 44100
+
+// Render returns silence in tests; the mixer is not compiled with the test tag.
+func Render(hits []Hit, frames int) []float32 { return make([]float32, frames*2) }
+
+// OutputLatency is 0 in tests.
+func OutputLatency() int { return 0 }
+
 // Now returns 0 during tests.
 func Now() float64 { return 0 }
 
 // Resume is a no-op in tests.
 func Resume() {}
 
+// SetBackend is a no-op in tests; no audio is ever produced.
+func SetBackend(b Backend) {}
+
+// platformBackend returns a null backend in tests so no device is opened.
+func platformBackend(spec string) (Backend, error) {
+	switch spec {
+	case "", "oto", "webaudio":
+		return NewNullBackend(), nil
+	}
+	return nil, fmt.Errorf("unknown audio backend %q", spec)
+}
+
 // Reset is a stub used during tests.
 func Reset() {}
 
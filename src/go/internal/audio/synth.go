@@ -0,0 +1,170 @@
+package audio
+
+import "math"
+
+// Drum kinds understood by renderDrum.
+const (
+	drumSnare = "snare"
+	drumKick  = "kick"
+	drumHiHat = "hihat"
+	drumTom   = "tom"
+	drumClap  = "clap"
+)
+
+// drumBeats is the stock length of each drum expressed in beats.
+var drumBeats = map[string]float64{
+	drumSnare: 0.25,
+	drumKick:  0.5,
+	drumHiHat: 0.125,
+	drumTom:   0.5,
+	drumClap:  0.25,
+}
+
+// noiseSeed keeps renders deterministic so identical hits produce identical
+// buffers on every platform.
+const noiseSeed = 0x9e3779b9
+
+// noiseGen is a xorshift white-noise source in the range [-1,1].
+type noiseGen struct{ s uint32 }
+
+func (n *noiseGen) next() float64 {
+	n.s ^= n.s << 13
+	n.s ^= n.s >> 17
+	n.s ^= n.s << 5
+	return float64(int32(n.s)) / math.MaxInt32
+}
+
+// span maps a bipolar parameter v in [-1,1] onto [1/r, r].
+func span(v, r float64) float64 { return math.Pow(r, v) }
+
+// drumSamples returns the number of samples a hit of kind lasts at bpm.
+func drumSamples(kind string, p DrumParams, bpm, sampleRate int) int {
+	if bpm <= 0 {
+		bpm = 120
+	}
+	sec := 60 / float64(bpm) * drumBeats[kind] * span(p.Decay, 2)
+	return int(sec * float64(sampleRate))
+}
+
+// renderDrum synthesises one hit of a built-in drum. It returns nil for
+// unknown kinds.
+func renderDrum(kind string, p DrumParams, bpm, sampleRate int) []float32 {
+	if _, ok := drumBeats[kind]; !ok {
+		return nil
+	}
+	buf := make([]float32, drumSamples(kind, p, bpm, sampleRate))
+	n := &noiseGen{s: noiseSeed}
+	switch kind {
+	case drumSnare:
+		synthSnare(buf, sampleRate, p, n)
+	case drumKick:
+		synthKick(buf, sampleRate, p, n)
+	case drumHiHat:
+		synthHiHat(buf, sampleRate, p, n)
+	case drumTom:
+		synthTom(buf, sampleRate, p, n)
+	case drumClap:
+		synthClap(buf, sampleRate, p, n)
+	}
+	return buf
+}
+
+func synthKick(out []float32, sampleRate int, p DrumParams, n *noiseGen) {
+	pitch := span(p.Pitch, 2)
+	sweep := 100 * pitch * span(p.Tone, 1.45)
+	noise := 1 + p.Noise
+	snap := 40 * span(p.Snap, 3)
+	phase := 0.0
+	for i := range out {
+		t := float64(i) / float64(len(out))
+		freq := math.Max(150*pitch-sweep*t, 20)
+		phase += 2 * math.Pi * freq / float64(sampleRate)
+		tone := math.Sin(phase) * math.Exp(-5*t)
+		attack := n.next() * noise * math.Exp(-snap*t)
+		out[i] = float32(tone + attack)
+	}
+}
+
+func synthSnare(out []float32, sampleRate int, p DrumParams, n *noiseGen) {
+	pitch := span(p.Pitch, 2)
+	bright := 0.5 + 0.5*p.Tone
+	noise := 0.7 * (1 + p.Noise)
+	snap := span(p.Snap, 2)
+	lp, phase := 0.0, 0.0
+	for i := range out {
+		t := float64(i) / float64(len(out))
+		v := n.next()
+		lp = lp*0.7 + v*0.3
+		hp := v - lp
+		noiseVal := (hp*bright + lp*(1-bright)) * math.Exp(-6*snap*t)
+		freq := (200 - 60*t) * pitch
+		phase += 2 * math.Pi * freq / float64(sampleRate)
+		tone := math.Sin(phase) * math.Exp(-4*t)
+		out[i] = float32(noiseVal*noise + tone*0.3)
+	}
+}
+
+// hiHatRatios are the inharmonic partials of the metallic hi-hat layer.
+var hiHatRatios = []float64{1, 1.342, 1.2312, 1.6532, 1.9523, 2.1523}
+
+func synthHiHat(out []float32, sampleRate int, p DrumParams, n *noiseGen) {
+	pitch := span(p.Pitch, 2)
+	alpha := math.Min(0.05*span(p.Tone, 4), 0.9)
+	noise := 1 + p.Noise
+	// Turning the noise down brings in the metallic layer in its place.
+	metal := 0.3 * math.Max(-p.Noise, 0)
+	snap := 40 * span(p.Snap, 2)
+	phases := make([]float64, len(hiHatRatios))
+	lp := 0.0
+	for i := range out {
+		t := float64(i) / float64(len(out))
+		v := n.next()
+		lp = lp*(1-alpha) + v*alpha
+		hp := v - lp
+		sq := 0.0
+		for k, r := range hiHatRatios {
+			phases[k] += 2 * math.Pi * 320 * r * pitch / float64(sampleRate)
+			if math.Sin(phases[k]) >= 0 {
+				sq++
+			} else {
+				sq--
+			}
+		}
+		sq /= float64(len(hiHatRatios))
+		out[i] = float32((hp*noise + sq*metal) * math.Exp(-snap*t))
+	}
+}
+
+func synthTom(out []float32, sampleRate int, p DrumParams, n *noiseGen) {
+	pitch := span(p.Pitch, 2)
+	sweep := 200 * pitch * span(p.Tone, 1.4)
+	noise := 0.2 * (1 + p.Noise)
+	snap := span(p.Snap, 2)
+	phase, lp := 0.0, 0.0
+	for i := range out {
+		t := float64(i) / float64(len(out))
+		freq := math.Max(300*pitch-sweep*t, 20)
+		phase += 2 * math.Pi * freq / float64(sampleRate)
+		tone := math.Sin(phase) * math.Exp(-3*t)
+		lp = lp*0.8 + n.next()*0.2
+		out[i] = float32(tone + lp*noise*math.Exp(-6*snap*t))
+	}
+}
+
+func synthClap(out []float32, sampleRate int, p DrumParams, n *noiseGen) {
+	gap := 0.02 / span(p.Pitch, 2)
+	noise := 1 + p.Noise
+	width := 100 * span(p.Snap, 2)
+	lp := 0.0
+	for i := range out {
+		t := float64(i) / float64(sampleRate)
+		v := n.next()
+		lp = lp*0.6 + v*0.4
+		// Tone tilts the noise towards its high or low band; at 0 it is
+		// left as it is.
+		filtered := v + p.Tone*(v-2*lp)
+		burst := math.Exp(-width*math.Abs(t)) + math.Exp(-width*math.Abs(t-gap)) +
+			math.Exp(-width*math.Abs(t-2*gap))
+		out[i] = float32(filtered * noise * burst * math.Exp(-6*t))
+	}
+}
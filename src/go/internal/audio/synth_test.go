@@ -0,0 +1,144 @@
+package audio
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func zeroCrossings(buf []float32) int {
+	n := 0
+	for i := 1; i < len(buf); i++ {
+		if (buf[i-1] < 0) != (buf[i] < 0) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestRenderDrumDeterministic(t *testing.T) {
+	for kind := range drumBeats {
+		a := renderDrum(kind, DrumParams{}, 120, 44100)
+		b := renderDrum(kind, DrumParams{}, 120, 44100)
+		if len(a) == 0 {
+			t.Fatalf("%s: empty render", kind)
+		}
+		if !slices.Equal(a, b) {
+			t.Fatalf("%s: renders differ between calls", kind)
+		}
+	}
+	if renderDrum("cowbell", DrumParams{}, 120, 44100) != nil {
+		t.Fatalf("expected nil render for unknown drum")
+	}
+}
+
+func TestRenderDrumDecayScalesLength(t *testing.T) {
+	base := len(renderDrum(drumKick, DrumParams{}, 120, 44100))
+	long := len(renderDrum(drumKick, DrumParams{Decay: 1}, 120, 44100))
+	short := len(renderDrum(drumKick, DrumParams{Decay: -1}, 120, 44100))
+	if long < base*2-1 || short > base/2+1 {
+		t.Fatalf("decay did not scale length: short=%d base=%d long=%d", short, base, long)
+	}
+}
+
+func TestRenderDrumPitchRaisesFrequency(t *testing.T) {
+	quiet := DrumParams{Noise: -1}
+	low := renderDrum(drumKick, quiet, 120, 44100)
+	quiet.Pitch = 1
+	high := renderDrum(drumKick, quiet, 120, 44100)
+	if zeroCrossings(high) <= zeroCrossings(low) {
+		t.Fatalf("expected more zero crossings at higher pitch: low=%d high=%d", zeroCrossings(low), zeroCrossings(high))
+	}
+}
+
+func TestDrumParamsSetClamps(t *testing.T) {
+	p := DrumParams{}.Set(0, 2).Set(4, -3)
+	if p.Pitch != 1 || p.Snap != -1 {
+		t.Fatalf("params not clamped: %+v", p)
+	}
+	for i := range ParamNames {
+		if got := (DrumParams{}).Set(i, 0.5).Get(i); got != 0.5 {
+			t.Fatalf("param %d round trip got %f", i, got)
+		}
+	}
+}
+
+// cDrums are the C renderers the Go synth replaced, fed the same noise.
+var cDrums = map[string]func(out []float32, sampleRate int, n *noiseGen){
+	drumSnare: func(out []float32, sampleRate int, n *noiseGen) {
+		lp, phase := 0.0, 0.0
+		for i := range out {
+			t := float64(i) / float64(len(out))
+			v := n.next()
+			lp = lp*0.7 + v*0.3
+			noiseVal := ((v-lp)*0.5 + lp*0.5) * math.Exp(-6*t)
+			phase += 2 * math.Pi * (200 - 60*t) / float64(sampleRate)
+			out[i] = float32(noiseVal*0.7 + math.Sin(phase)*math.Exp(-4*t)*0.3)
+		}
+	},
+	drumKick: func(out []float32, sampleRate int, n *noiseGen) {
+		phase := 0.0
+		for i := range out {
+			t := float64(i) / float64(len(out))
+			phase += 2 * math.Pi * (150 - 100*t) / float64(sampleRate)
+			out[i] = float32(math.Sin(phase)*math.Exp(-5*t) + n.next()*math.Exp(-40*t))
+		}
+	},
+	drumHiHat: func(out []float32, sampleRate int, n *noiseGen) {
+		lp := 0.0
+		for i := range out {
+			t := float64(i) / float64(len(out))
+			v := n.next()
+			lp = lp*0.95 + v*0.05
+			out[i] = float32((v - lp) * math.Exp(-40*t))
+		}
+	},
+	drumTom: func(out []float32, sampleRate int, n *noiseGen) {
+		phase, lp := 0.0, 0.0
+		for i := range out {
+			t := float64(i) / float64(len(out))
+			phase += 2 * math.Pi * (300 - 200*t) / float64(sampleRate)
+			lp = lp*0.8 + n.next()*0.2
+			out[i] = float32(math.Sin(phase)*math.Exp(-3*t) + lp*0.2*math.Exp(-6*t))
+		}
+	},
+	drumClap: func(out []float32, sampleRate int, n *noiseGen) {
+		for i := range out {
+			t := float64(i) / float64(sampleRate)
+			burst := math.Exp(-100*math.Abs(t)) + math.Exp(-100*math.Abs(t-0.02)) + math.Exp(-100*math.Abs(t-0.04))
+			out[i] = float32(n.next() * burst * math.Exp(-6*t))
+		}
+	},
+}
+
+func TestDefaultParamsMatchTheCRenderers(t *testing.T) {
+	for kind, render := range cDrums {
+		got := renderDrum(kind, DrumParams{}, 120, 44100)
+		want := make([]float32, len(got))
+		render(want, 44100, &noiseGen{s: noiseSeed})
+		for i := range got {
+			if math.Abs(float64(got[i]-want[i])) > 1e-5 {
+				t.Fatalf("%s: sample %d is %f, the C renderer gave %f", kind, i, got[i], want[i])
+			}
+		}
+	}
+}
+
+func TestPanGains(t *testing.T) {
+	cases := []struct{ pan, l, r float64 }{
+		{0, 1, 1},
+		{-1, 1, 0},
+		{1, 0, 1},
+		{-2, 1, 0}, // clamped
+	}
+	for _, c := range cases {
+		l, r := panGains(c.pan)
+		if math.Abs(l-c.l) > 1e-9 || math.Abs(r-c.r) > 1e-9 {
+			t.Fatalf("panGains(%f)=%f,%f want %f,%f", c.pan, l, r, c.l, c.r)
+		}
+	}
+	l, r := panGains(0.5)
+	if l >= 1 || r != 1 {
+		t.Fatalf("expected half-right pan to attenuate left only, got %f,%f", l, r)
+	}
+}
@@ -10,12 +10,14 @@ import (
 	"testing"
 )
 
-func writeTestWAV(path string) error {
+// writeTestWAV writes 10ms of a sine wave. Stereo files carry the sine on
+// the right channel only.
+func writeTestWAV(path string, channels int) error {
 	const sampleRate = 44100
 	samples := sampleRate / 100 // 10ms
-	data := make([]int16, samples)
-	for i := range data {
-		data[i] = int16(math.Sin(2*math.Pi*float64(i)/float64(samples)) * 30000)
+	data := make([]int16, samples*channels)
+	for i := 0; i < samples; i++ {
+		data[i*channels+channels-1] = int16(math.Sin(2*math.Pi*float64(i)/float64(samples)) * 30000)
 	}
 	f, err := os.Create(path)
 	if err != nil {
@@ -38,16 +40,16 @@ func writeTestWAV(path string) error {
 	if err := binary.Write(f, binary.LittleEndian, uint16(1)); err != nil { // PCM
 		return err
 	}
-	if err := binary.Write(f, binary.LittleEndian, uint16(1)); err != nil { // mono
+	if err := binary.Write(f, binary.LittleEndian, uint16(channels)); err != nil {
 		return err
 	}
 	if err := binary.Write(f, binary.LittleEndian, uint32(sampleRate)); err != nil {
 		return err
 	}
-	if err := binary.Write(f, binary.LittleEndian, uint32(sampleRate*2)); err != nil {
+	if err := binary.Write(f, binary.LittleEndian, uint32(sampleRate*2*channels)); err != nil {
 		return err
 	}
-	if err := binary.Write(f, binary.LittleEndian, uint16(2)); err != nil { // block align
+	if err := binary.Write(f, binary.LittleEndian, uint16(2*channels)); err != nil { // block align
 		return err
 	}
 	if err := binary.Write(f, binary.LittleEndian, uint16(16)); err != nil { // bits per sample
@@ -70,7 +72,7 @@ func writeTestWAV(path string) error {
 func TestRegisterWAVPlaysSample(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "test.wav")
-	if err := writeTestWAV(path); err != nil {
+	if err := writeTestWAV(path, 1); err != nil {
 		t.Fatalf("writeTestWAV: %v", err)
 	}
 	if err := RegisterWAV("testwav", path); err != nil {
@@ -84,7 +86,7 @@ func TestRegisterWAVPlaysSample(t *testing.T) {
 	}
 	m := &mixer{}
 	m.Schedule(inst.NewVoice(120, sampleRate), 0)
-	buf := make([]byte, sampleRate/100*2)
+	buf := make([]byte, sampleRate/100*2*channelCount)
 	m.Read(buf)
 	nonZero := false
 	for _, b := range buf {
@@ -97,3 +99,34 @@ func TestRegisterWAVPlaysSample(t *testing.T) {
 		t.Fatalf("expected non-zero audio output")
 	}
 }
+
+func TestRegisterWAVKeepsStereo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stereo.wav")
+	if err := writeTestWAV(path, 2); err != nil {
+		t.Fatalf("writeTestWAV: %v", err)
+	}
+	if err := RegisterWAV("teststereo", path); err != nil {
+		t.Fatalf("RegisterWAV: %v", err)
+	}
+	instMu.RLock()
+	inst := instruments["teststereo"]
+	instMu.RUnlock()
+	if _, ok := inst.NewVoice(120, sampleRate).(StereoVoice); !ok {
+		t.Fatalf("expected stereo voice for stereo wav")
+	}
+	m := &mixer{}
+	m.Schedule(inst.NewVoice(120, sampleRate), 0)
+	buf := make([]byte, sampleRate/50*2*channelCount)
+	m.Read(buf)
+	right := false
+	for i := 0; i < frameCount(buf); i++ {
+		l, r := frameAt(buf, i)
+		if l != 0 {
+			t.Fatalf("left channel not silent at frame %d", i)
+		}
+		right = right || r != 0
+	}
+	if !right {
+		t.Fatalf("right channel silent")
+	}
+}
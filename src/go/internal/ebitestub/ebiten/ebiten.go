@@ -59,6 +59,26 @@ const (
 	KeyEscape
 	KeyLeft
 	KeyRight
+	KeyArrowLeft
+	KeyArrowRight
+	KeyArrowUp
+	KeyArrowDown
+	KeyDelete
+	KeyE
+	KeyH
+	KeyN
+	KeyO
+	KeyT
+	KeyX
+	KeyDigit1
+	KeyDigit2
+	KeyDigit3
+	KeyDigit4
+	KeyDigit5
+	KeyDigit6
+	KeyDigit7
+	KeyDigit8
+	KeyDigit9
 )
 
 // Window and run stubs
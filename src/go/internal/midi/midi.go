@@ -0,0 +1,262 @@
+// Package midi sends drum hits to external MIDI gear and receives clock and
+// notes from it.
+package midi
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DrumChannel is the General MIDI percussion channel, 1-based.
+const DrumChannel = 10
+
+// DefaultGate is how long a note is held before its note-off.
+const DefaultGate = 50 * time.Millisecond
+
+// gmDrums maps built-in instruments to General MIDI percussion notes.
+var gmDrums = map[string]int{
+	"kick":  36, // Bass Drum 1
+	"snare": 38, // Acoustic Snare
+	"hihat": 42, // Closed Hi-Hat
+	"tom":   45, // Low Tom
+	"clap":  39, // Hand Clap
+}
+
+// DefaultNote returns the General MIDI note for an instrument, or the side
+// stick for instruments without one.
+func DefaultNote(instrument string) int {
+	if n, ok := gmDrums[instrument]; ok {
+		return n
+	}
+	return 37 // Side Stick
+}
+
+// Out is a MIDI output port accepting raw messages.
+type Out interface {
+	Send(msg []byte) error
+	Close() error
+}
+
+// Open returns the output port described by spec, the value of the -midi
+// flag: "loop" is an in-memory loopback port and anything else names a
+// platform port. On Linux tunkul opens its own ALSA sequencer port and
+// connects it to the port spec names, as client:port (128:0) or by client
+// name ("FLUID Synth", optionally with :port); "virtual" leaves it for
+// aconnect or a patchbay to connect. In the browser spec is a Web MIDI
+// output name. An empty spec picks the first available port.
+func Open(spec string) (Out, error) {
+	if spec == "loop" {
+		return NewLoopback(), nil
+	}
+	return openPlatform(spec)
+}
+
+// Handler receives one complete MIDI message and the time it arrived. The
+// message is only valid for the duration of the call.
+type Handler func(msg []byte, at time.Time)
+
+// In is a MIDI input port. Listen delivers every message to h until the port
+// is closed; h may be called from another goroutine.
+type In interface {
+	Listen(h Handler) error
+	Close() error
+}
+
+// OpenIn returns the input port described by spec, using the same names as
+// Open. A "loop" input is a fresh loopback port.
+func OpenIn(spec string) (In, error) {
+	if spec == "loop" {
+		return NewLoopback(), nil
+	}
+	return openPlatformIn(spec)
+}
+
+// NoteOn returns a note-on message. Channels are 1-based.
+func NoteOn(channel, note, velocity int) []byte {
+	return []byte{0x90 | byte(channel-1)&0x0f, byte(note) & 0x7f, byte(velocity) & 0x7f}
+}
+
+// NoteOff returns a note-off message. Channels are 1-based.
+func NoteOff(channel, note int) []byte {
+	return []byte{0x80 | byte(channel-1)&0x0f, byte(note) & 0x7f, 0}
+}
+
+// Loopback is an output port that keeps every message sent to it, for tests
+// and for wiring tunkul's output back into its own input. Messages are also
+// delivered to its listener, so it doubles as an input port.
+type Loopback struct {
+	mu      sync.Mutex
+	msgs    [][]byte
+	closed  bool
+	handler Handler
+}
+
+func NewLoopback() *Loopback { return &Loopback{} }
+
+func (l *Loopback) Send(msg []byte) error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return errors.New("midi: loopback port closed")
+	}
+	l.msgs = append(l.msgs, slices.Clone(msg))
+	h := l.handler
+	l.mu.Unlock()
+	if h != nil {
+		h(msg, time.Now())
+	}
+	return nil
+}
+
+func (l *Loopback) Listen(h Handler) error {
+	l.mu.Lock()
+	l.handler = h
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *Loopback) Close() error {
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+	return nil
+}
+
+// Messages returns a copy of the messages sent so far.
+func (l *Loopback) Messages() [][]byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return slices.Clone(l.msgs)
+}
+
+// Sender plays notes on an output port, sending each note-off after the
+// gate time. Retriggering a sounding note ends it first so external gear
+// sees a fresh attack. It is safe for concurrent use.
+type Sender struct {
+	Gate time.Duration
+
+	mu      sync.Mutex
+	out     Out
+	playing map[[2]int]*time.Timer // channel, note -> pending note-off
+}
+
+// NewSender returns a Sender writing to out with the default gate time.
+func NewSender(out Out) *Sender {
+	return &Sender{Gate: DefaultGate, out: out, playing: map[[2]int]*time.Timer{}}
+}
+
+// Note plays note on channel (1-16) at velocity (1-127).
+func (s *Sender) Note(channel, note, velocity int) error {
+	if channel < 1 || channel > 16 {
+		return fmt.Errorf("midi: channel %d out of range", channel)
+	}
+	key := [2]int{channel, note}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.out == nil {
+		return errors.New("midi: sender closed")
+	}
+	if t, ok := s.playing[key]; ok && t.Stop() {
+		if err := s.out.Send(NoteOff(channel, note)); err != nil {
+			return err
+		}
+	}
+	if err := s.out.Send(NoteOn(channel, note, velocity)); err != nil {
+		return err
+	}
+	var t *time.Timer
+	t = time.AfterFunc(s.Gate, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.playing[key] != t || s.out == nil {
+			return
+		}
+		delete(s.playing, key)
+		_ = s.out.Send(NoteOff(channel, note))
+	})
+	s.playing[key] = t
+	return nil
+}
+
+// Close ends every sounding note and closes the port.
+func (s *Sender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.out == nil {
+		return nil
+	}
+	for key, t := range s.playing {
+		if t.Stop() {
+			_ = s.out.Send(NoteOff(key[0], key[1]))
+		}
+	}
+	s.playing = nil
+	err := s.out.Close()
+	s.out = nil
+	return err
+}
+
+// Parser splits a raw MIDI byte stream into complete messages, handling
+// running status. Real-time messages are emitted as soon as they arrive,
+// even in the middle of another message, and system exclusive data is
+// skipped.
+type Parser struct {
+	status byte
+	buf    []byte
+	sysex  bool
+}
+
+// dataLen returns how many data bytes follow status.
+func dataLen(status byte) int {
+	switch {
+	case status < 0xC0, status >= 0xE0 && status < 0xF0:
+		return 2 // note off/on, aftertouch, control change, pitch bend
+	case status < 0xE0:
+		return 1 // program change, channel pressure
+	case status == 0xF1, status == 0xF3:
+		return 1 // time code quarter frame, song select
+	case status == 0xF2:
+		return 2 // song position
+	default:
+		return 0
+	}
+}
+
+// Feed parses data, calling emit for every message it completes. Partial
+// messages are kept for the next call. The slice passed to emit is reused.
+func (p *Parser) Feed(data []byte, emit func(msg []byte)) {
+	for _, b := range data {
+		switch {
+		case b >= 0xF8:
+			emit([]byte{b})
+			continue
+		case b == 0xF0:
+			p.sysex, p.status = true, 0
+			continue
+		case b == 0xF7:
+			p.sysex = false
+			continue
+		case b&0x80 != 0:
+			p.sysex = false
+			p.status = b
+			p.buf = append(p.buf[:0], b)
+		case p.sysex || p.status == 0:
+			continue // stray data byte
+		default:
+			if len(p.buf) == 0 {
+				p.buf = append(p.buf, p.status) // running status
+			}
+			p.buf = append(p.buf, b)
+		}
+		if len(p.buf) == 1+dataLen(p.status) {
+			emit(p.buf)
+			p.buf = p.buf[:0]
+			if p.status >= 0xF0 {
+				p.status = 0 // system common cancels running status
+			}
+		}
+	}
+}
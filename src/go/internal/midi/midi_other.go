@@ -0,0 +1,13 @@
+//go:build !linux && !js
+
+package midi
+
+import "fmt"
+
+func openPlatform(spec string) (Out, error) {
+	return nil, fmt.Errorf("midi: hardware ports are not supported on this platform; use \"loop\"")
+}
+
+func openPlatformIn(spec string) (In, error) {
+	return nil, fmt.Errorf("midi: hardware ports are not supported on this platform; use \"loop\"")
+}
@@ -0,0 +1,127 @@
+package midi
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestMessages(t *testing.T) {
+	if got := NoteOn(10, 36, 100); !bytes.Equal(got, []byte{0x99, 36, 100}) {
+		t.Fatalf("note on % x", got)
+	}
+	if got := NoteOff(1, 38); !bytes.Equal(got, []byte{0x80, 38, 0}) {
+		t.Fatalf("note off % x", got)
+	}
+}
+
+func TestDefaultNote(t *testing.T) {
+	if DefaultNote("kick") != 36 || DefaultNote("snare") != 38 || DefaultNote("mysample") != 37 {
+		t.Fatal("unexpected General MIDI mapping")
+	}
+}
+
+func TestSenderGatesNotes(t *testing.T) {
+	loop := NewLoopback()
+	s := NewSender(loop)
+	s.Gate = 5 * time.Millisecond
+	if err := s.Note(10, 36, 90); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for len(loop.Messages()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	want := [][]byte{NoteOn(10, 36, 90), NoteOff(10, 36)}
+	if got := loop.Messages(); len(got) != 2 || !bytes.Equal(got[0], want[0]) || !bytes.Equal(got[1], want[1]) {
+		t.Fatalf("got % x want % x", got, want)
+	}
+}
+
+func TestSenderRetriggerEndsNoteFirst(t *testing.T) {
+	loop := NewLoopback()
+	s := NewSender(loop)
+	s.Gate = time.Hour
+	_ = s.Note(1, 60, 100)
+	_ = s.Note(1, 60, 50)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]byte{NoteOn(1, 60, 100), NoteOff(1, 60), NoteOn(1, 60, 50), NoteOff(1, 60)}
+	got := loop.Messages()
+	if len(got) != len(want) {
+		t.Fatalf("got % x want % x", got, want)
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Fatalf("message %d: got % x want % x", i, got[i], want[i])
+		}
+	}
+	if err := s.Note(1, 60, 100); err == nil {
+		t.Fatal("note sent after close")
+	}
+}
+
+func TestSenderRejectsBadChannel(t *testing.T) {
+	s := NewSender(NewLoopback())
+	if err := s.Note(0, 36, 100); err == nil {
+		t.Fatal("channel 0 accepted")
+	}
+	if err := s.Note(17, 36, 100); err == nil {
+		t.Fatal("channel 17 accepted")
+	}
+}
+
+func TestOpenLoopback(t *testing.T) {
+	out, err := Open("loop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := out.(*Loopback); !ok {
+		t.Fatalf("got %T", out)
+	}
+}
+
+func TestParserSplitsStream(t *testing.T) {
+	var p Parser
+	var got [][]byte
+	emit := func(msg []byte) { got = append(got, bytes.Clone(msg)) }
+	p.Feed([]byte{
+		0x99, 36, 100, // note on
+		38, 90, // running status
+		0xF0, 0x7E, 0x01, 0xF7, // sysex, skipped
+		0xB0, 7, // control change split across reads...
+	}, emit)
+	p.Feed([]byte{
+		0xF8, // ...with a clock pulse in the middle
+		64,
+		0xF2, 8, 0, // song position
+		5, // stray data: song position cancelled running status
+		0xFA,
+	}, emit)
+	want := [][]byte{
+		{0x99, 36, 100}, {0x99, 38, 90}, {0xF8}, {0xB0, 7, 64}, {0xF2, 8, 0}, {0xFA},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got % x want % x", got, want)
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Fatalf("message %d: got % x want % x", i, got[i], want[i])
+		}
+	}
+}
+
+func TestLoopbackDeliversToListener(t *testing.T) {
+	loop := NewLoopback()
+	var got []byte
+	if err := loop.Listen(func(msg []byte, _ time.Time) { got = bytes.Clone(msg) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := loop.Send([]byte{0xF8}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, []byte{0xF8}) {
+		t.Fatalf("listener got % x", got)
+	}
+}
@@ -0,0 +1,474 @@
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// The ALSA sequencer is driven through its kernel interface, /dev/snd/seq,
+// so no ALSA development library is needed to build. Constants and layouts
+// follow <sound/asequencer.h>.
+const (
+	seqDevice     = "/dev/snd/seq"
+	seqClientName = "tunkul"
+	seqVirtual    = "virtual" // port spec that connects to nothing
+	seqEventSize  = 28        // struct snd_seq_event
+
+	seqPortCapRead      = 1 << 0
+	seqPortCapWrite     = 1 << 1
+	seqPortCapSubsRead  = 1 << 5
+	seqPortCapSubsWrite = 1 << 6
+	seqPortCapNoExport  = 1 << 7
+
+	seqPortTypeMIDIGeneric = 1 << 1
+	seqPortTypeApplication = 1 << 20
+
+	seqQueueDirect      = 253 // deliver events immediately
+	seqAddrSubscribers  = 254 // send to every subscriber of the source port
+	seqAddrUnknown      = 253
+	seqSystemClient     = 0
+	seqEventLengthMask  = 3 << 2
+	seqEventLengthVar   = 1 << 2
+	seqEventExtLenMask  = 0x3fffffff
+	seqEventNoteOn      = 6
+	seqEventNoteOff     = 7
+	seqEventKeyPress    = 8
+	seqEventController  = 10
+	seqEventPgmChange   = 11
+	seqEventChanPress   = 12
+	seqEventPitchBend   = 13
+	seqEventSongPos     = 20
+	seqEventSongSel     = 21
+	seqEventQFrame      = 22
+	seqEventStart       = 30
+	seqEventContinue    = 31
+	seqEventStop        = 32
+	seqEventClock       = 36
+	seqEventTuneRequest = 40
+	seqEventReset       = 41
+	seqEventSensing     = 42
+)
+
+type seqAddr struct{ client, port uint8 }
+
+// seqClientInfo is struct snd_seq_client_info.
+type seqClientInfo struct {
+	client    int32
+	typ       int32
+	name      [64]byte
+	filter    uint32
+	multicast [8]byte
+	events    [32]byte
+	numPorts  int32
+	lost      int32
+	reserved  [64]byte // card, pid and anything newer kernels add
+}
+
+// seqPortInfo is struct snd_seq_port_info.
+type seqPortInfo struct {
+	addr         seqAddr
+	name         [64]byte
+	capability   uint32
+	typ          uint32
+	midiChannels int32
+	midiVoices   int32
+	synthVoices  int32
+	readUse      int32
+	writeUse     int32
+	kernel       uintptr
+	flags        uint32
+	timeQueue    uint8
+	reserved     [59]byte
+}
+
+// seqPortSubscribe is struct snd_seq_port_subscribe.
+type seqPortSubscribe struct {
+	sender   seqAddr
+	dest     seqAddr
+	voices   uint32
+	flags    uint32
+	queue    uint8
+	pad      [3]byte
+	reserved [64]byte
+}
+
+// seqIoctl encodes a sequencer ioctl request the way the generic Linux
+// _IOC macro does.
+func seqIoctl(read, write bool, nr, size uintptr) uintptr {
+	var dir uintptr
+	if write {
+		dir |= 1
+	}
+	if read {
+		dir |= 2
+	}
+	return dir<<30 | size<<16 | 'S'<<8 | nr
+}
+
+var (
+	seqIoctlClientID        = seqIoctl(true, false, 0x01, 4)
+	seqIoctlGetClientInfo   = seqIoctl(true, true, 0x10, unsafe.Sizeof(seqClientInfo{}))
+	seqIoctlSetClientInfo   = seqIoctl(false, true, 0x11, unsafe.Sizeof(seqClientInfo{}))
+	seqIoctlCreatePort      = seqIoctl(true, true, 0x20, unsafe.Sizeof(seqPortInfo{}))
+	seqIoctlSubscribePort   = seqIoctl(false, true, 0x30, unsafe.Sizeof(seqPortSubscribe{}))
+	seqIoctlQueryNextClient = seqIoctl(true, true, 0x51, unsafe.Sizeof(seqClientInfo{}))
+	seqIoctlQueryNextPort   = seqIoctl(true, true, 0x52, unsafe.Sizeof(seqPortInfo{}))
+)
+
+// seqClient is a sequencer client owning one port named after its use.
+type seqClient struct {
+	f    *os.File
+	conn syscall.RawConn
+	addr seqAddr
+}
+
+// openSeq registers a "tunkul" client with one port. caps are the port's
+// capabilities; other clients may subscribe to it, as aconnect does.
+func openSeq(mode int, portName string, caps uint32) (*seqClient, error) {
+	f, err := os.OpenFile(seqDevice, mode, 0)
+	if err != nil {
+		return nil, fmt.Errorf("midi: open ALSA sequencer: %w", err)
+	}
+	c := &seqClient{f: f}
+	if c.conn, err = f.SyscallConn(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := c.register(portName, caps); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("midi: ALSA sequencer: %w", err)
+	}
+	return c, nil
+}
+
+func (c *seqClient) ioctl(req uintptr, arg unsafe.Pointer) error {
+	var errno syscall.Errno
+	err := c.conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func (c *seqClient) register(portName string, caps uint32) error {
+	var id int32
+	if err := c.ioctl(seqIoctlClientID, unsafe.Pointer(&id)); err != nil {
+		return err
+	}
+	info := seqClientInfo{client: id}
+	if err := c.ioctl(seqIoctlGetClientInfo, unsafe.Pointer(&info)); err != nil {
+		return err
+	}
+	info.name = [64]byte{}
+	copy(info.name[:], seqClientName)
+	if err := c.ioctl(seqIoctlSetClientInfo, unsafe.Pointer(&info)); err != nil {
+		return err
+	}
+	port := seqPortInfo{
+		addr:         seqAddr{client: uint8(id)},
+		capability:   caps,
+		typ:          seqPortTypeMIDIGeneric | seqPortTypeApplication,
+		midiChannels: 16,
+	}
+	copy(port.name[:], portName)
+	if err := c.ioctl(seqIoctlCreatePort, unsafe.Pointer(&port)); err != nil {
+		return err
+	}
+	c.addr = port.addr
+	return nil
+}
+
+// find resolves spec to another client's port with every capability in
+// caps. spec is a client number or name, either optionally followed by
+// ":port", or empty for the first such port outside the system, Midi Through
+// and tunkul clients. A name picks the client called exactly that, or else
+// the first whose name starts with it.
+func (c *seqClient) find(spec string, caps uint32) (seqAddr, error) {
+	name, port := spec, -1
+	if i := strings.LastIndexByte(spec, ':'); i >= 0 {
+		if p, err := strconv.Atoi(spec[i+1:]); err == nil {
+			name, port = spec[:i], p
+		}
+	}
+	id, err := strconv.Atoi(name)
+	if err != nil {
+		id = -1
+	}
+	var prefix *seqAddr
+	client := seqClientInfo{client: -1}
+	for c.ioctl(seqIoctlQueryNextClient, unsafe.Pointer(&client)) == nil {
+		cname := cString(client.name[:])
+		switch {
+		case client.client == int32(c.addr.client), client.client == seqSystemClient:
+			continue
+		case id >= 0:
+			if client.client != int32(id) {
+				continue
+			}
+		case name == "":
+			if cname == "Midi Through" || cname == seqClientName {
+				continue
+			}
+		case !strings.HasPrefix(cname, name):
+			continue
+		}
+		info := seqPortInfo{addr: seqAddr{client: uint8(client.client), port: 255}}
+		for c.ioctl(seqIoctlQueryNextPort, unsafe.Pointer(&info)) == nil {
+			if info.capability&caps != caps || (port >= 0 && int(info.addr.port) != port) {
+				continue
+			}
+			if name == "" && info.capability&seqPortCapNoExport != 0 {
+				continue
+			}
+			if name == "" || id >= 0 || cname == name {
+				return info.addr, nil
+			}
+			if prefix == nil {
+				a := info.addr
+				prefix = &a
+			}
+			break
+		}
+	}
+	if prefix != nil {
+		return *prefix, nil
+	}
+	if spec == "" {
+		return seqAddr{}, errors.New("midi: no ALSA sequencer ports found")
+	}
+	return seqAddr{}, fmt.Errorf("midi: no ALSA sequencer port matches %q", spec)
+}
+
+// subscribe connects sender to dest.
+func (c *seqClient) subscribe(sender, dest seqAddr) error {
+	s := seqPortSubscribe{sender: sender, dest: dest}
+	if err := c.ioctl(seqIoctlSubscribePort, unsafe.Pointer(&s)); err != nil {
+		return fmt.Errorf("midi: connect %d:%d to %d:%d: %w", sender.client, sender.port, dest.client, dest.port, err)
+	}
+	return nil
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// seqOut sends to the subscribers of a "tunkul out" sequencer port.
+type seqOut struct {
+	mu sync.Mutex
+	c  *seqClient
+}
+
+// openPlatform opens a "tunkul out" port on the ALSA sequencer and connects
+// it to the port spec names, unless spec is "virtual". Other connections can
+// be made with aconnect or a patchbay either way.
+func openPlatform(spec string) (Out, error) {
+	c, err := openSeq(os.O_WRONLY, "tunkul out", seqPortCapRead|seqPortCapSubsRead)
+	if err != nil {
+		return nil, err
+	}
+	if spec != seqVirtual {
+		dest, err := c.find(spec, seqPortCapWrite|seqPortCapSubsWrite)
+		if err == nil {
+			err = c.subscribe(c.addr, dest)
+		}
+		if err != nil {
+			c.f.Close()
+			return nil, err
+		}
+	}
+	return &seqOut{c: c}, nil
+}
+
+func (o *seqOut) Send(msg []byte) error {
+	ev, ok := seqEvent(msg, o.c.addr.port)
+	if !ok {
+		return fmt.Errorf("midi: cannot send % x on the ALSA sequencer", msg)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	_, err := o.c.f.Write(ev[:])
+	return err
+}
+
+func (o *seqOut) Close() error { return o.c.f.Close() }
+
+// seqIn reads events sent to a "tunkul in" sequencer port on its own
+// goroutine.
+type seqIn struct {
+	c    *seqClient
+	once sync.Once
+}
+
+// openPlatformIn opens a "tunkul in" port on the ALSA sequencer and connects
+// the port spec names to it, unless spec is "virtual".
+func openPlatformIn(spec string) (In, error) {
+	c, err := openSeq(os.O_RDONLY, "tunkul in", seqPortCapWrite|seqPortCapSubsWrite)
+	if err != nil {
+		return nil, err
+	}
+	if spec != seqVirtual {
+		src, err := c.find(spec, seqPortCapRead|seqPortCapSubsRead)
+		if err == nil {
+			err = c.subscribe(src, c.addr)
+		}
+		if err != nil {
+			c.f.Close()
+			return nil, err
+		}
+	}
+	return &seqIn{c: c}, nil
+}
+
+func (i *seqIn) Listen(h Handler) error {
+	started := false
+	i.once.Do(func() {
+		started = true
+		go i.read(h)
+	})
+	if !started {
+		return errors.New("midi: input is already being read")
+	}
+	return nil
+}
+
+func (i *seqIn) read(h Handler) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := i.c.f.Read(buf)
+		at := time.Now()
+		for off := 0; off+seqEventSize <= n; {
+			ev := buf[off : off+seqEventSize]
+			off += seqEventSize
+			if ev[1]&seqEventLengthMask == seqEventLengthVar {
+				off += int(binary.NativeEndian.Uint32(ev[16:]) & seqEventExtLenMask)
+			}
+			if msg := midiMessage(ev); msg != nil {
+				h(msg, at)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (i *seqIn) Close() error { return i.c.f.Close() }
+
+// seqEvent converts a MIDI message to an event sent straight from port to
+// its subscribers. ok is false for messages with no fixed-size sequencer
+// event, such as system exclusive.
+func seqEvent(msg []byte, port uint8) (ev [seqEventSize]byte, ok bool) {
+	if len(msg) == 0 || msg[0] < 0x80 || len(msg) < 1+dataLen(msg[0]) {
+		return ev, false
+	}
+	ev[3] = seqQueueDirect
+	ev[13] = port
+	ev[14], ev[15] = seqAddrSubscribers, seqAddrUnknown
+	status := msg[0]
+	note := func(typ byte) {
+		ev[0] = typ
+		ev[16], ev[17], ev[18] = status&0x0f, msg[1], msg[2]
+	}
+	ctrl := func(typ byte, param uint32, value int32) {
+		ev[0] = typ
+		if status < 0xF0 {
+			ev[16] = status & 0x0f
+		}
+		binary.NativeEndian.PutUint32(ev[20:], param)
+		binary.NativeEndian.PutUint32(ev[24:], uint32(value))
+	}
+	switch {
+	case status < 0x90:
+		note(seqEventNoteOff)
+	case status < 0xA0:
+		note(seqEventNoteOn)
+	case status < 0xB0:
+		note(seqEventKeyPress)
+	case status < 0xC0:
+		ctrl(seqEventController, uint32(msg[1]), int32(msg[2]))
+	case status < 0xD0:
+		ctrl(seqEventPgmChange, 0, int32(msg[1]))
+	case status < 0xE0:
+		ctrl(seqEventChanPress, 0, int32(msg[1]))
+	case status < 0xF0:
+		ctrl(seqEventPitchBend, 0, int32(msg[1])|int32(msg[2])<<7-8192)
+	case status == 0xF1:
+		ctrl(seqEventQFrame, 0, int32(msg[1]))
+	case status == 0xF2:
+		ctrl(seqEventSongPos, 0, int32(msg[1])|int32(msg[2])<<7)
+	case status == 0xF3:
+		ctrl(seqEventSongSel, 0, int32(msg[1]))
+	default:
+		typ, ok := seqSystemEvents[status]
+		if !ok {
+			return ev, false
+		}
+		ev[0] = typ
+	}
+	return ev, true
+}
+
+// seqSystemEvents maps data-less system messages to sequencer events.
+var seqSystemEvents = map[byte]byte{
+	0xF6: seqEventTuneRequest,
+	0xF8: seqEventClock,
+	0xFA: seqEventStart,
+	0xFB: seqEventContinue,
+	0xFC: seqEventStop,
+	0xFE: seqEventSensing,
+	0xFF: seqEventReset,
+}
+
+// midiMessage converts a sequencer event back to a MIDI message, or returns
+// nil for events MIDI has no message for.
+func midiMessage(ev []byte) []byte {
+	ch := ev[16] & 0x0f
+	param := binary.NativeEndian.Uint32(ev[20:])
+	value := int32(binary.NativeEndian.Uint32(ev[24:]))
+	switch ev[0] {
+	case seqEventNoteOff:
+		return []byte{0x80 | ch, ev[17] & 0x7f, ev[18] & 0x7f}
+	case seqEventNoteOn:
+		return []byte{0x90 | ch, ev[17] & 0x7f, ev[18] & 0x7f}
+	case seqEventKeyPress:
+		return []byte{0xA0 | ch, ev[17] & 0x7f, ev[18] & 0x7f}
+	case seqEventController:
+		return []byte{0xB0 | ch, byte(param) & 0x7f, byte(value) & 0x7f}
+	case seqEventPgmChange:
+		return []byte{0xC0 | ch, byte(value) & 0x7f}
+	case seqEventChanPress:
+		return []byte{0xD0 | ch, byte(value) & 0x7f}
+	case seqEventPitchBend:
+		v := value + 8192
+		return []byte{0xE0 | ch, byte(v) & 0x7f, byte(v>>7) & 0x7f}
+	case seqEventQFrame:
+		return []byte{0xF1, byte(value) & 0x7f}
+	case seqEventSongPos:
+		return []byte{0xF2, byte(value) & 0x7f, byte(value>>7) & 0x7f}
+	case seqEventSongSel:
+		return []byte{0xF3, byte(value) & 0x7f}
+	}
+	for status, typ := range seqSystemEvents {
+		if ev[0] == typ {
+			return []byte{status}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package midi
+
+import (
+	"bytes"
+	"testing"
+	"unsafe"
+)
+
+func TestSeqStructsMatchKernelLayout(t *testing.T) {
+	port := uintptr(168)
+	if unsafe.Sizeof(uintptr(0)) == 4 {
+		port = 164
+	}
+	for _, c := range []struct {
+		name      string
+		got, want uintptr
+	}{
+		{"snd_seq_client_info", unsafe.Sizeof(seqClientInfo{}), 188},
+		{"snd_seq_port_info", unsafe.Sizeof(seqPortInfo{}), port},
+		{"snd_seq_port_subscribe", unsafe.Sizeof(seqPortSubscribe{}), 80},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s is %d bytes, want %d", c.name, c.got, c.want)
+		}
+	}
+	if seqIoctlCreatePort != 0xc0a85320 && port == 168 {
+		t.Errorf("CREATE_PORT ioctl %#x, want 0xc0a85320", seqIoctlCreatePort)
+	}
+}
+
+func TestSeqEventAddressesSubscribers(t *testing.T) {
+	ev, ok := seqEvent(NoteOn(10, 36, 100), 3)
+	if !ok {
+		t.Fatal("note on not converted")
+	}
+	want := [seqEventSize]byte{0: seqEventNoteOn, 3: seqQueueDirect, 13: 3, 14: seqAddrSubscribers, 15: seqAddrUnknown, 16: 9, 17: 36, 18: 100}
+	if ev != want {
+		t.Fatalf("event % x\nwant  % x", ev, want)
+	}
+}
+
+func TestSeqEventRoundTrip(t *testing.T) {
+	for _, msg := range [][]byte{
+		NoteOn(1, 60, 127),
+		NoteOff(16, 60),
+		{0xA2, 40, 30},
+		{0xB0, 7, 100},
+		{0xC5, 12},
+		{0xD0, 64},
+		{0xE0, 0, 0},
+		{0xE3, 0x7f, 0x7f},
+		{0xE0, 0, 0x40},
+		{0xF1, 0x23},
+		{0xF2, 0x10, 0x02},
+		{0xF3, 5},
+		{0xF6},
+		{0xF8}, {0xFA}, {0xFB}, {0xFC}, {0xFE}, {0xFF},
+	} {
+		ev, ok := seqEvent(msg, 0)
+		if !ok {
+			t.Fatalf("% x not converted", msg)
+		}
+		if got := midiMessage(ev[:]); !bytes.Equal(got, msg) {
+			t.Fatalf("% x came back as % x", msg, got)
+		}
+	}
+	for _, msg := range [][]byte{nil, {0x40}, {0x90, 60}, {0xF0, 1, 2, 0xF7}} {
+		if _, ok := seqEvent(msg, 0); ok {
+			t.Fatalf("converted % x", msg)
+		}
+	}
+}
+
+func TestOpenMissingPortFails(t *testing.T) {
+	if _, err := Open("no such tunkul client"); err == nil {
+		t.Fatal("opened a missing port")
+	}
+	if _, err := OpenIn("250:0"); err == nil {
+		t.Fatal("listened to a missing port")
+	}
+}
@@ -0,0 +1,155 @@
+//go:build js && wasm
+
+package midi
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+// webOut sends to a Web MIDI output. Access is requested asynchronously, so
+// messages sent before the browser grants it are dropped.
+type webOut struct {
+	mu     sync.Mutex
+	port   js.Value
+	err    error
+	closed bool
+}
+
+// openPlatform requests Web MIDI access and binds the output named spec, or
+// the first output when spec is empty.
+func openPlatform(spec string) (Out, error) {
+	nav := js.Global().Get("navigator")
+	if nav.Get("requestMIDIAccess").Type() != js.TypeFunction {
+		return nil, errors.New("midi: Web MIDI is not supported by this browser")
+	}
+	o := &webOut{}
+	var onAccess, onError js.Func
+	onAccess = js.FuncOf(func(_ js.Value, args []js.Value) any {
+		defer onAccess.Release()
+		defer onError.Release()
+		outputs := args[0].Get("outputs").Call("values")
+		for it := outputs.Call("next"); !it.Get("done").Bool(); it = outputs.Call("next") {
+			port := it.Get("value")
+			if spec == "" || port.Get("name").String() == spec {
+				o.mu.Lock()
+				o.port = port
+				o.mu.Unlock()
+				return nil
+			}
+		}
+		o.fail(fmt.Errorf("midi: no Web MIDI output named %q", spec))
+		return nil
+	})
+	onError = js.FuncOf(func(_ js.Value, args []js.Value) any {
+		defer onAccess.Release()
+		defer onError.Release()
+		o.fail(fmt.Errorf("midi: access denied: %s", args[0].Call("toString").String()))
+		return nil
+	})
+	nav.Call("requestMIDIAccess").Call("then", onAccess, onError)
+	return o, nil
+}
+
+func (o *webOut) fail(err error) {
+	o.mu.Lock()
+	o.err = err
+	o.mu.Unlock()
+}
+
+func (o *webOut) Send(msg []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return errors.New("midi: port closed")
+	}
+	if o.err != nil || o.port.IsUndefined() {
+		return o.err
+	}
+	data := make([]any, len(msg))
+	for i, b := range msg {
+		data[i] = int(b)
+	}
+	o.port.Call("send", data)
+	return nil
+}
+
+func (o *webOut) Close() error {
+	o.mu.Lock()
+	o.closed = true
+	o.mu.Unlock()
+	return nil
+}
+
+// webIn receives from a Web MIDI input. Like webOut, it binds the port once
+// the browser grants access.
+type webIn struct {
+	mu      sync.Mutex
+	port    js.Value
+	handler Handler
+	onMsg   js.Func
+}
+
+// openPlatformIn requests Web MIDI access and binds the input named spec, or
+// the first input when spec is empty.
+func openPlatformIn(spec string) (In, error) {
+	nav := js.Global().Get("navigator")
+	if nav.Get("requestMIDIAccess").Type() != js.TypeFunction {
+		return nil, errors.New("midi: Web MIDI is not supported by this browser")
+	}
+	in := &webIn{}
+	in.onMsg = js.FuncOf(func(_ js.Value, args []js.Value) any {
+		in.mu.Lock()
+		h := in.handler
+		in.mu.Unlock()
+		if h == nil {
+			return nil
+		}
+		data := args[0].Get("data")
+		buf := make([]byte, data.Length())
+		js.CopyBytesToGo(buf, data)
+		var p Parser // Web MIDI delivers whole messages
+		at := time.Now()
+		p.Feed(buf, func(msg []byte) { h(msg, at) })
+		return nil
+	})
+	var onAccess js.Func
+	onAccess = js.FuncOf(func(_ js.Value, args []js.Value) any {
+		defer onAccess.Release()
+		inputs := args[0].Get("inputs").Call("values")
+		for it := inputs.Call("next"); !it.Get("done").Bool(); it = inputs.Call("next") {
+			port := it.Get("value")
+			if spec == "" || port.Get("name").String() == spec {
+				in.mu.Lock()
+				in.port = port
+				in.mu.Unlock()
+				port.Set("onmidimessage", in.onMsg)
+				return nil
+			}
+		}
+		js.Global().Get("console").Call("warn", fmt.Sprintf("midi: no Web MIDI input named %q", spec))
+		return nil
+	})
+	nav.Call("requestMIDIAccess").Call("then", onAccess)
+	return in, nil
+}
+
+func (i *webIn) Listen(h Handler) error {
+	i.mu.Lock()
+	i.handler = h
+	i.mu.Unlock()
+	return nil
+}
+
+func (i *webIn) Close() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.handler = nil
+	if !i.port.IsUndefined() {
+		i.port.Set("onmidimessage", js.Null())
+	}
+	return nil
+}
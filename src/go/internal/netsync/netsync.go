@@ -0,0 +1,356 @@
+// Package netsync shares tempo and bar phase between tunkul instances on a
+// LAN, in the spirit of Ableton Link. Peers announce their timeline over UDP
+// multicast a few times a second. Each tempo change starts a new epoch; the
+// timeline with the highest epoch wins and everyone else adopts it,
+// translated into their own clock. A joining peer listens before it
+// announces, so it takes up a running session instead of restarting it.
+package netsync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"log"
+	"math"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultGroup is the multicast group and port sessions meet on.
+const DefaultGroup = "239.255.77.77:20809"
+
+const (
+	announceInterval = 200 * time.Millisecond
+	peerTimeout      = 2 * time.Second
+	// joinWait is how long a new session listens for a running one before
+	// it announces its own timeline.
+	joinWait = 2 * announceInterval
+	// maxBPM matches the limit of tunkul's BPM box; faster timelines are
+	// ignored.
+	maxBPM = 1000
+	// originSlack is how close two origins must be to count as started
+	// together, given the error in clock offset estimates.
+	originSlack = 10 * time.Millisecond
+	// offsetDecay lets a peer's clock offset estimate rise again so it can
+	// follow clock drift; the minimum over recent packets is kept.
+	offsetDecay = 50 * time.Microsecond
+)
+
+// newID picks a session's peer id.
+var newID = rand.Uint64
+
+// magic starts every packet, followed by a version byte.
+var magic = [4]byte{'T', 'K', 'S', 'Y'}
+
+const version = 1
+
+// packet is the wire format, big-endian. Times are nanoseconds on the
+// sender's clock.
+type packet struct {
+	Magic   [4]byte
+	Version uint8
+	_       [3]byte
+	Peer    uint64
+	Sent    int64
+	Epoch   uint64
+	Author  uint64
+	Origin  int64 // time of beat 0
+	BPM     float64
+	Quantum float64
+}
+
+// timeline is beat 0 at origin, advancing at bpm. Epoch and author identify
+// it: a tempo change bumps the epoch, and between equal epochs the one that
+// has been running longest, with the earliest origin, wins. Origins too close
+// to order fall back to the lower author id.
+type timeline struct {
+	bpm    float64
+	origin time.Time
+	epoch  uint64
+	author uint64
+}
+
+// newer reports whether t should replace u.
+func (t timeline) newer(u timeline) bool {
+	if t.epoch != u.epoch {
+		return t.epoch > u.epoch
+	}
+	if d := t.origin.Sub(u.origin); d < -originSlack || d > originSlack {
+		return d < 0
+	}
+	return t.author < u.author
+}
+
+func (t timeline) beatAt(at time.Time) float64 {
+	return at.Sub(t.origin).Minutes() * t.bpm
+}
+
+// Session is this instance's view of the shared timeline. It implements
+// beat.Timeline and is safe for concurrent use.
+type Session struct {
+	in    net.PacketConn
+	out   net.PacketConn
+	dests []net.Addr
+	id    uint64
+	now   func() time.Time
+
+	// announceInterval and joinWait default to the package constants;
+	// tests shrink them before start.
+	announceInterval time.Duration
+	joinWait         time.Duration
+
+	mu      sync.Mutex
+	tl      timeline
+	quantum float64
+	offsets map[uint64]time.Duration // peer clock to ours
+	seen    map[uint64]time.Time
+	joined  bool // announced; before that any timeline heard is adopted
+	heard   bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Join enters the session on the multicast group, DefaultGroup if empty.
+// A session already running there is adopted; bpm is used only if none is
+// heard.
+func Join(group string, bpm float64) (*Session, error) {
+	s, err := joinGroup(group, bpm)
+	if err != nil {
+		return nil, err
+	}
+	s.start()
+	return s, nil
+}
+
+// joinGroup opens the sockets for Join without starting the session.
+func joinGroup(group string, bpm float64) (*Session, error) {
+	if group == "" {
+		group = DefaultGroup
+	}
+	addr, err := net.ResolveUDPAddr("udp4", group)
+	if err != nil {
+		return nil, err
+	}
+	in, err := net.ListenMulticastUDP("udp4", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	out, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		in.Close()
+		return nil, err
+	}
+	return newSession(in, out, []net.Addr{addr}, bpm), nil
+}
+
+// New runs a session over conn, announcing to each of peers by unicast.
+// It suits networks without multicast, and tests.
+func New(conn net.PacketConn, bpm float64, peers ...net.Addr) *Session {
+	s := newSession(conn, conn, peers, bpm)
+	s.start()
+	return s
+}
+
+func newSession(in, out net.PacketConn, dests []net.Addr, bpm float64) *Session {
+	s := &Session{
+		in:               in,
+		out:              out,
+		dests:            dests,
+		id:               newID(),
+		now:              time.Now,
+		announceInterval: announceInterval,
+		joinWait:         joinWait,
+		quantum:          4,
+		offsets:          map[uint64]time.Duration{},
+		seen:             map[uint64]time.Time{},
+		done:             make(chan struct{}),
+	}
+	s.tl = timeline{bpm: bpm, origin: s.now(), author: s.id}
+	return s
+}
+
+// start begins listening and, after joinWait, announcing.
+func (s *Session) start() {
+	s.wg.Add(2)
+	go s.receive()
+	go s.announceLoop()
+}
+
+// BeatAt returns the shared beat position at t.
+func (s *Session) BeatAt(t time.Time) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tl.beatAt(t)
+}
+
+// Tempo returns the shared tempo in BPM.
+func (s *Session) Tempo() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tl.bpm
+}
+
+// Quantum returns the bar length in beats.
+func (s *Session) Quantum() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.quantum
+}
+
+// SetTempo changes the shared tempo, keeping the current beat position so
+// every peer's phase carries on smoothly.
+func (s *Session) SetTempo(bpm float64) {
+	if !validTempo(bpm) {
+		return
+	}
+	s.mu.Lock()
+	now := s.now()
+	if bpm == s.tl.bpm {
+		s.mu.Unlock()
+		return
+	}
+	beat := s.tl.beatAt(now)
+	s.tl = timeline{
+		bpm:    bpm,
+		origin: now.Add(-time.Duration(beat / bpm * float64(time.Minute))),
+		epoch:  s.tl.epoch + 1,
+		author: s.id,
+	}
+	s.mu.Unlock()
+	s.announce()
+}
+
+// Peers returns how many other peers were heard from recently.
+func (s *Session) Peers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	now := s.now()
+	for _, at := range s.seen {
+		if now.Sub(at) < peerTimeout {
+			n++
+		}
+	}
+	return n
+}
+
+// Close leaves the session.
+func (s *Session) Close() error {
+	close(s.done)
+	err := s.in.Close()
+	if s.out != s.in {
+		err = errors.Join(err, s.out.Close())
+	}
+	s.wg.Wait()
+	return err
+}
+
+func (s *Session) announceLoop() {
+	defer s.wg.Done()
+	select {
+	case <-time.After(s.joinWait):
+	case <-s.done:
+		return
+	}
+	t := time.NewTicker(s.announceInterval)
+	defer t.Stop()
+	s.announce()
+	for {
+		select {
+		case <-t.C:
+			s.announce()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Session) announce() {
+	s.mu.Lock()
+	p := packet{
+		Magic:   magic,
+		Version: version,
+		Peer:    s.id,
+		Sent:    s.now().UnixNano(),
+		Epoch:   s.tl.epoch,
+		Author:  s.tl.author,
+		Origin:  s.tl.origin.UnixNano(),
+		BPM:     s.tl.bpm,
+		Quantum: s.quantum,
+	}
+	s.joined = true
+	s.mu.Unlock()
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, p)
+	for _, d := range s.dests {
+		if _, err := s.out.WriteTo(buf.Bytes(), d); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Printf("[NETSYNC] announce to %v: %v", d, err)
+		}
+	}
+}
+
+func (s *Session) receive() {
+	defer s.wg.Done()
+	buf := make([]byte, 512)
+	for {
+		n, _, err := s.in.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("[NETSYNC] receive: %v", err)
+			}
+			return
+		}
+		var p packet
+		if binary.Read(bytes.NewReader(buf[:n]), binary.BigEndian, &p) != nil ||
+			p.Magic != magic || p.Version != version || p.Peer == s.id {
+			continue
+		}
+		s.merge(p)
+	}
+}
+
+// merge records p's sender and adopts its timeline if it is newer, or if
+// it is the first heard while joining.
+func (s *Session) merge(p packet) {
+	if !validTempo(p.BPM) || !(p.Quantum > 0) || math.IsInf(p.Quantum, 0) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.seen[p.Peer] = now
+	// The smallest apparent offset is the one least delayed in transit.
+	sample := now.Sub(time.Unix(0, p.Sent))
+	off, ok := s.offsets[p.Peer]
+	if !ok {
+		off = sample
+	}
+	off = min(sample, off+offsetDecay)
+	s.offsets[p.Peer] = off
+
+	tl := timeline{bpm: p.BPM, origin: time.Unix(0, p.Origin).Add(off), epoch: p.Epoch, author: p.Author}
+	if tl.epoch == s.tl.epoch && tl.author == s.tl.author {
+		if p.Peer == p.Author && p.Author != s.id {
+			// Heard from its author: refine with the better offset.
+			s.tl.origin = tl.origin
+		}
+		return
+	}
+	joining := !s.joined && !s.heard
+	s.heard = true
+	if !joining && !tl.newer(s.tl) {
+		return
+	}
+	log.Printf("[NETSYNC] adopting %.2f BPM (epoch %d) from peer %x", tl.bpm, tl.epoch, p.Peer)
+	s.tl = tl
+	s.quantum = p.Quantum
+}
+
+// validTempo reports whether bpm is a tempo a session can run at; NaN is
+// rejected by the comparisons.
+func validTempo(bpm float64) bool {
+	return bpm >= 1 && bpm <= maxBPM
+}
@@ -0,0 +1,210 @@
+package netsync
+
+import (
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+// mesh starts n sessions on loopback, each announcing to all the others.
+func mesh(t *testing.T, bpms ...float64) []*Session {
+	t.Helper()
+	conns := make([]net.PacketConn, len(bpms))
+	for i := range conns {
+		c, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns[i] = c
+	}
+	sessions := make([]*Session, len(bpms))
+	for i, c := range conns {
+		var peers []net.Addr
+		for j, o := range conns {
+			if j != i {
+				peers = append(peers, o.LocalAddr())
+			}
+		}
+		sessions[i] = fast(newSession(c, c, peers, bpms[i]))
+	}
+	t.Cleanup(func() {
+		for _, s := range sessions {
+			s.Close()
+		}
+	})
+	return sessions
+}
+
+// fast shortens s's timers so tests settle in milliseconds, then starts it.
+func fast(s *Session) *Session {
+	s.announceInterval = 5 * time.Millisecond
+	s.joinWait = 2 * s.announceInterval
+	s.start()
+	return s
+}
+
+// eventually polls cond for up to half a second, long enough for a fast
+// session to finish joining.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// inPhase reports whether every session agrees on tempo and beat position.
+func inPhase(sessions []*Session) bool {
+	now := time.Now()
+	for _, s := range sessions[1:] {
+		if s.Tempo() != sessions[0].Tempo() || math.Abs(s.BeatAt(now)-sessions[0].BeatAt(now)) > 0.01 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPeersConvergeOnOneTimeline(t *testing.T) {
+	s := mesh(t, 100, 120, 140)
+	eventually(t, "peers to agree", func() bool { return inPhase(s) })
+	for _, p := range s {
+		if p.Peers() != 2 {
+			t.Fatalf("peer sees %d others, want 2", p.Peers())
+		}
+	}
+}
+
+func TestTempoChangePropagatesKeepingPhase(t *testing.T) {
+	s := mesh(t, 120, 120)
+	eventually(t, "peers to agree", func() bool { return inPhase(s) })
+
+	now := time.Now()
+	before := s[1].BeatAt(now)
+	s[1].SetTempo(90)
+	if got := s[1].BeatAt(now); math.Abs(got-before) > 0.01 {
+		t.Fatalf("tempo change moved the beat from %.3f to %.3f", before, got)
+	}
+	eventually(t, "the new tempo to reach the other peer", func() bool {
+		return s[0].Tempo() == 90 && inPhase(s)
+	})
+
+	// A later change from the other side wins in turn.
+	s[0].SetTempo(128)
+	eventually(t, "the second change", func() bool { return s[1].Tempo() == 128 && inPhase(s) })
+}
+
+func TestJoinerAdoptsRunningSession(t *testing.T) {
+	conns := make([]net.PacketConn, 2)
+	for i := range conns {
+		c, err := net.ListenPacket("udp4", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns[i] = c
+	}
+	a := fast(newSession(conns[0], conns[0], []net.Addr{conns[1].LocalAddr()}, 120))
+	defer a.Close()
+	time.Sleep(a.joinWait + a.announceInterval)
+
+	// The joiner gets the lowest id, so only its listening first and the
+	// earlier origin keep it from taking over.
+	defer func(f func() uint64) { newID = f }(newID)
+	newID = func() uint64 { return 0 }
+	at := time.Now()
+	want := a.BeatAt(at)
+	b := fast(newSession(conns[1], conns[1], []net.Addr{conns[0].LocalAddr()}, 90))
+	defer b.Close()
+
+	s := []*Session{a, b}
+	eventually(t, "the joiner to adopt the session", func() bool { return inPhase(s) && a.Peers() == 1 })
+	time.Sleep(2 * a.announceInterval)
+	if a.Tempo() != 120 || math.Abs(a.BeatAt(at)-want) > 0.01 {
+		t.Fatalf("joiner moved the session to %.1f BPM, beat %.3f (was %.3f)", a.Tempo(), a.BeatAt(at), want)
+	}
+	if !inPhase(s) {
+		t.Fatalf("joiner left the session: %.1f BPM, want 120", b.Tempo())
+	}
+}
+
+func TestEqualEpochsKeepTheEarlierOrigin(t *testing.T) {
+	now := time.Now()
+	old := timeline{bpm: 120, origin: now.Add(-time.Minute), author: 9}
+	late := timeline{bpm: 90, origin: now, author: 1}
+	if late.newer(old) || !old.newer(late) {
+		t.Fatal("a later origin won a tie on epoch")
+	}
+	together := timeline{bpm: 90, origin: old.origin.Add(originSlack / 2), author: 1}
+	if !together.newer(old) {
+		t.Fatal("origins within the slack did not fall back to the author id")
+	}
+	if bumped := (timeline{bpm: 100, origin: now, epoch: 1, author: 9}); !bumped.newer(old) {
+		t.Fatal("a higher epoch lost")
+	}
+}
+
+func TestRejectsOutOfRangeTimelines(t *testing.T) {
+	s := mesh(t, 120)[0]
+	for _, p := range []packet{
+		{BPM: 0, Quantum: 4},
+		{BPM: maxBPM + 1, Quantum: 4},
+		{BPM: math.NaN(), Quantum: 4},
+		{BPM: math.Inf(1), Quantum: 4},
+		{BPM: 90, Quantum: 0},
+		{BPM: 90, Quantum: -4},
+		{BPM: 90, Quantum: math.NaN()},
+		{BPM: 90, Quantum: math.Inf(1)},
+	} {
+		p.Peer, p.Author, p.Epoch = 7, 7, 99
+		p.Sent, p.Origin = time.Now().UnixNano(), time.Now().UnixNano()
+		s.merge(p)
+		if s.Tempo() != 120 || s.Quantum() != 4 {
+			t.Fatalf("adopted %.1f BPM, quantum %v from %+v", s.Tempo(), s.Quantum(), p)
+		}
+	}
+	for _, bpm := range []float64{0, -10, maxBPM + 1, math.NaN(), math.Inf(1)} {
+		s.SetTempo(bpm)
+		if s.Tempo() != 120 {
+			t.Fatalf("SetTempo(%v) changed the tempo to %v", bpm, s.Tempo())
+		}
+	}
+}
+
+func TestIgnoresForeignPackets(t *testing.T) {
+	s := mesh(t, 120)
+	c, err := net.Dial("udp4", s[0].in.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Write([]byte("not a sync packet"))
+	c.Write(make([]byte, 64))
+	time.Sleep(20 * time.Millisecond)
+	if s[0].Tempo() != 120 || s[0].Peers() != 0 {
+		t.Fatalf("garbage changed the session: %.1f BPM, %d peers", s[0].Tempo(), s[0].Peers())
+	}
+}
+
+func TestJoinMulticast(t *testing.T) {
+	a, err := joinGroup("", 120)
+	if err != nil {
+		t.Skipf("multicast unavailable: %v", err)
+	}
+	defer fast(a).Close()
+	b, err := joinGroup("", 100)
+	if err != nil {
+		t.Skipf("multicast unavailable: %v", err)
+	}
+	defer fast(b).Close()
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for a.Peers() == 0 || b.Peers() == 0 {
+		if time.Now().After(deadline) {
+			t.Skip("no multicast delivery on this host")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	eventually(t, "multicast peers to agree", func() bool { return inPhase([]*Session{a, b}) })
+}
@@ -0,0 +1,239 @@
+// Package osc speaks Open Sound Control 1.0 over UDP so tunkul can be driven
+// from TouchOSC and similar tools.
+package osc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// bundleTag starts every OSC bundle.
+const bundleTag = "#bundle"
+
+// Message is an OSC message. Args hold int32, float32, string, []byte or
+// bool values.
+type Message struct {
+	Address string
+	Args    []any
+}
+
+func (m Message) String() string {
+	var b strings.Builder
+	b.WriteString(m.Address)
+	for _, a := range m.Args {
+		fmt.Fprintf(&b, " %v", a)
+	}
+	return b.String()
+}
+
+// Int returns argument i as an integer, converting floats and booleans.
+// NaN and infinite floats are rejected.
+func (m Message) Int(i int) (int, bool) {
+	if i >= len(m.Args) {
+		return 0, false
+	}
+	switch v := m.Args[i].(type) {
+	case int32:
+		return int(v), true
+	case float32:
+		if !finite(v) {
+			return 0, false
+		}
+		return int(math.Round(float64(v))), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// Float returns argument i as a float, converting integers and booleans.
+// NaN and infinite floats are rejected, so callers can clamp the result.
+func (m Message) Float(i int) (float64, bool) {
+	if i < len(m.Args) {
+		if f, ok := m.Args[i].(float32); ok {
+			return float64(f), finite(f)
+		}
+	}
+	n, ok := m.Int(i)
+	return float64(n), ok
+}
+
+func finite(f float32) bool {
+	return !math.IsNaN(float64(f)) && !math.IsInf(float64(f), 0)
+}
+
+// MarshalBinary encodes m as an OSC packet.
+func (m Message) MarshalBinary() ([]byte, error) {
+	if !strings.HasPrefix(m.Address, "/") {
+		return nil, fmt.Errorf("osc: address %q must start with /", m.Address)
+	}
+	var buf bytes.Buffer
+	writeString(&buf, m.Address)
+	tags := []byte{','}
+	var data bytes.Buffer
+	for _, a := range m.Args {
+		switch v := a.(type) {
+		case int32:
+			tags = append(tags, 'i')
+			binary.Write(&data, binary.BigEndian, v)
+		case int:
+			tags = append(tags, 'i')
+			binary.Write(&data, binary.BigEndian, int32(v))
+		case float32:
+			tags = append(tags, 'f')
+			binary.Write(&data, binary.BigEndian, v)
+		case float64:
+			tags = append(tags, 'f')
+			binary.Write(&data, binary.BigEndian, float32(v))
+		case string:
+			tags = append(tags, 's')
+			writeString(&data, v)
+		case []byte:
+			tags = append(tags, 'b')
+			binary.Write(&data, binary.BigEndian, int32(len(v)))
+			data.Write(v)
+			data.Write(make([]byte, pad(len(v))))
+		case bool:
+			if v {
+				tags = append(tags, 'T')
+			} else {
+				tags = append(tags, 'F')
+			}
+		default:
+			return nil, fmt.Errorf("osc: unsupported argument type %T", a)
+		}
+	}
+	writeString(&buf, string(tags))
+	buf.Write(data.Bytes())
+	return buf.Bytes(), nil
+}
+
+// Parse decodes a packet into its messages, flattening bundles. Bundle time
+// tags are ignored: messages apply as soon as they arrive.
+func Parse(packet []byte) ([]Message, error) {
+	if len(packet) == 0 || len(packet)%4 != 0 {
+		return nil, fmt.Errorf("osc: packet size %d is not a multiple of 4", len(packet))
+	}
+	if packet[0] == '#' {
+		return parseBundle(packet)
+	}
+	m, err := parseMessage(packet)
+	if err != nil {
+		return nil, err
+	}
+	return []Message{m}, nil
+}
+
+func parseBundle(packet []byte) ([]Message, error) {
+	tag, rest, err := readString(packet)
+	if err != nil || tag != bundleTag || len(rest) < 8 {
+		return nil, errors.New("osc: malformed bundle header")
+	}
+	rest = rest[8:] // time tag
+	var msgs []Message
+	for len(rest) > 0 {
+		if len(rest) < 4 {
+			return nil, errors.New("osc: truncated bundle element")
+		}
+		size := int(binary.BigEndian.Uint32(rest))
+		rest = rest[4:]
+		if size < 0 || size > len(rest) {
+			return nil, errors.New("osc: bundle element overruns packet")
+		}
+		inner, err := Parse(rest[:size])
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, inner...)
+		rest = rest[size:]
+	}
+	return msgs, nil
+}
+
+func parseMessage(packet []byte) (Message, error) {
+	var m Message
+	addr, rest, err := readString(packet)
+	if err != nil {
+		return m, err
+	}
+	if !strings.HasPrefix(addr, "/") {
+		return m, fmt.Errorf("osc: address %q must start with /", addr)
+	}
+	m.Address = addr
+	if len(rest) == 0 {
+		return m, nil // old senders may omit the type tags
+	}
+	tags, rest, err := readString(rest)
+	if err != nil {
+		return m, err
+	}
+	if !strings.HasPrefix(tags, ",") {
+		return m, fmt.Errorf("osc: bad type tag string %q", tags)
+	}
+	for _, t := range tags[1:] {
+		switch t {
+		case 'i', 'f':
+			if len(rest) < 4 {
+				return m, errors.New("osc: truncated argument")
+			}
+			v := binary.BigEndian.Uint32(rest)
+			rest = rest[4:]
+			if t == 'i' {
+				m.Args = append(m.Args, int32(v))
+			} else {
+				m.Args = append(m.Args, math.Float32frombits(v))
+			}
+		case 's':
+			var s string
+			if s, rest, err = readString(rest); err != nil {
+				return m, err
+			}
+			m.Args = append(m.Args, s)
+		case 'b':
+			if len(rest) < 4 {
+				return m, errors.New("osc: truncated blob")
+			}
+			n := int(binary.BigEndian.Uint32(rest))
+			rest = rest[4:]
+			if n < 0 || n+pad(n) > len(rest) {
+				return m, errors.New("osc: truncated blob")
+			}
+			m.Args = append(m.Args, bytes.Clone(rest[:n]))
+			rest = rest[n+pad(n):]
+		case 'T', 'F':
+			m.Args = append(m.Args, t == 'T')
+		default:
+			return m, fmt.Errorf("osc: unsupported type tag %q", t)
+		}
+	}
+	return m, nil
+}
+
+// readString reads a null-terminated, 4-byte aligned OSC string.
+func readString(b []byte) (string, []byte, error) {
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return "", nil, errors.New("osc: unterminated string")
+	}
+	n := i + 1 + pad(i+1)
+	if n > len(b) {
+		return "", nil, errors.New("osc: string padding overruns packet")
+	}
+	return string(b[:i]), b[n:], nil
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	buf.WriteString(s)
+	buf.WriteByte(0)
+	buf.Write(make([]byte, pad(len(s)+1)))
+}
+
+// pad is the number of zero bytes aligning n to 4.
+func pad(n int) int { return (4 - n%4) % 4 }
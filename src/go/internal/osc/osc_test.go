@@ -0,0 +1,139 @@
+package osc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	m := Message{Address: "/tunkul/row/2/mute", Args: []any{int32(1), float32(0.5), "kick", []byte{1, 2, 3}, true, false}}
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data)%4 != 0 {
+		t.Fatalf("packet size %d not aligned", len(data))
+	}
+	got, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !reflect.DeepEqual(got[0], m) {
+		t.Fatalf("got %v want %v", got, m)
+	}
+}
+
+func TestEncodingMatchesSpec(t *testing.T) {
+	data, err := Message{Address: "/bpm", Args: []any{128}}.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte("/bpm\x00\x00\x00\x00,i\x00\x00\x00\x00\x00\x80")
+	if !bytes.Equal(data, want) {
+		t.Fatalf("got %q want %q", data, want)
+	}
+}
+
+func TestParseBundle(t *testing.T) {
+	a, _ := Message{Address: "/a", Args: []any{int32(1)}}.MarshalBinary()
+	b, _ := Message{Address: "/b"}.MarshalBinary()
+	var buf bytes.Buffer
+	buf.WriteString("#bundle\x00")
+	buf.Write(make([]byte, 8)) // time tag
+	for _, el := range [][]byte{a, b} {
+		binary.Write(&buf, binary.BigEndian, int32(len(el)))
+		buf.Write(el)
+	}
+	msgs, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].Address != "/a" || msgs[1].Address != "/b" {
+		t.Fatalf("got %v", msgs)
+	}
+}
+
+func TestParseRejectsGarbage(t *testing.T) {
+	for _, p := range [][]byte{nil, []byte("abc"), []byte("nope"), []byte("/a\x00\x00,i\x00\x00")} {
+		if _, err := Parse(p); err == nil {
+			t.Errorf("parsed %q", p)
+		}
+	}
+}
+
+func TestArgumentConversions(t *testing.T) {
+	m := Message{Args: []any{float32(127.6), int32(3), true, "x"}}
+	if n, ok := m.Int(0); !ok || n != 128 {
+		t.Errorf("Int(0) = %d %t", n, ok)
+	}
+	if f, ok := m.Float(1); !ok || f != 3 {
+		t.Errorf("Float(1) = %v %t", f, ok)
+	}
+	if n, ok := m.Int(2); !ok || n != 1 {
+		t.Errorf("Int(2) = %d %t", n, ok)
+	}
+	if _, ok := m.Int(3); ok {
+		t.Error("string converted to int")
+	}
+	if _, ok := m.Float(4); ok {
+		t.Error("missing argument converted")
+	}
+	for _, f := range []float32{float32(math.NaN()), float32(math.Inf(1)), float32(math.Inf(-1))} {
+		m := Message{Args: []any{f}}
+		if v, ok := m.Float(0); ok {
+			t.Errorf("Float accepted %v", v)
+		}
+		if v, ok := m.Int(0); ok {
+			t.Errorf("Int accepted %v as %d", f, v)
+		}
+	}
+}
+
+func TestServerRepliesToSender(t *testing.T) {
+	s, err := Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	got := make(chan Message, 1)
+	if err := s.Serve(func(m Message) { got <- m }); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := net.DialUDP("udp", nil, s.Addr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	data, _ := Message{Address: "/tunkul/bpm", Args: []any{int32(128)}}.MarshalBinary()
+	if _, err := client.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-got:
+		if n, _ := m.Int(0); m.Address != "/tunkul/bpm" || n != 128 {
+			t.Fatalf("server got %v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("server received nothing")
+	}
+
+	if err := s.Send(Message{Address: "/tunkul/step", Args: []any{int32(3)}}); err != nil {
+		t.Fatal(err)
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 512)
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := Parse(buf[:n])
+	if err != nil || len(msgs) != 1 || msgs[0].Address != "/tunkul/step" {
+		t.Fatalf("client got %v %v", msgs, err)
+	}
+}
@@ -0,0 +1,127 @@
+package osc
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+)
+
+// maxPeers bounds how many senders are remembered for replies.
+const maxPeers = 16
+
+// Handler receives every message the server reads. It runs on the server's
+// goroutine.
+type Handler func(Message)
+
+// Server is an OSC endpoint on a UDP socket. It replies to everyone that has
+// sent it a message, plus any targets added explicitly, so controllers
+// receive tunkul's events without extra setup.
+type Server struct {
+	conn *net.UDPConn
+
+	mu      sync.Mutex
+	peers   []*net.UDPAddr
+	targets []*net.UDPAddr
+	serving bool
+}
+
+// Listen opens a UDP socket on addr, such as ":9000" or "127.0.0.1:0".
+func Listen(addr string) (*Server, error) {
+	ua, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", ua)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{conn: conn}, nil
+}
+
+// Addr is the local address the server is bound to.
+func (s *Server) Addr() net.Addr { return s.conn.LocalAddr() }
+
+// AddTarget sends every future message to addr as well, for controllers
+// that listen on a different port than they send from.
+func (s *Server) AddTarget(addr string) error {
+	ua, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.targets = append(s.targets, ua)
+	s.mu.Unlock()
+	return nil
+}
+
+// Serve reads packets on a new goroutine and hands each message to h until
+// the server is closed. Malformed packets are logged and dropped.
+func (s *Server) Serve(h Handler) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.serving {
+		return errors.New("osc: server already serving")
+	}
+	s.serving = true
+	go s.read(h)
+	return nil
+}
+
+func (s *Server) read(h Handler) {
+	buf := make([]byte, 65536)
+	for {
+		n, from, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("[OSC] read: %v", err)
+			}
+			return
+		}
+		msgs, err := Parse(buf[:n])
+		if err != nil {
+			log.Printf("[OSC] dropping packet from %v: %v", from, err)
+			continue
+		}
+		s.remember(from)
+		for _, m := range msgs {
+			h(m)
+		}
+	}
+}
+
+// remember adds from to the peers replied to, evicting the oldest.
+func (s *Server) remember(from *net.UDPAddr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.peers {
+		if p.IP.Equal(from.IP) && p.Port == from.Port {
+			return
+		}
+	}
+	if len(s.peers) == maxPeers {
+		s.peers = s.peers[1:]
+	}
+	s.peers = append(s.peers, from)
+}
+
+// Send delivers m to every peer and target.
+func (s *Server) Send(m Message) error {
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	dests := append(append([]*net.UDPAddr(nil), s.peers...), s.targets...)
+	s.mu.Unlock()
+	var errs []error
+	for _, d := range dests {
+		if _, err := s.conn.WriteToUDP(data, d); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops serving and releases the socket.
+func (s *Server) Close() error { return s.conn.Close() }
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/ingyamilmolinar/tunkul/core/model"
+	"github.com/ingyamilmolinar/tunkul/internal/audio"
 )
 
 // RunDemo builds a simple circuit and starts playback, then exits after a short delay.
@@ -14,10 +15,10 @@ func (g *Game) RunDemo() {
 	g.addEdge(a, b)
 	g.playing = true
 	g.engine.Start()
-	g.spawnPulseFrom(0)
 	go func() {
 		time.Sleep(2 * time.Second)
 		g.logger.Infof("[DEMO] Finished demo run")
+		audio.Reset() // closes the backend, finalising a file capture
 		os.Exit(0)
 	}()
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"maps"
 	"slices"
 	"strconv"
 	"strings"
@@ -11,9 +12,11 @@ import (
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/ingyamilmolinar/tunkul/core/engine"
 	"github.com/ingyamilmolinar/tunkul/core/model"
 	"github.com/ingyamilmolinar/tunkul/internal/audio"
 	game_log "github.com/ingyamilmolinar/tunkul/internal/log"
+	"github.com/ingyamilmolinar/tunkul/internal/midi"
 )
 
 const (
@@ -25,20 +28,35 @@ const (
 	timelineHeight    = 110
 	timelineBarHeight = 10
 	buttonPad         = 2
+	// maxLength bounds the number of steps in a pattern.
+	maxLength = 64
 )
 
 /* ───────────────────────────────────────────────────────────── */
 
 type DrumRow struct {
-	Name       string
-	Instrument string
-	Steps      []bool
-	Color      color.Color
-	Origin     model.NodeID
-	Node       *uiNode
-	Volume     float64
-	Muted      bool
-	Solo       bool
+	Name        string
+	Instrument  string
+	Steps       []bool
+	Color       color.Color
+	Origin      model.NodeID
+	Node        *uiNode
+	Volume      float64
+	Pan         float64 // stereo position, -1 left .. 1 right
+	Choke       int     // choke group, 0 for none
+	Muted       bool
+	Solo        bool
+	Params      audio.DrumParams     // synthesis knobs for built-in drums
+	Effects     audio.EffectSettings // per-row effects chain
+	MIDIChannel int                  // MIDI output channel 1-16, 0 for none
+	MIDINote    int                  // MIDI note sent for each hit
+	Length      int                  // beats before the row starts over, 0 to follow its path
+	Rate        engine.Rate          // row beats per master beat
+	Euclid      model.Euclid         // rhythm the FX panel generates for the row
+	Mutations   int                  // steps the mutate tool flips
+	Bus         int                  // effects bus, kept for the row's lifetime
+
+	period int // beats per lap as played, 0 if the row does not repeat
 }
 
 func instColor(id string) color.Color {
@@ -81,6 +99,25 @@ type DrumView struct {
 	lenIncBtn *Button // increase length
 	uploadBtn *Button
 	saveBtn   *Button
+	learnBtn  *Button
+	quantBtn  *Button
+
+	// launch quantization of edits made while playing, and whether an edit
+	// is waiting for its boundary
+	Quantize engine.Quantize
+	pending  bool
+
+	// MIDI learn: the control waiting for a note or CC, and learned CCs
+	learning    bool
+	learnTarget *midiTarget
+	ccMap       map[midiControl]midiTarget
+
+	// master bus level meter and gain fader
+	masterMeter *LevelMeter
+
+	// synthesis knobs acting on the selected row
+	synthKnobs []*Knob
+	activeKnob int // index of knob capturing mouse events, -1 if none
 
 	// per-row components
 	addRowBtn     *Button
@@ -88,11 +125,15 @@ type DrumView struct {
 	rowEditBtns   []*Button
 	rowDeleteBtns []*Button
 	rowVolSliders []*Slider
+	rowPanSliders []*Slider
 	rowOriginBtns []*Button
 	rowMuteBtns   []*Button
 	rowSoloBtns   []*Button
+	rowFXBtns     []*Button
+	rowChokeBtns  []*Button
 	selRow        int
 	activeSlider  int // index of slider capturing mouse events, -1 if none
+	activePan     int // index of pan slider capturing mouse events, -1 if none
 
 	// instrument selection dropdown
 	instMenuOpen bool
@@ -100,9 +141,15 @@ type DrumView struct {
 	instMenuBtns []*Button
 	instHold     bool
 
+	// effects popover for a single row, nil when closed
+	fx *FXPanel
+
 	deleted    []deletedRow
 	added      []int
 	originReq  []int
+	euclidReq  []int
+	toolReq    []rowToolRequest
+	stepReq    [][2]int // row and beat of each cell clicked
 	renameRow  int
 	renameBox  *TextInput
 	renameHold bool
@@ -120,6 +167,7 @@ type DrumView struct {
 
 	timelineRect  image.Rectangle // progress bar for fast seek
 	timelineBeats int             // total beats represented by timeline
+	Cycle         int             // beats until every row lines up again
 
 	// internal ui state
 	bpm           int
@@ -154,6 +202,7 @@ type DrumView struct {
 	dragging      bool
 	dragStartX    int
 	startOffset   int
+	pressCell     [2]int // row and beat under the press that began the drag, row -1 for none
 	offsetChanged bool
 
 	rowOffset      int
@@ -167,17 +216,22 @@ type DrumView struct {
 // Capturing reports whether the drum view is actively handling a mouse drag
 // (e.g. scrollbar or slider) and should therefore block camera panning.
 func (dv *DrumView) Capturing() bool {
-	return dv.scrollDrag || dv.activeSlider >= 0
+	return dv.scrollDrag || dv.activeSlider >= 0 || dv.activePan >= 0 || dv.activeKnob >= 0 || dv.masterMeter.dragging || (dv.fx != nil && dv.fx.Capturing())
 }
 
 // BlocksAt reports whether a point (x,y) lies over a temporary overlay such as
-// the instrument dropdown or rename dialog. When true, clicks at that position
+// the instrument dropdown, effects panel or rename dialog. When true, clicks at that position
 // should not reach underlying UI elements.
 func (dv *DrumView) BlocksAt(x, y int) bool {
 	if dv.instMenuOpen || dv.instHold || dv.renameBox != nil || dv.naming {
 		return true
 	}
-	return false
+	return dv.fx != nil && pt(x, y, dv.fx.Rect())
+}
+
+// Typing reports whether a text field has the keyboard.
+func (dv *DrumView) Typing() bool {
+	return dv.focusBPM || dv.renameBox != nil || dv.naming
 }
 
 type deletedRow struct {
@@ -255,7 +309,10 @@ func NewDrumView(b image.Rectangle, g *model.Graph, logger *game_log.Logger) *Dr
 		timelineBeats: 8,
 		selRow:        0,
 		activeSlider:  -1,
+		activePan:     -1,
+		activeKnob:    -1,
 		renameRow:     -1,
+		ccMap:         map[midiControl]midiTarget{},
 	}
 	dv.playBtn = NewButton("▶", PlayButtonStyle, func() {
 		dv.playPressed = true
@@ -300,13 +357,22 @@ func NewDrumView(b image.Rectangle, g *model.Graph, logger *game_log.Logger) *Dr
 		}
 	})
 	dv.saveBtn = NewButton("Save", InstButtonStyle, nil)
+	dv.learnBtn = NewButton("Learn", InstButtonStyle, dv.toggleLearn)
+	dv.quantBtn = NewButton("Q:Off", InstButtonStyle, func() {
+		dv.Quantize = (dv.Quantize + 1) % (engine.QuantizeLoop + 1)
+		dv.logger.Infof("[DRUMVIEW] Launch quantize: %v", dv.Quantize)
+	})
 	dv.addRowBtn = NewButton("+", InstButtonStyle, func() {
 		dv.AddRow()
 		dv.selRow = len(dv.Rows) - 1
 	})
 	dv.addRowBtn.Repeat = true
+	for _, name := range audio.ParamNames {
+		dv.synthKnobs = append(dv.synthKnobs, NewKnob(name, 0))
+	}
+	dv.masterMeter = NewLevelMeter(audio.MasterGain())
 
-	dv.Rows = []*DrumRow{{Name: name, Instrument: inst, Steps: make([]bool, dv.Length), Color: instColor(inst), Origin: model.InvalidNodeID, Volume: 1}}
+	dv.Rows = []*DrumRow{{Name: name, Instrument: inst, Steps: make([]bool, dv.Length), Color: instColor(inst), Origin: model.InvalidNodeID, Volume: 1, MIDIChannel: midi.DrumChannel, MIDINote: midi.DefaultNote(inst), Bus: 1}}
 	dv.SetBeatLength(dv.Length) // Initialize graph's beat length
 	dv.recalcButtons()
 	if dv.bgDirty {
@@ -339,10 +405,11 @@ func (dv *DrumView) AddRow() {
 		name = strings.ToUpper(inst[:1]) + inst[1:]
 	}
 	idx := len(dv.Rows)
-	dv.Rows = append(dv.Rows, &DrumRow{Name: name, Instrument: inst, Steps: make([]bool, dv.Length), Color: instColor(inst), Origin: model.InvalidNodeID, Node: nil, Volume: 1})
+	dv.Rows = append(dv.Rows, &DrumRow{Name: name, Instrument: inst, Steps: make([]bool, dv.Length), Color: instColor(inst), Origin: model.InvalidNodeID, Node: nil, Volume: 1, MIDIChannel: midi.DrumChannel, MIDINote: midi.DefaultNote(inst), Bus: dv.newBus()})
 	dv.added = append(dv.added, idx)
 	dv.bgDirty = true
 	dv.activeSlider = -1
+	dv.activePan = -1
 	dv.calcLayout()
 	maxOff := len(dv.Rows) + 1 - dv.visibleRows()
 	if maxOff < 0 {
@@ -353,16 +420,62 @@ func (dv *DrumView) AddRow() {
 	}
 }
 
+// newBus returns the lowest effects bus no row uses. Bus 0 is the dry bus.
+func (dv *DrumView) newBus() int {
+	used := map[int]bool{}
+	for _, r := range dv.Rows {
+		used[r.Bus] = true
+	}
+	bus := 1
+	for used[bus] {
+		bus++
+	}
+	return bus
+}
+
+// setRows replaces every row, as when a saved project is loaded. Rows must
+// not be empty.
+func (dv *DrumView) setRows(rows []*DrumRow) {
+	for _, r := range dv.Rows {
+		releaseBus(r.Bus)
+	}
+	dv.Rows = rows
+	for i, r := range rows {
+		r.Steps = make([]bool, dv.Length)
+		r.Bus = i + 1
+	}
+	dv.added, dv.deleted, dv.originReq, dv.euclidReq, dv.toolReq, dv.stepReq = nil, nil, nil, nil, nil, nil
+	dv.selRow = 0
+	dv.rowOffset = 0
+	dv.fx = nil
+	maps.DeleteFunc(dv.ccMap, func(_ midiControl, t midiTarget) bool { return t.Param != midiBPM })
+	dv.learnTarget = nil
+	dv.activeSlider = -1
+	dv.activePan = -1
+	dv.bgDirty = true
+	dv.calcLayout()
+}
+
 // DeleteRow removes the drum row at the given index.
 func (dv *DrumView) DeleteRow(i int) {
 	if i < 0 || i >= len(dv.Rows) || len(dv.Rows) <= 1 {
 		return
 	}
 	origin := dv.Rows[i].Origin
+	releaseBus(dv.Rows[i].Bus)
 	dv.Rows = append(dv.Rows[:i], dv.Rows[i+1:]...)
 	dv.deleted = append(dv.deleted, deletedRow{index: i, origin: origin})
+	dv.dropLearnedRow(i)
 	dv.bgDirty = true
 	dv.activeSlider = -1
+	dv.activePan = -1
+	if dv.fx != nil {
+		if dv.fx.Row == i {
+			dv.fx = nil
+		} else if dv.fx.Row > i {
+			dv.fx.Row--
+		}
+	}
 	if dv.selRow >= len(dv.Rows) {
 		dv.selRow = len(dv.Rows) - 1
 	}
@@ -439,12 +552,51 @@ func (dv *DrumView) ConsumeOriginRequests() []int {
 	return rows
 }
 
+// ConsumeEuclidRequests returns and clears indexes of rows waiting to place
+// a generated Euclidean loop.
+func (dv *DrumView) ConsumeEuclidRequests() []int {
+	rows := dv.euclidReq
+	dv.euclidReq = nil
+	return rows
+}
+
+// ConsumeToolRequests returns and clears the pattern tools pressed since the
+// last call, in order.
+func (dv *DrumView) ConsumeToolRequests() []rowToolRequest {
+	reqs := dv.toolReq
+	dv.toolReq = nil
+	return reqs
+}
+
+// ConsumeStepToggles returns and clears the row and beat of each drum cell
+// clicked since the last call, in order.
+func (dv *DrumView) ConsumeStepToggles() [][2]int {
+	cells := dv.stepReq
+	dv.stepReq = nil
+	return cells
+}
+
+// cellAt returns the row and absolute beat of the drum cell at (x, y).
+func (dv *DrumView) cellAt(x, y int) (row, beat int, ok bool) {
+	x0 := dv.Bounds.Min.X + dv.labelW + dv.controlsW
+	y0 := dv.Bounds.Min.Y + timelineHeight
+	if dv.cell <= 0 || x < x0 || y < y0 || x >= dv.scrollBarRect().Min.X || y >= dv.Bounds.Max.Y {
+		return 0, 0, false
+	}
+	col := (x - x0) / dv.cell
+	row = dv.rowOffset + (y-y0)/dv.rowHeight()
+	if col >= dv.Length || row >= len(dv.Rows) || row >= dv.rowOffset+dv.visibleRows() {
+		return 0, 0, false
+	}
+	return row, dv.Offset + col, true
+}
+
 /* ─── public update ────────────────────────────────────────── */
 
 func (dv *DrumView) recalcButtons() {
 	dv.controlsW = dv.Bounds.Dx() / 4
-	if dv.controlsW < 140 {
-		dv.controlsW = 140
+	if dv.controlsW < 160 {
+		dv.controlsW = 160
 	}
 	if dv.controlsW > 320 {
 		dv.controlsW = 320
@@ -461,8 +613,24 @@ func (dv *DrumView) recalcButtons() {
 	dv.lenIncBtn.SetRect(insetRect(topGrid.Cell(6, 0), buttonPad))
 
 	botBounds := image.Rect(dv.Bounds.Min.X+dv.labelW, dv.Bounds.Min.Y+dv.rowHeight(), dv.Bounds.Min.X+dv.labelW+dv.controlsW, dv.Bounds.Min.Y+2*dv.rowHeight())
-	botGrid := NewGridLayout(botBounds, []float64{1}, []float64{1})
+	botGrid := NewGridLayout(botBounds, []float64{4, 3, 4, 2}, []float64{1})
 	dv.uploadBtn.SetRect(insetRect(botGrid.Cell(0, 0), buttonPad))
+	dv.learnBtn.SetRect(insetRect(botGrid.Cell(1, 0), buttonPad))
+	dv.quantBtn.SetRect(insetRect(botGrid.Cell(2, 0), buttonPad))
+	dv.masterMeter.SetRect(insetRect(botGrid.Cell(3, 0), buttonPad))
+
+	knobBounds := image.Rect(dv.Bounds.Min.X+dv.labelW, dv.Bounds.Min.Y+2*dv.rowHeight(), dv.Bounds.Min.X+dv.labelW+dv.controlsW, dv.Bounds.Min.Y+3*dv.rowHeight())
+	cols := make([]float64, len(dv.synthKnobs))
+	for i := range cols {
+		cols[i] = 1
+	}
+	knobGrid := NewGridLayout(knobBounds, cols, []float64{1})
+	for i, k := range dv.synthKnobs {
+		c := knobGrid.Cell(i, 0)
+		side := min(c.Dx(), c.Dy()) - 2*buttonPad
+		x := c.Min.X + (c.Dx()-side)/2
+		k.SetRect(image.Rect(x, c.Min.Y+buttonPad, x+side, c.Min.Y+buttonPad+side))
+	}
 
 	top := dv.Bounds.Min.Y + timelineHeight - timelineBarHeight - 5
 	dv.timelineRect = image.Rect(
@@ -481,9 +649,12 @@ func (dv *DrumView) calcLayout() {
 	dv.rowEditBtns = dv.rowEditBtns[:0]
 	dv.rowDeleteBtns = dv.rowDeleteBtns[:0]
 	dv.rowVolSliders = dv.rowVolSliders[:0]
+	dv.rowPanSliders = dv.rowPanSliders[:0]
 	dv.rowOriginBtns = dv.rowOriginBtns[:0]
 	dv.rowMuteBtns = dv.rowMuteBtns[:0]
 	dv.rowSoloBtns = dv.rowSoloBtns[:0]
+	dv.rowFXBtns = dv.rowFXBtns[:0]
+	dv.rowChokeBtns = dv.rowChokeBtns[:0]
 	vis := dv.visibleRows()
 	for i := range dv.Rows {
 		y := dv.Bounds.Min.Y + timelineHeight + (i-dv.rowOffset)*dv.rowHeight()
@@ -491,7 +662,7 @@ func (dv *DrumView) calcLayout() {
 		if i < dv.rowOffset || i >= dv.rowOffset+vis {
 			rowRect = image.Rect(0, 0, 0, 0)
 		}
-		g := NewGridLayout(rowRect, []float64{6, 2, 5, 2, 2, 2, 2}, []float64{1})
+		g := NewGridLayout(rowRect, []float64{6, 2, 6, 3, 2, 2, 2, 2, 2, 2}, []float64{1})
 		lbl := NewButton(dv.Rows[i].Name, InstButtonStyle, nil)
 		lbl.SetRect(insetRect(g.Cell(0, 0), buttonPad))
 		idx := i
@@ -522,14 +693,21 @@ func (dv *DrumView) calcLayout() {
 		}
 		slider := NewSlider(dv.Rows[i].Volume)
 		slider.SetRect(insetRect(g.Cell(2, 0), buttonPad))
+		pan := NewSlider((dv.Rows[i].Pan + 1) / 2)
+		pan.Format = panLabel
+		pan.SetRect(insetRect(g.Cell(3, 0), buttonPad))
 		mute := NewButton("M", InstButtonStyle, nil)
-		mute.SetRect(insetRect(g.Cell(3, 0), buttonPad))
+		mute.SetRect(insetRect(g.Cell(4, 0), buttonPad))
 		solo := NewButton("S", InstButtonStyle, nil)
-		solo.SetRect(insetRect(g.Cell(4, 0), buttonPad))
+		solo.SetRect(insetRect(g.Cell(5, 0), buttonPad))
+		choke := NewButton(chokeLabel(dv.Rows[i].Choke), InstButtonStyle, nil)
+		choke.SetRect(insetRect(g.Cell(6, 0), buttonPad))
+		fx := NewButton("FX", InstButtonStyle, nil)
+		fx.SetRect(insetRect(g.Cell(7, 0), buttonPad))
 		origin := NewButton("O", InstButtonStyle, nil)
-		origin.SetRect(insetRect(g.Cell(5, 0), buttonPad))
+		origin.SetRect(insetRect(g.Cell(8, 0), buttonPad))
 		del := NewButton("X", InstButtonStyle, nil)
-		del.SetRect(insetRect(g.Cell(6, 0), buttonPad))
+		del.SetRect(insetRect(g.Cell(9, 0), buttonPad))
 		delIdx := i
 		if len(dv.Rows) > 1 {
 			del.OnClick = func() { dv.DeleteRow(delIdx) }
@@ -542,11 +720,18 @@ func (dv *DrumView) calcLayout() {
 		mute.OnClick = func() { dv.toggleMute(muteIdx) }
 		soloIdx := i
 		solo.OnClick = func() { dv.toggleSolo(soloIdx) }
+		fxIdx := i
+		fx.OnClick = func() { dv.toggleFX(fxIdx) }
+		chokeIdx := i
+		choke.OnClick = func() { dv.cycleChoke(chokeIdx) }
 		dv.rowLabels = append(dv.rowLabels, lbl)
 		dv.rowEditBtns = append(dv.rowEditBtns, edit)
 		dv.rowVolSliders = append(dv.rowVolSliders, slider)
+		dv.rowPanSliders = append(dv.rowPanSliders, pan)
 		dv.rowMuteBtns = append(dv.rowMuteBtns, mute)
 		dv.rowSoloBtns = append(dv.rowSoloBtns, solo)
+		dv.rowFXBtns = append(dv.rowFXBtns, fx)
+		dv.rowChokeBtns = append(dv.rowChokeBtns, choke)
 		dv.rowOriginBtns = append(dv.rowOriginBtns, origin)
 		dv.rowDeleteBtns = append(dv.rowDeleteBtns, del)
 	}
@@ -579,6 +764,60 @@ func (dv *DrumView) buildInstMenu() {
 	}
 }
 
+// cycleChoke moves row idx to the next choke group, wrapping back to none.
+func (dv *DrumView) cycleChoke(idx int) {
+	if idx < 0 || idx >= len(dv.Rows) {
+		return
+	}
+	r := dv.Rows[idx]
+	r.Choke = (r.Choke + 1) % (audio.ChokeGroups + 1)
+	dv.logger.Debugf("[DRUMVIEW] Row %d choke group %d", idx, r.Choke)
+}
+
+// chokeLabel is the button text for a choke group.
+func chokeLabel(group int) string {
+	if group == 0 {
+		return "C-"
+	}
+	return "C" + strconv.Itoa(group)
+}
+
+// toggleFX opens the effects panel for row idx, or closes it if it is
+// already showing that row.
+func (dv *DrumView) toggleFX(idx int) {
+	if idx < 0 || idx >= len(dv.Rows) {
+		return
+	}
+	dv.instMenuOpen = false
+	if dv.fx != nil && dv.fx.Row == idx {
+		dv.logger.Debugf("[DRUMVIEW] Closing effects panel for row %d", idx)
+		dv.fx = nil
+		return
+	}
+	dv.selRow = idx
+	dv.fx = NewFXPanel(idx, dv.Rows[idx])
+	dv.fx.OnEuclid = func() { dv.euclidReq = append(dv.euclidReq, idx) }
+	dv.fx.OnTool = func(t rowTool) { dv.toolReq = append(dv.toolReq, rowToolRequest{idx, t}) }
+	dv.placeFX()
+	dv.logger.Debugf("[DRUMVIEW] Opening effects panel for row %d", idx)
+}
+
+// placeFX anchors the effects panel below its row, or above it when there is
+// no room left at the bottom of the view.
+func (dv *DrumView) placeFX() {
+	if dv.fx == nil || dv.fx.Row >= len(dv.rowLabels) {
+		return
+	}
+	base := dv.rowLabels[dv.fx.Row].Rect()
+	h := 6 * dv.rowHeight()
+	x0, x1 := dv.Bounds.Min.X, dv.Bounds.Min.X+dv.labelW+dv.controlsW
+	y := base.Max.Y + buttonPad
+	if y+h > dv.Bounds.Max.Y {
+		y = base.Min.Y - buttonPad - h
+	}
+	dv.fx.SetRect(image.Rect(x0, y, x1, y+h))
+}
+
 func (dv *DrumView) refreshInstruments() {
 	opts := audio.Instruments()
 	if !slices.Equal(opts, dv.instOptions) {
@@ -589,6 +828,20 @@ func (dv *DrumView) refreshInstruments() {
 	}
 }
 
+// syncKnobs points the synthesis knobs at the selected row's parameters.
+func (dv *DrumView) syncKnobs() {
+	if dv.selRow < 0 || dv.selRow >= len(dv.Rows) {
+		return
+	}
+	r := dv.Rows[dv.selRow]
+	for i, k := range dv.synthKnobs {
+		k.Disabled = !audio.Parametric(r.Instrument)
+		if i != dv.activeKnob {
+			k.Value = r.Params.Get(i)
+		}
+	}
+}
+
 func (dv *DrumView) PlayPressed() bool {
 	if dv.playPressed {
 		dv.playPressed = false
@@ -653,6 +906,7 @@ func (dv *DrumView) SetInstrument(id string) {
 		dv.Rows[dv.selRow].Name = strings.ToUpper(id[:1]) + id[1:]
 	}
 	dv.Rows[dv.selRow].Color = instColor(id)
+	dv.Rows[dv.selRow].MIDINote = midi.DefaultNote(id)
 	if dv.selRow < len(dv.rowLabels) {
 		dv.rowLabels[dv.selRow].Text = dv.Rows[dv.selRow].Name
 	}
@@ -879,12 +1133,24 @@ func (dv *DrumView) Update() {
 		return
 	}
 
+	if dv.fx != nil {
+		dv.placeFX()
+		if dv.fx.Update(mx, my, left) {
+			return
+		}
+		if left && !pt(mx, my, dv.rowFXBtns[dv.fx.Row].Rect()) {
+			dv.fx = nil
+			dv.instHold = true
+			return
+		}
+	}
+
 	stepsRect := image.Rect(dv.Bounds.Min.X+dv.labelW+dv.controlsW, dv.Bounds.Min.Y+timelineHeight, dv.Bounds.Max.X, dv.Bounds.Max.Y)
 
 	// wheel zoom for length adjustment
 	if _, whY := wheel(); whY != 0 {
 		if pt(mx, my, stepsRect) {
-			if whY > 0 && dv.Length < 64 {
+			if whY > 0 && dv.Length < maxLength {
 				dv.Length++
 				for _, r := range dv.Rows {
 					r.Steps = make([]bool, dv.Length)
@@ -905,7 +1171,49 @@ func (dv *DrumView) Update() {
 		}
 	}
 
+	/* ——— MIDI learn: clicks pick a target instead of acting ——— */
+	if dv.learnBtn.Handle(mx, my, left) {
+		return
+	}
+	if dv.learning {
+		if left {
+			if t, _, ok := dv.learnTargetAt(mx, my); ok {
+				dv.learnTarget = &t
+				dv.logger.Debugf("[DRUMVIEW] MIDI learn target %+v", t)
+			}
+			dv.instHold = true
+		}
+		return
+	}
+
 	/* ——— widget clicks & dragging ——— */
+	if dv.masterMeter.Handle(mx, my, left) {
+		setMasterGain(dv.masterMeter.Gain)
+		return
+	}
+	dv.syncKnobs()
+	if dv.activeKnob >= 0 {
+		k := dv.synthKnobs[dv.activeKnob]
+		if k.Handle(mx, my, left) {
+			r := dv.Rows[dv.selRow]
+			r.Params = r.Params.Set(dv.activeKnob, k.Value)
+		}
+		if !left {
+			dv.activeKnob = -1
+		}
+		return
+	}
+	for i, k := range dv.synthKnobs {
+		if k.Handle(mx, my, left) {
+			r := dv.Rows[dv.selRow]
+			r.Params = r.Params.Set(i, k.Value)
+			dv.activeKnob = i
+			if !left {
+				dv.activeKnob = -1
+			}
+			return
+		}
+	}
 	if dv.activeSlider >= 0 {
 		s := dv.rowVolSliders[dv.activeSlider]
 		if s.Handle(mx, my, left) {
@@ -916,6 +1224,16 @@ func (dv *DrumView) Update() {
 		}
 		return
 	}
+	if dv.activePan >= 0 {
+		s := dv.rowPanSliders[dv.activePan]
+		if s.Handle(mx, my, left) {
+			dv.Rows[dv.activePan].Pan = s.Value*2 - 1
+		}
+		if !left {
+			dv.activePan = -1
+		}
+		return
+	}
 	for i, s := range dv.rowVolSliders {
 		if s.Handle(mx, my, left) {
 			dv.Rows[i].Volume = s.Value
@@ -926,6 +1244,16 @@ func (dv *DrumView) Update() {
 			return
 		}
 	}
+	for i, s := range dv.rowPanSliders {
+		if s.Handle(mx, my, left) {
+			dv.Rows[i].Pan = s.Value*2 - 1
+			dv.activePan = i
+			if !left {
+				dv.activePan = -1
+			}
+			return
+		}
+	}
 
 	handled := false
 	if !dv.dragging {
@@ -949,6 +1277,16 @@ func (dv *DrumView) Update() {
 				handled = true
 			}
 		}
+		for _, btn := range dv.rowFXBtns {
+			if btn.Handle(mx, my, left) {
+				handled = true
+			}
+		}
+		for _, btn := range dv.rowChokeBtns {
+			if btn.Handle(mx, my, left) {
+				handled = true
+			}
+		}
 		for _, btn := range dv.rowEditBtns {
 			if btn.Handle(mx, my, left) {
 				handled = true
@@ -962,7 +1300,7 @@ func (dv *DrumView) Update() {
 		if handled && left {
 			return
 		}
-		buttons := []*Button{dv.playBtn, dv.stopBtn, dv.bpmDecBtn, dv.bpmIncBtn, dv.lenDecBtn, dv.lenIncBtn, dv.addRowBtn, dv.uploadBtn}
+		buttons := []*Button{dv.playBtn, dv.stopBtn, dv.bpmDecBtn, dv.bpmIncBtn, dv.lenDecBtn, dv.lenIncBtn, dv.addRowBtn, dv.uploadBtn, dv.quantBtn}
 		for _, btn := range buttons {
 			if handled {
 				break
@@ -991,12 +1329,22 @@ func (dv *DrumView) Update() {
 				dv.dragging = true
 				dv.dragStartX = mx
 				dv.startOffset = dv.Offset
+				dv.pressCell = [2]int{-1, 0}
+				if row, beat, ok := dv.cellAt(mx, my); ok {
+					dv.pressCell = [2]int{row, beat}
+				}
 			} else if dv.focusBPM {
 				dv.focusBPM = false
 				dv.logger.Debugf("[DRUMVIEW] Clicked outside BPM box. focusingBPM: %t", dv.focusBPM)
 			}
 		}
 	} else {
+		// A press and release on the same cell without scrolling is a click.
+		if dv.dragging && dv.pressCell[0] >= 0 && dv.Offset == dv.startOffset {
+			if row, beat, ok := dv.cellAt(mx, my); ok && [2]int{row, beat} == dv.pressCell {
+				dv.stepReq = append(dv.stepReq, dv.pressCell)
+			}
+		}
 		dv.dragging = false
 	}
 
@@ -1092,7 +1440,7 @@ func (dv *DrumView) Update() {
 
 	/* ——— Length editing ——— */
 	if dv.lenIncPressed {
-		if dv.Length < 64 { // Set a reasonable max length
+		if dv.Length < maxLength {
 			dv.Length++
 			dv.logger.Infof("[DRUMVIEW] Length increased to: %d", dv.Length)
 			for _, r := range dv.Rows {
@@ -1145,6 +1493,17 @@ func (dv *DrumView) Draw(dst *ebiten.Image, highlightedBeats map[int]int64, fram
 	dv.lenDecBtn.Draw(dst)
 	dv.lenIncBtn.Draw(dst)
 	dv.uploadBtn.Draw(dst)
+	dv.learnBtn.pressed = dv.learning
+	dv.learnBtn.Draw(dst)
+	dv.quantBtn.Text = "Q:" + dv.Quantize.String()
+	dv.quantBtn.pressed = dv.pending
+	dv.quantBtn.Draw(dst)
+	dv.masterMeter.Levels = masterLevels()
+	dv.masterMeter.Draw(dst)
+	dv.syncKnobs()
+	for _, k := range dv.synthKnobs {
+		k.Draw(dst)
+	}
 	// timeline and progress
 	if dv.timelineBeats < dv.Graph.BeatLength() {
 		dv.timelineBeats = dv.Graph.BeatLength()
@@ -1155,6 +1514,9 @@ func (dv *DrumView) Draw(dst *ebiten.Image, highlightedBeats map[int]int64, fram
 	if dv.Offset+dv.Length > dv.timelineBeats {
 		dv.timelineBeats = dv.Offset + dv.Length
 	}
+	if dv.Cycle > dv.timelineBeats {
+		dv.timelineBeats = dv.Cycle
+	}
 	totalBeats := dv.timelineBeats
 	info := dv.timelineInfo(elapsedBeats)
 	ebitenutil.DebugPrintAt(dst, info, dv.timelineRect.Min.X, dv.Bounds.Min.Y+5)
@@ -1166,11 +1528,19 @@ func (dv *DrumView) Draw(dst *ebiten.Image, highlightedBeats map[int]int64, fram
 	viewRect := image.Rect(viewStart, dv.timelineRect.Min.Y, viewStart+viewWidth, dv.timelineRect.Max.Y)
 	drawRect(dst, viewRect, colTimelineView, true)
 
-	// beat markers
-	for i := 0; i <= totalBeats; i++ {
+	// beat markers, thinned out so long cycles do not fill the bar
+	every := max(1, 2*totalBeats/max(dv.timelineRect.Dx(), 1))
+	for i := 0; i <= totalBeats; i += every {
 		x := dv.timelineRect.Min.X + int(float64(i)/float64(totalBeats)*float64(dv.timelineRect.Dx()))
 		drawRect(dst, image.Rect(x, dv.timelineRect.Min.Y, x+1, dv.timelineRect.Max.Y), color.RGBA{100, 100, 100, 255}, true)
 	}
+	// where all rows line up again
+	if dv.Cycle > 1 {
+		for i := dv.Cycle; i <= totalBeats; i += dv.Cycle {
+			x := dv.timelineRect.Min.X + int(float64(i)/float64(totalBeats)*float64(dv.timelineRect.Dx()))
+			drawRect(dst, image.Rect(x-1, dv.timelineRect.Min.Y, x+1, dv.timelineRect.Max.Y), colTimelineCycle, true)
+		}
+	}
 
 	// current playback cursor
 	cursorX := dv.timelineRect.Min.X + int(float64(elapsedBeats)/float64(totalBeats)*float64(dv.timelineRect.Dx()))
@@ -1191,10 +1561,15 @@ func (dv *DrumView) Draw(dst *ebiten.Image, highlightedBeats map[int]int64, fram
 		}
 		dv.rowEditBtns[i].Draw(dst)
 		dv.rowVolSliders[i].Draw(dst)
+		dv.rowPanSliders[i].Draw(dst)
 		dv.rowMuteBtns[i].pressed = dv.Rows[i].Muted
 		dv.rowSoloBtns[i].pressed = dv.Rows[i].Solo
 		dv.rowMuteBtns[i].Draw(dst)
 		dv.rowSoloBtns[i].Draw(dst)
+		dv.rowFXBtns[i].pressed = dv.fx != nil && dv.fx.Row == i
+		dv.rowFXBtns[i].Draw(dst)
+		dv.rowChokeBtns[i].Text = chokeLabel(r.Choke)
+		dv.rowChokeBtns[i].Draw(dst)
 		dv.rowOriginBtns[i].Draw(dst)
 		dv.rowDeleteBtns[i].Draw(dst)
 		for j, step := range r.Steps {
@@ -1216,6 +1591,10 @@ func (dv *DrumView) Draw(dst *ebiten.Image, highlightedBeats map[int]int64, fram
 			}
 
 			DrumCellUI.Draw(dst, rect, step, highlighted, r.Color)
+			if pos := j + dv.Offset; r.period > 0 && pos > 0 && pos%r.period == 0 {
+				// the row starts over here
+				drawRect(dst, image.Rect(x, y, x+2, y+dv.rowHeight()), colRowWrap, true)
+			}
 		}
 	}
 
@@ -1237,7 +1616,19 @@ func (dv *DrumView) Draw(dst *ebiten.Image, highlightedBeats map[int]int64, fram
 			btn.Draw(dst)
 		}
 	}
+	if dv.fx != nil {
+		dv.placeFX()
+		dv.fx.Draw(dst)
+	}
 
+	if dv.learning {
+		msg := "MIDI learn: click a control"
+		if r := dv.learnRect(); !r.Empty() {
+			drawRect(dst, r.Inset(-2), colHighlight, false)
+			msg = "MIDI learn: play a pad or move a knob"
+		}
+		ebitenutil.DebugPrintAt(dst, msg, dv.learnBtn.Rect().Min.X, dv.learnBtn.Rect().Max.Y+20)
+	}
 	if dv.uploading {
 		ebitenutil.DebugPrintAt(dst, "Loading...", dv.uploadBtn.Rect().Min.X, dv.uploadBtn.Rect().Max.Y+20)
 	}
@@ -1274,12 +1665,16 @@ func (dv *DrumView) timelineInfo(elapsedBeats int) string {
 	vEndSec := int((viewEndDur % time.Minute) / time.Second)
 	vEndMilli := int((viewEndDur % time.Second) / time.Millisecond)
 
-	return fmt.Sprintf("%02d:%02d.%03d/%02d:%02d.%03d | View %02d:%02d.%03d-%02d:%02d.%03d | Beats %d-%d/%d",
+	info := fmt.Sprintf("%02d:%02d.%03d/%02d:%02d.%03d | View %02d:%02d.%03d-%02d:%02d.%03d | Beats %d-%d/%d",
 		curMin, curSec, curMilli,
 		totMin, totSec, totMilli,
 		vStartMin, vStartSec, vStartMilli,
 		vEndMin, vEndSec, vEndMilli,
 		viewStartBeat+1, viewEndBeat, totalBeats)
+	if dv.Cycle > 1 {
+		info += fmt.Sprintf(" | Cycle %d", dv.Cycle)
+	}
+	return info
 }
 
 func (dv *DrumView) bg(w, h int) *ebiten.Image {
@@ -6,10 +6,11 @@ import (
 	"io"
 	"os"
 	"slices"
+	"strings"
 	"testing"
-	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/ingyamilmolinar/tunkul/core/engine"
 	"github.com/ingyamilmolinar/tunkul/core/model"
 	"github.com/ingyamilmolinar/tunkul/internal/audio"
 	game_log "github.com/ingyamilmolinar/tunkul/internal/log"
@@ -354,7 +355,9 @@ func TestDrumViewLooping(t *testing.T) {
 	drumView.SetBeatLength(10)
 
 	// Manually call updateBeatInfos to populate the drum view
-	game := &Game{graph: graph, drum: drumView, logger: logger}
+	eng := engine.New(logger)
+	defer eng.Close()
+	game := &Game{graph: graph, engine: eng, drum: drumView, logger: logger}
 	game.updateBeatInfos()
 
 	expectedSteps := []bool{true, true, true, true, true, true, true, true, true, true}
@@ -415,26 +418,21 @@ func TestDrumViewLoopHighlighting(t *testing.T) {
 	game.Layout(800, 720) // Set layout to initialize drum view bounds
 
 	// Simulate starting playback
-	game.playing = true
 	game.updateBeatInfos() // Call updateBeatInfos after drum is set
-	game.spawnPulseFrom(0)
+	startPlaying(game)
 
-	// Run for a few cycles to test loop highlighting
-	for i := 0; i < 20; i++ { // Simulate 20 frames
+	// Run for a few beats to test loop highlighting
+	for i := 0; i < 20; i++ {
+		if i > 0 {
+			advanceBeats(game, 1)
+		}
 		game.Update()
 		t.Logf("Frame %d: highlightedBeats: %v", game.frame, game.highlightedBeats)
 
-		// Determine the expected highlighted index based on the current beat and loop
+		// The beat the pulse just left is the one highlighted
 		expectedHighlightedIndex := -1
 		if game.activePulse != nil {
-			// The pulse has just arrived at this beat, so it's pathIdx-1
-			currentBeatIndex := game.activePulse.pathIdx - 1
-			if currentBeatIndex >= 0 && currentBeatIndex < len(game.beatInfos) {
-				expectedHighlightedIndex = currentBeatIndex
-			}
-		} else if game.playing && len(game.beatInfos) > 0 {
-			// If no active pulse, but playing, it means the first beat is highlighted
-			expectedHighlightedIndex = 0
+			expectedHighlightedIndex = game.activePulse.beat
 		}
 
 		// Verify highlighting
@@ -454,9 +452,6 @@ func TestDrumViewLoopHighlighting(t *testing.T) {
 				}
 			}
 		}
-
-		// Advance time for the next frame
-		time.Sleep(time.Millisecond * 16) // Simulate 60 TPS
 	}
 }
 
@@ -473,8 +468,8 @@ func TestDrumViewButtonsDrawn(t *testing.T) {
 	defer func() { drawButton = orig }()
 
 	dv.Draw(ebiten.NewImage(400, 200), map[int]int64{}, 0, nil, 0)
-	if count != 15 {
-		t.Fatalf("expected 15 buttons drawn, got %d", count)
+	if count != 19 {
+		t.Fatalf("expected 19 buttons drawn, got %d", count)
 	}
 }
 
@@ -1132,7 +1127,9 @@ func TestDrumViewDrawHighlightsInvisibleCells(t *testing.T) {
 	dv.Length = 3
 	dv.SetBeatLength(3)
 
-	game := &Game{graph: graph, drum: dv, logger: logger}
+	eng := engine.New(logger)
+	defer eng.Close()
+	game := &Game{graph: graph, engine: eng, drum: dv, logger: logger}
 	game.updateBeatInfos()
 
 	type call struct {
@@ -1147,7 +1144,7 @@ func TestDrumViewDrawHighlightsInvisibleCells(t *testing.T) {
 	defer func() { drawRect = orig }()
 
 	highlighted := map[int]int64{1: 1}
-	dv.Draw(ebiten.NewImage(300, 50), highlighted, 0, game.beatInfos, 0)
+	dv.Draw(ebiten.NewImage(300, 50), highlighted, 0, game.path(0).Beats, 0)
 
 	var highlightCount int
 	for _, call := range calls {
@@ -1207,6 +1204,191 @@ func TestVolumeSliderUpdatesRowVolume(t *testing.T) {
 	}
 }
 
+func TestSynthKnobsEditSelectedRow(t *testing.T) {
+	g := model.NewGraph(testLogger)
+	dv := NewDrumView(image.Rect(0, 0, 400, 300), g, testLogger)
+	dv.AddRow()
+	dv.selRow = 1
+	dv.recalcButtons()
+	dv.calcLayout()
+	r := dv.synthKnobs[0].Rect()
+	mx, my := r.Min.X+1, r.Min.Y+1
+	pressed := true
+	restore := SetInputForTest(
+		func() (int, int) { return mx, my },
+		func(ebiten.MouseButton) bool { return pressed },
+		func(ebiten.Key) bool { return false },
+		func() []rune { return nil },
+		func() (float64, float64) { return 0, 0 },
+		func() (int, int) { return 0, 0 },
+	)
+	defer restore()
+	dv.Update()
+	my -= knobTravel / 2
+	dv.Update()
+	pressed = false
+	dv.Update()
+	if p := dv.Rows[1].Params.Pitch; p < 0.99 {
+		t.Fatalf("expected row 1 pitch 1 got %f", p)
+	}
+	if dv.Rows[0].Params != (audio.DrumParams{}) {
+		t.Fatalf("unselected row params changed: %+v", dv.Rows[0].Params)
+	}
+	dv.selRow = 0
+	dv.syncKnobs()
+	if dv.synthKnobs[0].Value != 0 {
+		t.Fatalf("knobs did not follow row selection")
+	}
+}
+
+func TestFXPanelEditsRowEffects(t *testing.T) {
+	g := model.NewGraph(testLogger)
+	dv := NewDrumView(image.Rect(0, 0, 400, 300), g, testLogger)
+	dv.AddRow()
+	dv.recalcButtons()
+	dv.calcLayout()
+	r := dv.rowFXBtns[1].Rect()
+	mx, my := r.Min.X+1, r.Min.Y+1
+	pressed := true
+	restore := SetInputForTest(
+		func() (int, int) { return mx, my },
+		func(ebiten.MouseButton) bool { return pressed },
+		func(ebiten.Key) bool { return false },
+		func() []rune { return nil },
+		func() (float64, float64) { return 0, 0 },
+		func() (int, int) { return 0, 0 },
+	)
+	defer restore()
+	dv.Update()
+	pressed = false
+	dv.Update()
+	if dv.fx == nil || dv.fx.Row != 1 {
+		t.Fatalf("expected effects panel for row 1")
+	}
+	if !dv.BlocksAt(dv.fx.Rect().Min.X+1, dv.fx.Rect().Min.Y+1) {
+		t.Fatalf("effects panel should block clicks underneath")
+	}
+
+	// drag the reverb mix knob to its maximum
+	k := dv.fx.knobs[5]
+	mx, my = k.Rect().Min.X+1, k.Rect().Min.Y+1
+	pressed = true
+	dv.Update()
+	my -= knobTravel
+	dv.Update()
+	pressed = false
+	dv.Update()
+	if v := dv.Rows[1].Effects.ReverbMix; v < 0.99 {
+		t.Fatalf("expected reverb mix 1 got %f", v)
+	}
+
+	// cycle the filter type
+	fr := dv.fx.filterBtn.Rect()
+	mx, my = fr.Min.X+1, fr.Min.Y+1
+	pressed = true
+	dv.Update()
+	pressed = false
+	dv.Update()
+	if dv.Rows[1].Effects.Filter != audio.FilterLowPass {
+		t.Fatalf("expected low-pass filter got %v", dv.Rows[1].Effects.Filter)
+	}
+	if dv.Rows[0].Effects != (audio.EffectSettings{}) {
+		t.Fatalf("other row effects changed: %+v", dv.Rows[0].Effects)
+	}
+
+	// clicking elsewhere closes the panel
+	mx, my = dv.Bounds.Max.X-5, dv.Bounds.Max.Y-5
+	pressed = true
+	dv.Update()
+	pressed = false
+	dv.Update()
+	if dv.fx != nil {
+		t.Fatalf("expected effects panel closed")
+	}
+}
+
+func TestMasterMeterSetsGain(t *testing.T) {
+	g := model.NewGraph(testLogger)
+	dv := NewDrumView(image.Rect(0, 0, 400, 300), g, testLogger)
+	dv.recalcButtons()
+	var gain float64
+	origSet := setMasterGain
+	setMasterGain = func(v float64) { gain = v }
+	defer func() { setMasterGain = origSet }()
+	r := dv.masterMeter.Rect()
+	mx, my := r.Min.X, r.Min.Y+r.Dy()/2
+	pressed := true
+	restore := SetInputForTest(
+		func() (int, int) { return mx, my },
+		func(ebiten.MouseButton) bool { return pressed },
+		func(ebiten.Key) bool { return false },
+		func() []rune { return nil },
+		func() (float64, float64) { return 0, 0 },
+		func() (int, int) { return 0, 0 },
+	)
+	defer restore()
+	dv.Update()
+	if !dv.Capturing() {
+		t.Fatalf("expected meter drag to capture the mouse")
+	}
+	pressed = false
+	dv.Update()
+	if gain != 0 {
+		t.Fatalf("expected master gain 0 got %f", gain)
+	}
+}
+
+func TestPanSliderUpdatesRowPan(t *testing.T) {
+	g := model.NewGraph(testLogger)
+	dv := NewDrumView(image.Rect(0, 0, 400, 300), g, testLogger)
+	dv.calcLayout()
+	if dv.rowPanSliders[0].Value != 0.5 {
+		t.Fatalf("expected centred pan slider got %f", dv.rowPanSliders[0].Value)
+	}
+	r := dv.rowPanSliders[0].Rect()
+	mx, my := r.Min.X, r.Min.Y+r.Dy()/2
+	pressed := true
+	restore := SetInputForTest(
+		func() (int, int) { return mx, my },
+		func(ebiten.MouseButton) bool { return pressed },
+		func(ebiten.Key) bool { return false },
+		func() []rune { return nil },
+		func() (float64, float64) { return 0, 0 },
+		func() (int, int) { return 0, 0 },
+	)
+	defer restore()
+	dv.Update()
+	mx = r.Min.X - 50 // dragging past the edge keeps the slider captured
+	dv.Update()
+	pressed = false
+	dv.Update()
+	if dv.Rows[0].Pan != -1 {
+		t.Fatalf("expected hard-left pan got %f", dv.Rows[0].Pan)
+	}
+	if dv.Rows[0].Volume != 1 {
+		t.Fatalf("pan drag changed volume to %f", dv.Rows[0].Volume)
+	}
+}
+
+func TestChokeButtonCyclesGroups(t *testing.T) {
+	g := model.NewGraph(testLogger)
+	dv := NewDrumView(image.Rect(0, 0, 400, 300), g, testLogger)
+	dv.calcLayout()
+	for want := 1; want <= audio.ChokeGroups; want++ {
+		dv.rowChokeBtns[0].OnClick()
+		if dv.Rows[0].Choke != want {
+			t.Fatalf("expected choke group %d got %d", want, dv.Rows[0].Choke)
+		}
+	}
+	dv.rowChokeBtns[0].OnClick()
+	if dv.Rows[0].Choke != 0 {
+		t.Fatalf("expected choke group to wrap to none, got %d", dv.Rows[0].Choke)
+	}
+	if chokeLabel(0) != "C-" || chokeLabel(2) != "C2" {
+		t.Fatalf("unexpected choke labels %q %q", chokeLabel(0), chokeLabel(2))
+	}
+}
+
 // Dragging a volume slider to its maximum and releasing over the delete button
 // should not remove the row.
 func TestVolumeDragReleaseDoesNotDeleteRow(t *testing.T) {
@@ -1318,3 +1500,129 @@ func TestMuteSoloInteractions(t *testing.T) {
 		t.Fatalf("other rows should be muted when a solo is active")
 	}
 }
+
+func TestRowLengthDrawsWrapPointsAndCycle(t *testing.T) {
+	g := New(testLogger)
+	g.Layout(1280, 720)
+	a := g.tryAddNode(0, 0, model.NodeTypeRegular)
+	b := g.tryAddNode(1, 0, model.NodeTypeRegular)
+	c := g.tryAddNode(1, 1, model.NodeTypeRegular)
+	d := g.tryAddNode(0, 1, model.NodeTypeRegular)
+	g.addEdge(a, b)
+	g.addEdge(b, c)
+	g.addEdge(c, d)
+	g.addEdge(d, a)
+	g.drum.AddRow()
+	g.Update()
+	g.pendingStartRow = 1
+	g.tryAddNode(5, 5, model.NodeTypeRegular)
+	g.drum.Rows[1].Length = 3
+	g.Update()
+
+	want := []bool{true, false, false, true, false, false, true, false}
+	if steps := g.drum.Rows[1].Steps; len(steps) < len(want) || !slices.Equal(steps[:len(want)], want) {
+		t.Fatalf("row 1 steps %v, want a hit every 3 beats", steps)
+	}
+	if g.drum.Cycle != 12 {
+		t.Fatalf("cycle %d, want 12 for a 4-beat loop against 3 beats", g.drum.Cycle)
+	}
+	if info := g.drum.timelineInfo(0); !strings.HasSuffix(info, "| Cycle 12") {
+		t.Fatalf("timeline info %q does not show the cycle", info)
+	}
+
+	wraps := map[int][]int{} // row top -> wrap marker columns
+	orig := drawRect
+	drawRect = func(dst *ebiten.Image, r image.Rectangle, c color.Color, filled bool) {
+		if c == colRowWrap && r.Dx() == 2 {
+			wraps[r.Min.Y] = append(wraps[r.Min.Y], (r.Min.X-(g.drum.Bounds.Min.X+g.drum.labelW+g.drum.controlsW))/g.drum.cell)
+		}
+	}
+	defer func() { drawRect = orig }()
+	g.drum.Draw(ebiten.NewImage(1280, 720), nil, 0, nil, 0)
+
+	top := g.drum.Bounds.Min.Y + timelineHeight
+	if got := wraps[top+g.drum.rowHeight()]; len(got) < 2 || got[0] != 3 || got[1] != 6 {
+		t.Fatalf("row 1 wraps at columns %v, want 3, 6, ...", got)
+	}
+	if got := wraps[top]; len(got) < 1 || got[0] != 4 {
+		t.Fatalf("row 0 wraps at columns %v, want 4, ...", got)
+	}
+}
+
+func TestDrumCellClickTogglesNode(t *testing.T) {
+	g := New(testLogger)
+	g.Layout(640, 480)
+	a := g.tryAddNode(0, 0, model.NodeTypeRegular)
+	b := g.tryAddNode(2, 0, model.NodeTypeRegular)
+	g.addEdge(a, b)
+	g.Update()
+
+	dv := g.drum
+	mx := dv.Bounds.Min.X + dv.labelW + dv.controlsW + dv.cell + 1
+	my := dv.Bounds.Min.Y + timelineHeight + 1
+	pressed := false
+	restore := SetInputForTest(
+		func() (int, int) { return mx, my },
+		func(b ebiten.MouseButton) bool { return pressed && b == ebiten.MouseButtonLeft },
+		func(ebiten.Key) bool { return false },
+		func() []rune { return nil },
+		func() (float64, float64) { return 0, 0 },
+		func() (int, int) { return g.winW, g.winH },
+	)
+	defer restore()
+	click := func() {
+		pressed = true
+		g.Update()
+		pressed = false
+		g.Update()
+	}
+
+	mid := g.nodeAt(1, 0)
+	click()
+	if g.graph.Nodes[mid.ID].Type != model.NodeTypeRegular || !dv.Rows[0].Steps[1] {
+		t.Fatalf("clicking cell 1 left node %+v, step %v", g.graph.Nodes[mid.ID], dv.Rows[0].Steps[1])
+	}
+	click()
+	if g.graph.Nodes[mid.ID].Type != model.NodeTypeInvisible || dv.Rows[0].Steps[1] {
+		t.Fatalf("second click left node %+v, step %v", g.graph.Nodes[mid.ID], dv.Rows[0].Steps[1])
+	}
+
+	// Dragging across cells scrolls instead of toggling.
+	pressed = true
+	g.Update()
+	mx -= 2 * dv.cell
+	g.Update()
+	pressed = false
+	g.Update()
+	if g.graph.Nodes[mid.ID].Type != model.NodeTypeInvisible {
+		t.Fatal("a drag toggled a cell")
+	}
+}
+
+func TestToggleStepGrowsRowPath(t *testing.T) {
+	g := New(testLogger)
+	g.Layout(640, 480)
+	g.tryAddNode(0, 0, model.NodeTypeRegular)
+	g.drum.AddRow()
+	g.Update()
+	g.pendingStartRow = -1
+
+	// Row 1 has no origin yet, so the click starts its path below row 0's.
+	if !g.toggleStep(1, 2) {
+		t.Fatal("toggleStep failed on a row without an origin")
+	}
+	r := g.drum.Rows[1]
+	if r.Node == nil || r.Node.I != 0 || r.Node.J != 2 {
+		t.Fatalf("row 1 origin %+v, want a node at (0,2)", r.Node)
+	}
+	if want := []bool{false, false, true}; !slices.Equal(r.Steps[:3], want) {
+		t.Fatalf("row 1 steps %v, want %v", r.Steps[:3], want)
+	}
+	end := g.nodeAt(2, 2)
+	if end == nil || len(g.edges) != 1 || g.edges[0].A != r.Node || g.edges[0].B != end {
+		t.Fatalf("grid not synced with the extended path: end %+v, edges %+v", end, g.edges)
+	}
+	if g.nodeAt(1, 2) == nil {
+		t.Fatal("the skipped beat has no grid node")
+	}
+}
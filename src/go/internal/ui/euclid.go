@@ -0,0 +1,71 @@
+package ui
+
+import "github.com/ingyamilmolinar/tunkul/core/model"
+
+// euclidRing returns the grid cells of a closed loop holding at least steps
+// beats, starting at (i, j): right along row j, then back along row j+1. A
+// loop on the grid always has an even number of cells, at least four.
+func euclidRing(i, j, steps int) [][2]int {
+	w := max((steps+1)/2, 2)
+	cells := make([][2]int, 0, 2*w)
+	for k := 0; k < w; k++ {
+		cells = append(cells, [2]int{i + k, j})
+	}
+	for k := w - 1; k >= 0; k-- {
+		cells = append(cells, [2]int{i + k, j + 1})
+	}
+	return cells
+}
+
+// placeEuclid lays e down as a loop starting at (i, j), hits as regular
+// nodes and rests as invisible ones, and makes it the origin of the given
+// row. Loops longer than the pattern get a row length that skips the spare
+// cells. It reports false, leaving the grid untouched, when a cell of the
+// loop is taken or the row does not exist.
+func (g *Game) placeEuclid(row, i, j int, e model.Euclid) bool {
+	pattern := e.Pattern()
+	if row < 0 || row >= len(g.drum.Rows) || len(pattern) == 0 {
+		return false
+	}
+	cells := euclidRing(i, j, len(pattern))
+	for _, c := range cells {
+		if g.nodeAt(c[0], c[1]) != nil {
+			g.logger.Warnf("[GAME] Euclid loop at (%d,%d) overlaps node at (%d,%d)", i, j, c[0], c[1])
+			return false
+		}
+	}
+	ring := make([]*uiNode, len(cells))
+	for k, c := range cells {
+		typ := model.NodeTypeInvisible
+		if k < len(pattern) && pattern[k] {
+			typ = model.NodeTypeRegular
+		}
+		id := g.graph.AddNode(c[0], c[1], typ)
+		ring[k] = &uiNode{ID: id, I: c[0], J: c[1], X: float64(c[0] * GridStep), Y: float64(c[1] * GridStep)}
+		g.nodes = append(g.nodes, ring[k])
+	}
+	for k, a := range ring {
+		b := ring[(k+1)%len(ring)]
+		g.edges = append(g.edges, uiEdge{A: a, B: b, t: 0, pulse: -1})
+		g.graph.Edges[[2]model.NodeID{a.ID, b.ID}] = struct{}{}
+	}
+
+	r := g.drum.Rows[row]
+	if r.Node != nil {
+		r.Node.Start = false
+	}
+	r.Origin, r.Node = ring[0].ID, ring[0]
+	ring[0].Start = true
+	if row == 0 {
+		g.start = ring[0]
+		g.graph.StartNodeID = ring[0].ID
+	}
+	r.Length = 0
+	if len(ring) != len(pattern) {
+		r.Length = len(pattern)
+	}
+	g.logger.Infof("[GAME] Placed Euclid %d/%d rotated %d for row %d at (%d,%d)", e.Pulses, e.Steps, e.Rotation, row, i, j)
+	g.updateBeatInfos()
+	g.computeSelNeighbors()
+	return true
+}
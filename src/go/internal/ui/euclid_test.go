@@ -0,0 +1,62 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/ingyamilmolinar/tunkul/core/model"
+)
+
+func TestPlaceEuclidBuildsRowLoop(t *testing.T) {
+	g := New(testLogger)
+	g.Layout(640, 480)
+	g.drum.AddRow()
+	g.Update()
+	g.pendingStartRow = -1
+
+	// E(2,5) is x..x. and needs a six-cell loop, so the row skips the last.
+	if !g.placeEuclid(1, 0, 0, model.Euclid{Steps: 5, Pulses: 2}) {
+		t.Fatal("placeEuclid failed on an empty grid")
+	}
+	r := g.drum.Rows[1]
+	if r.Node == nil || r.Node.I != 0 || r.Node.J != 0 || !r.Node.Start || r.Origin != r.Node.ID {
+		t.Fatalf("row origin not set to the loop start: %+v", r.Node)
+	}
+	if r.Length != 5 {
+		t.Fatalf("row length %d, want 5", r.Length)
+	}
+	p := g.path(1)
+	if !p.Loop || p.Period() != 5 {
+		t.Fatalf("path loop=%v period=%d, want a loop of 5", p.Loop, p.Period())
+	}
+	want := []model.NodeType{model.NodeTypeRegular, model.NodeTypeInvisible, model.NodeTypeInvisible, model.NodeTypeRegular, model.NodeTypeInvisible}
+	for k, typ := range want {
+		if b := p.At(k); b.NodeType != typ {
+			t.Fatalf("beat %d is %v at (%d,%d), want %v", k, b.NodeType, b.I, b.J, typ)
+		}
+	}
+	if b := p.At(3); b.I != 2 || b.J != 1 {
+		t.Fatalf("beat 3 at (%d,%d), want the loop's far corner (2,1)", b.I, b.J)
+	}
+
+	nodes := len(g.nodes)
+	if g.placeEuclid(0, 1, 1, model.Euclid{Steps: 4, Pulses: 1}) {
+		t.Fatal("placeEuclid overlapped an existing loop")
+	}
+	if len(g.nodes) != nodes {
+		t.Fatalf("failed placement added %d nodes", len(g.nodes)-nodes)
+	}
+}
+
+func TestEuclidButtonArmsPlacement(t *testing.T) {
+	g := New(testLogger)
+	g.Layout(640, 480)
+	g.drum.toggleFX(0)
+	if g.drum.Rows[0].Euclid.Steps == 0 {
+		t.Fatal("FX panel left the row without Euclid steps")
+	}
+	g.drum.fx.euclidBtn.OnClick()
+	g.Update()
+	if g.pendingEuclid != 0 {
+		t.Fatalf("pendingEuclid = %d, want row 0", g.pendingEuclid)
+	}
+}
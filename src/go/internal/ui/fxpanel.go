@@ -0,0 +1,244 @@
+package ui
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/ingyamilmolinar/tunkul/core/model"
+	"github.com/ingyamilmolinar/tunkul/internal/audio"
+)
+
+// maxRowLength bounds the loop length a row can be given.
+const maxRowLength = 64
+
+// fxKnobs maps each effects-panel knob to the setting it edits.
+var fxKnobs = []struct {
+	label string
+	field func(*audio.EffectSettings) *float64
+}{
+	{"Drv", func(s *audio.EffectSettings) *float64 { return &s.Drive }},
+	{"Cut", func(s *audio.EffectSettings) *float64 { return &s.Cutoff }},
+	{"Res", func(s *audio.EffectSettings) *float64 { return &s.Resonance }},
+	{"Dly", func(s *audio.EffectSettings) *float64 { return &s.DelayMix }},
+	{"Fbk", func(s *audio.EffectSettings) *float64 { return &s.DelayFeedback }},
+	{"Rev", func(s *audio.EffectSettings) *float64 { return &s.ReverbMix }},
+	{"Siz", func(s *audio.EffectSettings) *float64 { return &s.ReverbSize }},
+}
+
+// rowKnobs maps the panel's loop length, MIDI, Euclid and mutation knobs to
+// the row setting they edit. They follow the effect knobs and snap to whole numbers.
+var rowKnobs = []struct {
+	max   int
+	field func(*DrumRow) *int
+	label func(int) string
+}{
+	{maxRowLength, func(r *DrumRow) *int { return &r.Length }, func(v int) string {
+		if v == 0 {
+			return "Len-"
+		}
+		return fmt.Sprintf("Len%d", v)
+	}},
+	{16, func(r *DrumRow) *int { return &r.MIDIChannel }, func(v int) string {
+		if v == 0 {
+			return "Ch-"
+		}
+		return fmt.Sprintf("Ch%d", v)
+	}},
+	{127, func(r *DrumRow) *int { return &r.MIDINote }, func(v int) string { return fmt.Sprintf("N%d", v) }},
+	{maxRowLength, func(r *DrumRow) *int { return &r.Euclid.Steps }, func(v int) string { return fmt.Sprintf("St%d", v) }},
+	{maxRowLength, func(r *DrumRow) *int { return &r.Euclid.Pulses }, func(v int) string { return fmt.Sprintf("Pu%d", v) }},
+	{maxRowLength - 1, func(r *DrumRow) *int { return &r.Euclid.Rotation }, func(v int) string { return fmt.Sprintf("Ro%d", v) }},
+	{16, func(r *DrumRow) *int { return &r.Mutations }, func(v int) string { return fmt.Sprintf("Mu%d", v) }},
+}
+
+// toolButtons labels the pattern tool buttons in the order they are shown.
+var toolButtons = []struct {
+	text string
+	tool rowTool
+}{
+	{"Rnd", toolRandomize},
+	{"Mut", toolMutate},
+	{"<", toolShiftLeft},
+	{">", toolShiftRight},
+	{"Rev", toolReverse},
+}
+
+// FXPanel is a popover editing the effects chain, rate, loop length and
+// MIDI output of a single drum row, and generating patterns for it.
+type FXPanel struct {
+	Row      int
+	OnEuclid func()        // called when the Euc button asks to place the row's Euclid loop
+	OnTool   func(rowTool) // called when a pattern tool button is pressed
+	row      *DrumRow
+	settings *audio.EffectSettings
+	r        image.Rectangle
+
+	filterBtn  *Button
+	delayBtn   *Button
+	rateBtn    *Button
+	euclidBtn  *Button
+	toolBtns   []*Button
+	knobs      []*Knob
+	activeKnob int // index of knob capturing mouse events, -1 if none
+}
+
+// NewFXPanel returns a panel editing dr, the drum row at index row.
+func NewFXPanel(row int, dr *DrumRow) *FXPanel {
+	s := &dr.Effects
+	p := &FXPanel{Row: row, row: dr, settings: s, activeKnob: -1}
+	p.filterBtn = NewButton("", DropdownStyle, func() {
+		p.settings.Filter = (p.settings.Filter + 1) % audio.FilterType(len(audio.FilterNames))
+	})
+	p.delayBtn = NewButton("", DropdownStyle, func() {
+		p.settings.DelayDiv = (p.settings.DelayDiv + 1) % len(audio.DelayDivisions)
+	})
+	p.rateBtn = NewButton("", DropdownStyle, func() { p.row.Rate = p.row.Rate.Next() })
+	p.euclidBtn = NewButton("Euc", DropdownStyle, func() {
+		if p.OnEuclid != nil && p.row.Euclid.Steps > 0 {
+			p.OnEuclid()
+		}
+	})
+	for _, b := range toolButtons {
+		tool := b.tool
+		p.toolBtns = append(p.toolBtns, NewButton(b.text, DropdownStyle, func() {
+			if p.OnTool != nil {
+				p.OnTool(tool)
+			}
+		}))
+	}
+	if dr.Euclid == (model.Euclid{}) { // rows start from the tresillo
+		dr.Euclid = model.Euclid{Steps: 8, Pulses: 3}
+	}
+	if dr.Mutations == 0 {
+		dr.Mutations = 2
+	}
+	for _, k := range fxKnobs {
+		p.knobs = append(p.knobs, NewRangeKnob(k.label, *k.field(s), 0, 1))
+	}
+	for _, k := range rowKnobs {
+		p.knobs = append(p.knobs, NewRangeKnob("", float64(*k.field(dr)), 0, float64(k.max)))
+	}
+	return p
+}
+
+// value returns the setting edited by knob i.
+func (p *FXPanel) value(i int) float64 {
+	if i < len(fxKnobs) {
+		return *fxKnobs[i].field(p.settings)
+	}
+	return float64(*rowKnobs[i-len(fxKnobs)].field(p.row))
+}
+
+// setValue stores v into the setting edited by knob i.
+func (p *FXPanel) setValue(i int, v float64) {
+	if i < len(fxKnobs) {
+		*fxKnobs[i].field(p.settings) = v
+		return
+	}
+	*rowKnobs[i-len(fxKnobs)].field(p.row) = int(math.Round(v))
+}
+
+// SetRect positions the panel and lays out its controls in three strips,
+// each buttons first and then knobs with their labels underneath: the filter
+// type, delay time and effect knobs on top, the row rate, Euclid placement
+// and row knobs in the middle, and the pattern tools with the mutation count
+// at the bottom.
+func (p *FXPanel) SetRect(r image.Rectangle) {
+	p.r = r
+	h := r.Dy() / 3
+	strip := func(i int) image.Rectangle {
+		return image.Rect(r.Min.X, r.Min.Y+i*h, r.Max.X, r.Min.Y+(i+1)*h)
+	}
+	row := p.knobs[len(fxKnobs):]
+	p.layoutStrip(strip(0), []*Button{p.filterBtn, p.delayBtn}, p.knobs[:len(fxKnobs)])
+	p.layoutStrip(strip(1), []*Button{p.rateBtn, p.euclidBtn}, row[:len(row)-1])
+	p.layoutStrip(strip(2), p.toolBtns, row[len(row)-1:])
+}
+
+func (p *FXPanel) layoutStrip(r image.Rectangle, btns []*Button, knobs []*Knob) {
+	var cols []float64
+	for range btns {
+		cols = append(cols, 2)
+	}
+	for range knobs {
+		cols = append(cols, 1)
+	}
+	g := NewGridLayout(r, cols, []float64{1})
+	lbl := debugCharH + 2
+	for i, btn := range btns {
+		c := g.Cell(i, 0)
+		btn.SetRect(insetRect(image.Rect(c.Min.X, c.Min.Y, c.Max.X, c.Max.Y-lbl), buttonPad))
+	}
+	for i, k := range knobs {
+		c := g.Cell(i+len(btns), 0)
+		side := min(c.Dx(), c.Dy()-lbl) - 2*buttonPad
+		x := c.Min.X + (c.Dx()-side)/2
+		k.SetRect(image.Rect(x, c.Min.Y+buttonPad, x+side, c.Min.Y+buttonPad+side))
+	}
+}
+
+func (p *FXPanel) buttons() []*Button {
+	return append([]*Button{p.filterBtn, p.delayBtn, p.rateBtn, p.euclidBtn}, p.toolBtns...)
+}
+
+// Rect returns the panel bounds.
+func (p *FXPanel) Rect() image.Rectangle { return p.r }
+
+// Capturing reports whether a knob drag is in progress.
+func (p *FXPanel) Capturing() bool { return p.activeKnob >= 0 }
+
+// Update processes mouse input and reports whether the panel consumed it.
+func (p *FXPanel) Update(mx, my int, left bool) bool {
+	if p.activeKnob >= 0 {
+		k := p.knobs[p.activeKnob]
+		if k.Handle(mx, my, left) {
+			p.setValue(p.activeKnob, k.Value)
+		}
+		if !left {
+			p.activeKnob = -1
+		}
+		return true
+	}
+	for i, k := range p.knobs {
+		k.Value = p.value(i)
+		if k.Handle(mx, my, left) {
+			p.setValue(i, k.Value)
+			if left {
+				p.activeKnob = i
+			}
+			return true
+		}
+	}
+	handled := false
+	for _, btn := range p.buttons() {
+		if btn.Handle(mx, my, left) {
+			handled = true
+		}
+	}
+	return handled || pt(mx, my, p.r)
+}
+
+// Draw renders the panel on top of the drum view.
+func (p *FXPanel) Draw(dst *ebiten.Image) {
+	drawRect(dst, p.r, color.RGBA{30, 30, 30, 240}, true)
+	drawRect(dst, p.r, colDropdownEdge, false)
+	p.filterBtn.Text = audio.FilterNames[p.settings.Filter]
+	p.delayBtn.Text = audio.DelayDivisionNames[p.settings.DelayDiv]
+	p.rateBtn.Text = p.row.Rate.String()
+	for _, btn := range p.buttons() {
+		btn.Draw(dst)
+	}
+	for i, k := range p.knobs {
+		if i != p.activeKnob {
+			k.Value = p.value(i)
+		}
+		if i >= len(fxKnobs) {
+			m := rowKnobs[i-len(fxKnobs)]
+			k.Label = m.label(*m.field(p.row))
+		}
+		k.Draw(dst)
+	}
+}
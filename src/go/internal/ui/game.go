@@ -1,16 +1,22 @@
 package ui
 
 import (
-	"fmt"
 	"image"
 	"image/color"
+	"maps"
 	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/ingyamilmolinar/tunkul/core/engine"
 	"github.com/ingyamilmolinar/tunkul/core/model"
 	"github.com/ingyamilmolinar/tunkul/internal/audio"
 	game_log "github.com/ingyamilmolinar/tunkul/internal/log"
+	"github.com/ingyamilmolinar/tunkul/internal/netsync"
+	"github.com/ingyamilmolinar/tunkul/internal/osc"
 )
 
 const (
@@ -19,8 +25,11 @@ const (
 
 const ebitenTPS = 60 // Ticks per second for Ebiten (stubbed for tests)
 
-// playSound plays a synthesized sound with volume. Overridden in tests.
-var playSound = audio.PlayVol
+// playSound triggers an instrument hit. Overridden in tests.
+var playSound = audio.Trigger
+
+// releaseBus frees a deleted row's effects bus. Overridden in tests.
+var releaseBus = audio.ReleaseBus
 
 var enableDefaultStart = true
 
@@ -30,44 +39,6 @@ func makeBeatKey(row, idx int) int { return (row << 16) | (idx & 0xFFFF) }
 
 func splitBeatKey(key int) (row, idx int) { return key >> 16, key & 0xFFFF }
 
-func loopSegmentLen(path []model.BeatInfo, start int) int {
-	if start < 0 || start >= len(path) {
-		return 0
-	}
-	origin := path[start].NodeID
-	for i := start + 1; i < len(path); i++ {
-		if path[i].NodeID == origin {
-			return i - start
-		}
-	}
-	return len(path) - start
-}
-
-// rawBeatLen returns the length of the non-expanded beat path. When the graph
-// requests a beat row with a large beat length, the loop segment is repeated to
-// fill that length. This helper strips the repeated portion so callers obtain
-// the actual traversal length regardless of the current beatLength setting.
-func rawBeatLen(path []model.BeatInfo, isLoop bool, loopStart int) int {
-	if !isLoop {
-		for i, b := range path {
-			if b.NodeID == model.InvalidNodeID {
-				return i
-			}
-		}
-		return len(path)
-	}
-	if loopStart < 0 || loopStart >= len(path) {
-		return len(path)
-	}
-	origin := path[loopStart].NodeID
-	for i := loopStart + 1; i < len(path); i++ {
-		if path[i].NodeID == origin {
-			return i
-		}
-	}
-	return len(path)
-}
-
 /* ───────────────────────── data types ───────────────────────── */
 
 type uiNode struct {
@@ -96,15 +67,15 @@ type dragLink struct {
 	active   bool
 }
 
+// pulse animates a row's signal from the node the engine just played
+// towards the one it plays next.
 type pulse struct {
-	x1, y1, x2, y2           float64
-	t, speed                 float64
-	from, to                 *uiNode
-	fromBeatInfo, toBeatInfo model.BeatInfo
-	path                     []model.BeatInfo
-	pathIdx                  int
-	lastIdx                  int
-	row                      int
+	x1, y1, x2, y2 float64
+	t, speed       float64
+	from, to       *uiNode
+	fromID, toID   model.NodeID
+	beat           int // path position of the beat the pulse left
+	row            int
 }
 
 type Game struct {
@@ -114,12 +85,14 @@ type Game struct {
 	drum   *DrumView
 	graph  *model.Graph
 	engine *engine.Engine
+	events *engine.Subscription // steps and hits to show on the next frame
 	logger *game_log.Logger
 
 	/* graph data */
 	nodes           []*uiNode
 	edges           []uiEdge
 	pendingStartRow int
+	pendingEuclid   int // row whose Euclid loop the next grid click places, -1 for none
 
 	/* visuals */
 	activePulses        []*pulse
@@ -137,29 +110,31 @@ type Game struct {
 	leftPrev       bool
 	pendingClick   bool
 	clickI, clickJ int
+	keys           keyState
+	cursor         gridCursor // keyboard cursor, see handleKeys
+	showHelp       bool       // key bindings overlay
 
 	/* game state */
-	playing            bool
-	bpm                int
-	currentStep        int // Current step in the sequence
-	lastBeatFrame      int64
-	beatInfos          []model.BeatInfo   // Full traversal path for primary start
-	drumBeatInfos      []model.BeatInfo   // BeatInfos sized to drum view
-	beatInfosByRow     [][]model.BeatInfo // Per-row traversal paths
-	isLoop             bool               // Indicates if the current graph forms a loop
-	loopStartIndex     int                // The index in beatInfos where the loop segment begins
-	isLoopByRow        []bool
-	loopStartByRow     []int
-	loopLenByRow       []int
-	originIdxsByRow    [][]int
-	nextOriginIdxByRow []int
-	nextBeatIdxs       []int                // Absolute beat index per row
-	nodeRows           map[model.NodeID]int // nodeID -> row index
-	elapsedBeats       int
+	playing       bool
+	bpm           int
+	currentStep   int                  // last scheduler step reported by the engine
+	paths         []engine.Path        // per-row paths as last computed by the engine
+	drumBeatInfos []model.BeatInfo     // row 0 beats sized to drum view
+	nodeRows      map[model.NodeID]int // nodeID -> row index
+	elapsedBeats  int
+	droppedEvents uint64 // engine events lost while frames stalled
+	voiceMu       sync.Mutex
+	voices        []voice    // how each row sounds, read on the engine goroutine
+	rng           *rand.Rand // drives the randomize and mutate tools, see SetSeed
 
 	/* misc */
-	winW, winH int
-	start      *uiNode // explicit “root/start” node (⇧S to set)
+	winW, winH   int
+	start        *uiNode      // explicit “root/start” node (⇧S to set)
+	savedProject string       // last project written by autosave
+	midiIn       chan midiMsg // note and CC messages from the MIDI input
+	osc          *osc.Server
+	oscIn        chan osc.Message
+	netSync      *netsync.Session
 }
 
 /* ───────────────── helper: node’s screen rect ───────────────── */
@@ -196,32 +171,35 @@ func (g *Game) computeSelNeighbors() {
 
 /* ───────────────────── constructor & layout ─────────────────── */
 
+// eventQueue bounds the engine events waiting for the next frame.
+const eventQueue = 256
+
 func New(logger *game_log.Logger) *Game {
 	eng := engine.New(logger)
 	g := &Game{
-		cam:                NewCamera(),
-		logger:             logger,
-		graph:              eng.Graph,
-		engine:             eng,
-		split:              NewSplitter(720), // real height set in Layout below
-		highlightedBeats:   make(map[int]int64),
-		bpm:                120, // Default BPM
-		beatInfos:          []model.BeatInfo{},
-		drumBeatInfos:      []model.BeatInfo{},
-		beatInfosByRow:     [][]model.BeatInfo{},
-		isLoopByRow:        []bool{},
-		loopStartByRow:     []int{},
-		loopLenByRow:       []int{},
-		originIdxsByRow:    [][]int{},
-		nextOriginIdxByRow: []int{},
-		nextBeatIdxs:       []int{},
-		nodeRows:           make(map[model.NodeID]int),
-		activePulses:       []*pulse{},
-		pendingStartRow:    -1,
-	}
+		cam:              NewCamera(),
+		logger:           logger,
+		graph:            model.NewGraph(logger),
+		engine:           eng,
+		split:            NewSplitter(720), // real height set in Layout below
+		highlightedBeats: make(map[int]int64),
+		bpm:              120, // Default BPM
+		drumBeatInfos:    []model.BeatInfo{},
+		nodeRows:         make(map[model.NodeID]int),
+		activePulses:     []*pulse{},
+		pendingStartRow:  -1,
+		pendingEuclid:    -1,
+		keys:             keyState{},
+	}
+	g.SetSeed(1)
 
 	// bottom drum-machine view
 	g.drum = NewDrumView(image.Rect(0, 600, 1280, 720), g.graph, logger)
+	eng.SetPlayer(g.playHit)
+	// A stalled frame loses the oldest highlights, not the latest ones.
+	g.events = eng.Subscribe(eventQueue, engine.DropOldest, engine.EventStep, engine.EventHit, engine.EventGraph)
+	g.syncTracks()
+	g.restoreProject()
 	return g
 }
 
@@ -361,117 +339,51 @@ func (g *Game) deleteNode(n *uiNode) {
 	g.updateBeatInfos()
 }
 
+// updateBeatInfos has the engine recompute every row's path after a graph
+// or origin change and refreshes what the UI shows of them.
 func (g *Game) updateBeatInfos() {
-	// Use a generously large beat length so CalculateBeatRow returns the
-	// complete path even when disconnected nodes exist elsewhere in the
-	// graph. We'll shrink the beat length back to the actual traversal size
-	// after computing the raw path length.
-	g.graph.SetBeatLength(int(g.graph.Next))
-
-	fullBeatRow, isLoop, loopStart := g.graph.CalculateBeatRow()
-	baseLen := rawBeatLen(fullBeatRow, isLoop, loopStart)
+	if len(g.drum.Rows) > 0 && g.drum.Rows[0].Origin == model.InvalidNodeID && g.start != nil {
+		// row 0 tracks the start node
+		g.drum.Rows[0].Origin = g.start.ID
+		g.drum.Rows[0].Node = g.start
+	}
+	// The engine plays a copy, so edits to g.graph only reach it here.
+	graph, tracks := g.graph.Clone(), g.tracks()
+	g.engine.Do(func(s *engine.State) {
+		s.Graph = graph
+		s.Tracks = tracks
+	})
+	g.refreshPaths()
+}
 
-	g.beatInfos = fullBeatRow[:baseLen]
-	g.isLoop = isLoop
-	g.loopStartIndex = loopStart
+// refreshPaths shows the paths the engine plays. While launch quantization
+// holds an edit back they are still the old ones; the engine reports
+// EventGraph once it applies the edit.
+func (g *Game) refreshPaths() {
+	snap := g.engine.Snapshot()
+	g.paths = snap.Paths
+	g.drum.Cycle = snap.Cycle()
 
-	maxLen := baseLen
+	longest := 0
 	g.nodeRows = map[model.NodeID]int{}
-	nRows := len(g.drum.Rows)
-	prevNext := g.nextBeatIdxs
-	g.beatInfosByRow = make([][]model.BeatInfo, nRows)
-	g.isLoopByRow = make([]bool, nRows)
-	g.loopStartByRow = make([]int, nRows)
-	g.loopLenByRow = make([]int, nRows)
-	g.originIdxsByRow = make([][]int, nRows)
-	g.nextOriginIdxByRow = make([]int, nRows)
-	g.nextBeatIdxs = make([]int, nRows)
-	copy(g.nextBeatIdxs, prevNext)
-	if nRows > 0 {
-		g.beatInfosByRow[0] = g.beatInfos
-		g.isLoopByRow[0] = isLoop
-		g.loopStartByRow[0] = loopStart
-		if isLoop {
-			g.loopLenByRow[0] = loopSegmentLen(g.beatInfos, loopStart)
-		}
-		origin := g.drum.Rows[0].Origin
-		for idx, b := range g.beatInfos {
-			if b.NodeID != model.InvalidNodeID {
-				g.nodeRows[b.NodeID] = 0
-			}
-			if b.NodeID == origin {
-				g.originIdxsByRow[0] = append(g.originIdxsByRow[0], idx)
-			}
-		}
-	}
-
-	// Compute beat paths for additional drum rows using their origin nodes.
-	for i, r := range g.drum.Rows {
-		if i == 0 {
-			// row 0 handled above; ensure its origin tracks the start node
-			if r.Origin == model.InvalidNodeID && g.start != nil {
-				g.drum.Rows[0].Origin = g.start.ID
-				g.drum.Rows[0].Node = g.start
-			}
-			continue
-		}
-		if r.Origin == model.InvalidNodeID {
-			continue
-		}
-		rowPath, rowLoop, rowStart := g.graph.CalculateBeatRowFrom(r.Origin)
-		rowLen := rawBeatLen(rowPath, rowLoop, rowStart)
-		g.beatInfosByRow[i] = rowPath[:rowLen]
-		g.isLoopByRow[i] = rowLoop
-		g.loopStartByRow[i] = rowStart
-		if rowLoop {
-			g.loopLenByRow[i] = loopSegmentLen(g.beatInfosByRow[i], rowStart)
-		}
-		origin := r.Origin
-		for idx, b := range rowPath[:rowLen] {
-			if b.NodeID != model.InvalidNodeID {
-				if _, exists := g.nodeRows[b.NodeID]; !exists {
-					g.nodeRows[b.NodeID] = i
-				}
+	for row, p := range g.paths {
+		for _, b := range p.Beats {
+			if _, seen := g.nodeRows[b.NodeID]; !seen && b.NodeID != model.InvalidNodeID {
+				g.nodeRows[b.NodeID] = row
 			}
-			if b.NodeID == origin {
-				g.originIdxsByRow[i] = append(g.originIdxsByRow[i], idx)
-			}
-		}
-		if rowLen > maxLen {
-			maxLen = rowLen
 		}
+		longest = max(longest, len(p.Beats))
 	}
-
-	// Reduce the graph's beat length to the actual maximum traversal size so
-	// subsequent path calculations are not padded with extra loop cycles.
-	g.graph.SetBeatLength(maxLen)
-
-	g.resetOriginSequences()
-
-	if maxLen > g.drum.Length {
-		g.drum.Length = maxLen
+	g.graph.SetBeatLength(longest)
+	if longest > g.drum.Length {
+		g.drum.Length = longest
 	}
 
-	// Rebind active pulses to the updated beat paths while preserving
-	// their absolute progression indices.
+	// Point active pulses at the nodes their beats now map to.
 	for _, p := range g.activePulses {
-		if p.row >= len(g.beatInfosByRow) {
-			continue
-		}
-		path := g.beatInfosByRow[p.row]
-		if len(path) == 0 {
-			continue
-		}
-		p.path = path
-		absLast := g.nextBeatIdxs[p.row] - 1
-		wrappedLast := g.wrapBeatIndexRow(p.row, absLast)
-		wrappedNext := g.wrapBeatIndexRow(p.row, g.nextBeatIdxs[p.row])
-		p.lastIdx = absLast
-		p.fromBeatInfo = path[wrappedLast]
-		p.toBeatInfo = path[wrappedNext]
-		p.pathIdx = wrappedNext
-		p.from = g.nodeByID(p.fromBeatInfo.NodeID)
-		p.to = g.nodeByID(p.toBeatInfo.NodeID)
+		path := g.path(p.row)
+		p.fromID, p.toID = path.At(p.beat).NodeID, path.At(p.beat+1).NodeID
+		p.from, p.to = g.nodeByID(p.fromID), g.nodeByID(p.toID)
 		if p.from != nil {
 			p.x1, p.y1 = p.from.X, p.from.Y
 		}
@@ -480,12 +392,12 @@ func (g *Game) updateBeatInfos() {
 		}
 	}
 
-	g.logger.Debugf("[GAME] updateBeatInfos: drum.Length=%d, beatPath=%d", g.drum.Length, len(g.beatInfos))
+	g.logger.Debugf("[GAME] updateBeatInfos: drum.Length=%d, beatPath=%d", g.drum.Length, len(g.path(0).Beats))
 
 	// Preserve current drum offset when the beat path changes. Clamp to the
 	// new valid range instead of resetting to zero so resizing the drum view
 	// doesn't jump back to the origin.
-	maxOffset := len(g.beatInfos) - g.drum.Length
+	maxOffset := len(g.path(0).Beats) - g.drum.Length
 	if maxOffset < 0 {
 		maxOffset = 0
 	}
@@ -496,107 +408,53 @@ func (g *Game) updateBeatInfos() {
 	g.refreshDrumRow()
 }
 
-func (g *Game) beatInfoAt(idx int) model.BeatInfo {
-	if len(g.beatInfos) == 0 {
-		return model.BeatInfo{NodeID: model.InvalidNodeID, NodeType: model.NodeTypeInvisible, I: -1, J: -1}
-	}
-	if idx < len(g.beatInfos) {
-		return g.beatInfos[idx]
-	}
-	if !g.isLoop {
-		return model.BeatInfo{NodeID: model.InvalidNodeID, NodeType: model.NodeTypeInvisible, I: -1, J: -1}
-	}
-	loopLen := len(g.beatInfos) - g.loopStartIndex
-	if loopLen <= 0 {
-		return model.BeatInfo{NodeID: model.InvalidNodeID, NodeType: model.NodeTypeInvisible, I: -1, J: -1}
-	}
-	idx = g.loopStartIndex + (idx-g.loopStartIndex)%loopLen
-	return g.beatInfos[idx]
-}
-
-func (g *Game) beatInfoAtRow(row, idx int) model.BeatInfo {
-	if row < 0 || row >= len(g.beatInfosByRow) {
-		return model.BeatInfo{NodeID: model.InvalidNodeID, NodeType: model.NodeTypeInvisible, I: -1, J: -1}
-	}
-	infos := g.beatInfosByRow[row]
-	if len(infos) == 0 {
-		return model.BeatInfo{NodeID: model.InvalidNodeID, NodeType: model.NodeTypeInvisible, I: -1, J: -1}
-	}
-	if idx < len(infos) {
-		return infos[idx]
+// path returns row's path, empty if the row has none.
+func (g *Game) path(row int) engine.Path {
+	if row < 0 || row >= len(g.paths) {
+		return engine.Path{}
 	}
-	if !g.isLoopByRow[row] {
-		return model.BeatInfo{NodeID: model.InvalidNodeID, NodeType: model.NodeTypeInvisible, I: -1, J: -1}
-	}
-	loopLen := len(infos) - g.loopStartByRow[row]
-	if loopLen <= 0 {
-		return model.BeatInfo{NodeID: model.InvalidNodeID, NodeType: model.NodeTypeInvisible, I: -1, J: -1}
-	}
-	idx = g.loopStartByRow[row] + (idx-g.loopStartByRow[row])%loopLen
-	return infos[idx]
+	return g.paths[row]
 }
 
-func (g *Game) wrapBeatIndex(idx int) int {
-	if len(g.beatInfos) == 0 {
-		return 0
-	}
-	if idx < len(g.beatInfos) {
-		return idx
-	}
-	if !g.isLoop {
-		return len(g.beatInfos) - 1
-	}
-	loopLen := len(g.beatInfos) - g.loopStartIndex
-	if loopLen <= 0 {
-		return len(g.beatInfos) - 1
-	}
-	return g.loopStartIndex + (idx-g.loopStartIndex)%loopLen
+// syncTracks hands the drum rows to the engine and refreshes the voices it
+// plays them with. It reports whether the engine recomputed the paths.
+func (g *Game) syncTracks() bool {
+	return g.engine.SetTracks(g.tracks())
 }
 
-func (g *Game) wrapBeatIndexRow(row, idx int) int {
-	if row < 0 || row >= len(g.beatInfosByRow) {
-		return 0
-	}
-	infos := g.beatInfosByRow[row]
-	if len(infos) == 0 {
-		return 0
+// tracks builds the engine tracks from the drum rows and publishes the
+// matching voices.
+func (g *Game) tracks() []engine.Track {
+	anySolo := false
+	for _, r := range g.drum.Rows {
+		anySolo = anySolo || r.Solo
 	}
-	if idx < len(infos) {
-		return idx
-	}
-	if !g.isLoopByRow[row] {
-		return len(infos) - 1
-	}
-	loopLen := len(infos) - g.loopStartByRow[row]
-	if loopLen <= 0 {
-		return len(infos) - 1
-	}
-	return g.loopStartByRow[row] + (idx-g.loopStartByRow[row])%loopLen
+	tracks := make([]engine.Track, len(g.drum.Rows))
+	voices := make([]voice, len(g.drum.Rows))
+	for i, r := range g.drum.Rows {
+		tracks[i] = engine.Track{
+			Origin:     g.rowOrigin(i),
+			Length:     r.Length,
+			Rate:       r.Rate,
+			Instrument: r.Instrument,
+			Velocity:   r.Volume,
+			Muted:      r.Muted || (anySolo && !r.Solo),
+		}
+		voices[i] = rowVoice(r)
+	}
+	g.voiceMu.Lock()
+	g.voices = voices
+	g.voiceMu.Unlock()
+	return tracks
 }
 
-func (g *Game) resetOriginSequences() {
-	for row := range g.originIdxsByRow {
-		positions := g.originIdxsByRow[row]
-		seq := 0
-		if len(positions) > 1 {
-			beat := 0
-			if row < len(g.nextBeatIdxs) {
-				beat = g.nextBeatIdxs[row]
-			}
-			for i, idx := range positions {
-				if beat <= idx {
-					seq = i
-					break
-				}
-			}
-			if beat > positions[len(positions)-1] {
-				seq = 0
-			}
-		}
-		if row < len(g.nextOriginIdxByRow) {
-			g.nextOriginIdxByRow[row] = seq
-		}
+// rowOrigin returns the node row's path starts from: the start node for
+// row 0, the row's own origin for the others.
+func (g *Game) rowOrigin(row int) model.NodeID {
+	if row == 0 {
+		return g.graph.StartNodeID
 	}
+	return g.drum.Rows[row].Origin
 }
 
 func (g *Game) refreshDrumRow() {
@@ -608,8 +466,9 @@ func (g *Game) refreshDrumRow() {
 	g.drumBeatInfos = make([]model.BeatInfo, g.drum.Length)
 	for rowIdx, r := range g.drum.Rows {
 		r.Steps = make([]bool, g.drum.Length)
+		r.period = g.path(rowIdx).Period()
 		for i := 0; i < g.drum.Length; i++ {
-			info := g.beatInfoAtRow(rowIdx, g.drum.Offset+i)
+			info := g.path(rowIdx).At(g.drum.Offset + i)
 			if rowIdx == 0 {
 				g.drumBeatInfos[i] = info
 			}
@@ -619,6 +478,83 @@ func (g *Game) refreshDrumRow() {
 	g.logger.Debugf("[GAME] refreshDrumRow: offset=%d", g.drum.Offset)
 }
 
+// toggleStep flips the drum cell at the given absolute beat of a row by
+// toggling the node the row's path plays there. A beat past the end of the
+// path extends it, and a row without an origin gets one below the grid's
+// other nodes first.
+func (g *Game) toggleStep(row, beat int) bool {
+	if row < 0 || row >= len(g.drum.Rows) || beat < 0 {
+		return false
+	}
+	r := g.drum.Rows[row]
+	origin := g.rowOrigin(row)
+	if _, ok := g.graph.Nodes[origin]; !ok {
+		origin = g.newRowOrigin(row)
+	}
+	if r.Length > 0 {
+		beat %= r.Length
+	}
+	if !g.graph.ToggleStepFrom(origin, beat) {
+		g.logger.Warnf("[GAME] Cannot toggle beat %d of row %d", beat, row)
+		return false
+	}
+	g.adoptGraph()
+	g.updateBeatInfos()
+	return true
+}
+
+// newRowOrigin starts a row's path on an invisible node two cells below the
+// lowest node on the grid, and returns it.
+func (g *Game) newRowOrigin(row int) model.NodeID {
+	i, j := 0, 0
+	for k, n := range g.nodes {
+		if k == 0 || n.I < i {
+			i = n.I
+		}
+		if k == 0 || n.J+2 > j {
+			j = n.J + 2
+		}
+	}
+	id := g.graph.AddNode(i, j, model.NodeTypeInvisible)
+	n := &uiNode{ID: id, I: i, J: j, X: float64(i * GridStep), Y: float64(j * GridStep), Start: true}
+	g.nodes = append(g.nodes, n)
+	r := g.drum.Rows[row]
+	if r.Node != nil {
+		r.Node.Start = false
+	}
+	r.Origin, r.Node = id, n
+	if row == 0 {
+		g.start = n
+		g.graph.StartNodeID = id
+	}
+	return id
+}
+
+// adoptGraph adds grid nodes and edges for those added to the graph
+// directly, such as a path extended from the drum view.
+func (g *Game) adoptGraph() {
+	known := make(map[model.NodeID]*uiNode, len(g.nodes))
+	for _, n := range g.nodes {
+		known[n.ID] = n
+	}
+	for _, id := range slices.Sorted(maps.Keys(g.graph.Nodes)) {
+		if known[id] == nil {
+			n := g.graph.Nodes[id]
+			known[id] = &uiNode{ID: id, I: n.I, J: n.J, X: float64(n.I * GridStep), Y: float64(n.J * GridStep)}
+			g.nodes = append(g.nodes, known[id])
+		}
+	}
+	have := make(map[[2]model.NodeID]bool, len(g.edges))
+	for _, e := range g.edges {
+		have[[2]model.NodeID{e.A.ID, e.B.ID}] = true
+	}
+	for k := range g.graph.Edges {
+		if !have[k] {
+			g.edges = append(g.edges, uiEdge{A: known[k[0]], B: known[k[1]], t: 0, pulse: -1})
+		}
+	}
+}
+
 func (g *Game) addEdge(a, b *uiNode) {
 	if !(a.I == b.I || a.J == b.J) { // only orthogonal
 		return
@@ -748,20 +684,13 @@ func (g *Game) handleEditor() {
 		g.logger.Debugf("[GAME] Mouse down at screen=(%d, %d), grid=(%d, %d)", x, y, i, j)
 	}
 	if !left && g.leftPrev {
-		if g.pendingClick && !g.camDragged {
+		if g.pendingClick && !g.camDragged && g.pendingEuclid >= 0 {
+			g.placeEuclid(g.pendingEuclid, g.clickI, g.clickJ, g.drum.Rows[g.pendingEuclid].Euclid)
+			g.pendingEuclid = -1
+		} else if g.pendingClick && !g.camDragged {
 			g.logger.Debugf("[GAME] Mouse up at screen=(%d, %d), grid=(%d, %d)", x, y, i, j)
 			g.logger.Debugf("[GAME] Add/select node: %d,%d", g.clickI, g.clickJ)
-			n := g.tryAddNode(g.clickI, g.clickJ, model.NodeTypeRegular)
-			if g.sel != n {
-				if g.sel != nil {
-					g.logger.Debugf("[GAME] Deselecting node: %d,%d", g.sel.I, g.sel.J)
-					g.sel.Selected = false
-				}
-				g.logger.Debugf("[GAME] Selecting node: %d,%d", n.I, n.J)
-				g.sel = n
-				n.Selected = true
-				g.computeSelNeighbors()
-			}
+			g.selectNode(g.tryAddNode(g.clickI, g.clickJ, model.NodeTypeRegular))
 		}
 		g.pendingClick = false
 		g.camDragged = false
@@ -780,6 +709,21 @@ func (g *Game) handleEditor() {
 	g.leftPrev = left
 }
 
+// selectNode makes n the selected node.
+func (g *Game) selectNode(n *uiNode) {
+	if g.sel == n {
+		return
+	}
+	if g.sel != nil {
+		g.logger.Debugf("[GAME] Deselecting node: %d,%d", g.sel.I, g.sel.J)
+		g.sel.Selected = false
+	}
+	g.logger.Debugf("[GAME] Selecting node: %d,%d", n.I, n.J)
+	g.sel = n
+	n.Selected = true
+	g.computeSelNeighbors()
+}
+
 // blocksAt reports whether any UI overlay blocks interaction at (x,y).
 func (g *Game) blocksAt(x, y int) bool {
 	if g.drum != nil && g.drum.BlocksAt(x, y) {
@@ -820,70 +764,13 @@ func (g *Game) handleLinkDrag(left, right bool, gx, gy float64, i, j int) {
 	}
 }
 
-func (g *Game) spawnPulseFromRow(row, start int) {
-	g.logger.Debugf("[GAME] Spawn pulse for row %d from %d", row, start)
-	if row < 0 || row >= len(g.beatInfosByRow) {
-		return
-	}
-	path := g.beatInfosByRow[row]
-	if len(path) == 0 {
-		g.logger.Infof("[GAME] Spawn pulse: No beat information available for row %d", row)
-		return
-	}
-	curIdxWrapped := g.wrapBeatIndexRow(row, start)
-	beatDuration := int64(60.0 / float64(g.drum.bpm) * ebitenTPS)
-	fromBeatInfo := path[curIdxWrapped]
-	g.nextBeatIdxs[row] = start
-	g.highlightBeat(row, g.nextBeatIdxs[row], fromBeatInfo, beatDuration)
-	g.nextBeatIdxs[row]++
-	if row == 0 {
-		g.elapsedBeats = g.nextBeatIdxs[row]
-	}
-	nextInfo := g.beatInfoAtRow(row, start+1)
-	if nextInfo.NodeID != model.InvalidNodeID {
-		nextIdxWrapped := g.wrapBeatIndexRow(row, start+1)
-		p := &pulse{
-			x1:           float64(fromBeatInfo.I * GridStep),
-			y1:           float64(fromBeatInfo.J * GridStep),
-			x2:           float64(nextInfo.I * GridStep),
-			y2:           float64(nextInfo.J * GridStep),
-			speed:        1.0 / float64(beatDuration),
-			fromBeatInfo: fromBeatInfo,
-			toBeatInfo:   nextInfo,
-			pathIdx:      nextIdxWrapped,
-			lastIdx:      start,
-			from:         g.nodeByID(fromBeatInfo.NodeID),
-			to:           g.nodeByID(nextInfo.NodeID),
-			path:         path,
-			row:          row,
-		}
-		g.activePulses = append(g.activePulses, p)
-		if row == 0 {
-			g.activePulse = p
-		}
-	} else if row == 0 {
-		g.activePulse = nil
-	}
-}
-
-// spawnPulseFrom is kept for compatibility with tests; it spawns a pulse for the
-// primary drum row.
-func (g *Game) spawnPulseFrom(start int) { g.spawnPulseFromRow(0, start) }
-
 /* ─────────────── Update & tick ────────────────────────────────────────── */
 
 func (g *Game) Update() error {
 	g.logger.Debugf("[GAME] Update start: frame=%d playing=%t bpm=%d currentStep=%d", g.frame, g.playing, g.bpm, g.currentStep)
-	// Process engine events without blocking
-	for {
-		select {
-		case evt := <-g.engine.Events:
-			g.onTick(evt.Step)
-		default:
-			goto eventsDone
-		}
-	}
-eventsDone:
+	g.drainEvents()
+	g.drainMIDI()
+	g.drainOSC()
 	// splitter
 	g.split.Update(g.winH)
 	g.drum.SetBounds(image.Rect(0, g.split.Y, g.winW, g.winH))
@@ -905,6 +792,7 @@ eventsDone:
 	} else {
 		g.leftPrev = left
 	}
+	g.handleKeys()
 
 	// edge animation progress
 	for i := range g.edges {
@@ -923,28 +811,10 @@ eventsDone:
 	}
 	g.frame++
 
-	for i := 0; i < len(g.activePulses); {
-		p := g.activePulses[i]
-		g.logger.Debugf("[GAME] Update: processing active pulse row=%d t=%.2f from=%+v to=%+v", p.row, p.t, p.fromBeatInfo, p.toBeatInfo)
-		p.t += p.speed
-		if p.t >= 1 {
-			prevIdx := p.lastIdx
-			delete(g.highlightedBeats, makeBeatKey(p.row, prevIdx))
-			if !g.advancePulse(p) {
-				g.logger.Infof("[GAME] Update: pulse for row %d removed", p.row)
-				if p.row == 0 {
-					g.activePulse = nil
-				}
-				g.activePulses = append(g.activePulses[:i], g.activePulses[i+1:]...)
-				for key := range g.highlightedBeats {
-					if r, _ := splitBeatKey(key); r == p.row {
-						delete(g.highlightedBeats, key)
-					}
-				}
-				continue
-			}
-		}
-		i++
+	// Pulses glide towards their next node and wait there for the engine
+	// to play it.
+	for _, p := range g.activePulses {
+		p.t = math.Min(p.t+p.speed, 1)
 	}
 
 	// Clear expired highlights
@@ -960,10 +830,22 @@ eventsDone:
 		g.pendingStartRow = idx
 	}
 	for _, idx := range g.drum.ConsumeOriginRequests() {
-		g.pendingStartRow = idx
+		g.pendingStartRow, g.pendingEuclid = idx, -1
+	}
+	for _, idx := range g.drum.ConsumeEuclidRequests() {
+		g.pendingEuclid, g.pendingStartRow = idx, -1
+	}
+	for _, req := range g.drum.ConsumeToolRequests() {
+		g.applyRowTool(req.row, req.tool)
+	}
+	for _, c := range g.drum.ConsumeStepToggles() {
+		g.toggleStep(c[0], c[1])
 	}
 	deleted := g.drum.ConsumeDeletedRows()
 	for _, dr := range deleted {
+		// Drop the track first so the rows below keep their positions when
+		// deleting the origin resyncs the engine.
+		g.engine.RemoveTrack(dr.index)
 		if dr.origin != model.InvalidNodeID {
 			if n := g.nodeByID(dr.origin); n != nil {
 				g.deleteNode(n)
@@ -971,15 +853,16 @@ eventsDone:
 				g.graph.RemoveNode(dr.origin)
 			}
 		}
-		// drop playback indices for deleted row and shift later ones
-		if dr.index < len(g.nextBeatIdxs) {
-			g.nextBeatIdxs = append(g.nextBeatIdxs[:dr.index], g.nextBeatIdxs[dr.index+1:]...)
-		}
 		if g.pendingStartRow == dr.index {
 			g.pendingStartRow = -1
 		} else if g.pendingStartRow > dr.index {
 			g.pendingStartRow--
 		}
+		if g.pendingEuclid == dr.index {
+			g.pendingEuclid = -1
+		} else if g.pendingEuclid > dr.index {
+			g.pendingEuclid--
+		}
 		// purge pulses belonging to this row and shift remaining indices
 		out := g.activePulses[:0]
 		for _, p := range g.activePulses {
@@ -1000,9 +883,11 @@ eventsDone:
 			}
 		}
 	}
-	if len(deleted) > 0 {
+	g.engine.SetQuantize(g.drum.Quantize)
+	if g.syncTracks() || len(deleted) > 0 {
 		g.updateBeatInfos()
 	}
+	g.drum.pending = g.engine.Pending()
 	if g.drum.OffsetChanged() {
 		g.refreshDrumRow()
 	}
@@ -1019,6 +904,20 @@ eventsDone:
 	if g.drum.StopPressed() {
 		g.playing = false
 	}
+	if g.engine.Following() {
+		// An external MIDI clock owns the tempo and the transport.
+		if bpm := g.engine.BPM(); bpm > 0 && bpm != g.drum.BPM() {
+			g.drum.SetBPM(bpm)
+		}
+		g.playing = g.engine.Running() && g.start != nil
+	} else if g.netSync != nil {
+		// Local tempo edits go to the session; the session's tempo wins otherwise.
+		if bpm := g.drum.BPM(); bpm != prevBPM {
+			g.netSync.SetTempo(float64(bpm))
+		} else if bpm := int(math.Round(g.netSync.Tempo())); bpm > 0 && bpm != g.drum.BPM() {
+			g.drum.SetBPM(bpm)
+		}
+	}
 	g.bpm = g.drum.BPM()
 
 	if g.bpm != prevBPM {
@@ -1037,24 +936,26 @@ eventsDone:
 	if g.playing != prevPlaying {
 		g.logger.Infof("[GAME] Playing state changed: %t -> %t", prevPlaying, g.playing)
 		if g.playing {
-			for i := range g.nextBeatIdxs {
-				g.nextBeatIdxs[i] = 0
-			}
-			g.resetOriginSequences()
 			g.elapsedBeats = 0
 			g.activePulses = nil
 			g.activePulse = nil
 			g.highlightedBeats = map[int]int64{}
-			g.engine.Start()
-			g.logger.Infof("[GAME] Engine started.")
-		} else {
+			if !g.engine.Following() {
+				g.engine.Start()
+				g.logger.Infof("[GAME] Engine started.")
+			} else {
+				g.engine.Rewind()
+			}
+		} else if !g.engine.Following() {
 			g.engine.Stop()
 			g.logger.Infof("[GAME] Engine stopped.")
 		}
 	}
 
 	if g.playing {
-		g.engine.SetBPM(g.bpm)
+		if !g.engine.Following() {
+			g.engine.SetBPM(g.bpm)
+		}
 	} else {
 		g.logger.Infof("[GAME] Update: stopping playback, removing active pulses.")
 		g.activePulses = nil
@@ -1062,7 +963,7 @@ eventsDone:
 	}
 
 	if prevLen != g.drum.Length {
-		maxOffset := len(g.beatInfos) - g.drum.Length
+		maxOffset := len(g.path(0).Beats) - g.drum.Length
 		if maxOffset < 0 {
 			maxOffset = 0
 		}
@@ -1071,6 +972,7 @@ eventsDone:
 		}
 		g.refreshDrumRow()
 	}
+	g.autosave()
 	g.logger.Debugf("[GAME] Update end. Frame: %d", g.frame)
 	return nil
 }
@@ -1080,6 +982,7 @@ eventsDone:
 func (g *Game) Draw(screen *ebiten.Image) {
 	g.drawGridPane(screen) // top
 	g.drawDrumPane(screen) // bottom (includes buttons)
+	g.drawHelp(screen)
 }
 
 func (g *Game) drawGridPane(screen *ebiten.Image) {
@@ -1164,6 +1067,8 @@ func (g *Game) drawGridPane(screen *ebiten.Image) {
 		}
 	}
 
+	g.drawCursor(screen, &cam)
+
 	// pulses
 	g.renderedPulsesCount = 0
 	for _, p := range g.activePulses {
@@ -1219,49 +1124,152 @@ func (g *Game) pulseForRow(row int) *pulse {
 	return nil
 }
 
-func (g *Game) onTick(step int) {
-	g.logger.Debugf("[GAME] On tick: step %d", step)
-	g.currentStep = step
+// drainEvents shows the engine events received since the last frame.
+func (g *Game) drainEvents() {
+	if g.events == nil {
+		return
+	}
+	if d := g.events.Dropped(); d > g.droppedEvents {
+		g.logger.Warnf("[GAME] Dropped %d engine events", d-g.droppedEvents)
+		g.droppedEvents = d
+	}
+	for {
+		select {
+		case ev := <-g.events.C:
+			g.onEvent(ev)
+		default:
+			return
+		}
+	}
+}
 
-	if step == 0 {
-		for row := range g.drum.Rows {
-			if g.pulseForRow(row) == nil {
-				if row == 0 && g.start == nil {
-					continue
-				}
-				if row > 0 && g.drum.Rows[row].Origin == model.InvalidNodeID {
-					continue
-				}
-				g.spawnPulseFromRow(row, g.nextBeatIdxs[row])
-			}
+// onEvent shows what the engine played: a row's beat is highlighted while
+// its pulse sets off for the next node.
+func (g *Game) onEvent(ev engine.Event) {
+	switch ev.Kind {
+	case engine.EventStep:
+		g.logger.Debugf("[GAME] On tick: step %d", ev.Step)
+		g.currentStep = ev.Step
+		return
+	case engine.EventGraph:
+		g.refreshPaths()
+		return
+	}
+	beatFrames := int64(60.0 / float64(g.bpm) * ebitenTPS)
+	p := g.pulseForRow(ev.Row)
+	if p != nil {
+		delete(g.highlightedBeats, makeBeatKey(ev.Row, p.beat))
+	}
+	g.highlightedBeats[makeBeatKey(ev.Row, ev.Beat)] = g.frame + beatFrames
+	if ev.Row == 0 {
+		g.elapsedBeats = ev.Beat + 1
+	}
+	if ev.Next == model.InvalidNodeID {
+		g.logger.Infof("[GAME] Pulse for row %d reached the end of its path", ev.Row)
+		g.removePulse(ev.Row)
+		return
+	}
+	if p == nil {
+		p = &pulse{row: ev.Row}
+		g.activePulses = append(g.activePulses, p)
+	}
+	if ev.Row == 0 {
+		g.activePulse = p
+	}
+	p.fromID, p.toID, p.beat = ev.Node, ev.Next, ev.Beat
+	p.from, p.to = g.nodeByID(ev.Node), g.nodeByID(ev.Next)
+	if p.from != nil {
+		p.x1, p.y1 = p.from.X, p.from.Y
+	}
+	if p.to != nil {
+		p.x2, p.y2 = p.to.X, p.to.Y
+	}
+	p.t, p.speed = 0, 1.0/float64(beatFrames)
+}
+
+// removePulse drops row's pulse.
+func (g *Game) removePulse(row int) {
+	out := g.activePulses[:0]
+	for _, p := range g.activePulses {
+		if p.row != row {
+			out = append(out, p)
 		}
 	}
+	g.activePulses = out
+	if g.activePulse != nil && g.activePulse.row == row {
+		g.activePulse = nil
+	}
 }
 
-func (g *Game) highlightBeat(row, idx int, info model.BeatInfo, duration int64) {
-	key := makeBeatKey(row, idx)
-	g.highlightedBeats[key] = g.frame + duration
-	if info.NodeType == model.NodeTypeRegular {
-		inst := "snare"
-		vol := 1.0
-		if row < len(g.drum.Rows) {
-			inst = g.drum.Rows[row].Instrument
-			vol = g.drum.Rows[row].Volume
-			anySolo := false
-			for _, r := range g.drum.Rows {
-				if r.Solo {
-					anySolo = true
-					break
-				}
-			}
-			if g.drum.Rows[row].Muted || (anySolo && !g.drum.Rows[row].Solo) {
-				g.logger.Debugf("[GAME] highlightBeat: muted row %d", row)
-				return
-			}
+// voice is how a row sounds: the audio hit to trigger and its MIDI note.
+type voice struct {
+	hit           audio.Hit
+	channel, note int
+}
+
+func rowVoice(r *DrumRow) voice {
+	return voice{
+		hit: audio.Hit{
+			Instrument: r.Instrument,
+			Volume:     r.Volume,
+			Pan:        r.Pan,
+			Choke:      r.Choke,
+			Params:     r.Params,
+			Bus:        r.Bus,
+			FX:         r.Effects,
+		},
+		channel: r.MIDIChannel,
+		note:    r.MIDINote,
+	}
+}
+
+// play sounds v on the audio engine and on its MIDI channel.
+func (v voice) play() {
+	playSound(v.hit)
+	if v.channel > 0 {
+		if vel := midiVelocity(v.hit.Volume); vel > 0 {
+			sendMIDI(v.channel, v.note, vel)
+		}
+	}
+}
+
+// playHit sounds a hit the engine played. It runs on the engine goroutine,
+// so it only reads the voices published by syncTracks.
+func (g *Game) playHit(ev engine.Event) {
+	v := voice{hit: audio.Hit{Instrument: ev.Instrument}}
+	g.voiceMu.Lock()
+	if ev.Row >= 0 && ev.Row < len(g.voices) {
+		v = g.voices[ev.Row]
+	}
+	g.voiceMu.Unlock()
+	v.hit.Instrument = ev.Instrument
+	v.hit.Volume = ev.Velocity
+	// The beat came due moments ago; past times play at once.
+	v.hit.When = audio.Now() - time.Since(ev.Time).Seconds()
+	v.play()
+}
+
+// playRow sounds one hit of row at the given fraction of its volume, as
+// when a pad is played live. Muted rows, and rows left out of an active solo,
+// stay silent.
+func (g *Game) playRow(row int, gain float64) {
+	v := voice{hit: audio.Hit{Instrument: "snare", Volume: gain}}
+	if row < len(g.drum.Rows) {
+		r := g.drum.Rows[row]
+		anySolo := false
+		for _, r := range g.drum.Rows {
+			anySolo = anySolo || r.Solo
+		}
+		if r.Muted || (anySolo && !r.Solo) {
+			g.logger.Debugf("[GAME] playRow: muted row %d", row)
+			return
 		}
-		playSound(inst, vol, audio.Now())
-		g.logger.Debugf("[GAME] highlightBeat: Played %s at vol %.2f for node %d at beat %d row %d", inst, vol, info.NodeID, idx, row)
+		v = rowVoice(r)
+		v.hit.Volume *= gain
 	}
+	v.hit.When = audio.Now()
+	v.play()
+	g.logger.Debugf("[GAME] playRow: Played %s at vol %.2f row %d", v.hit.Instrument, v.hit.Volume, row)
 }
 
 func (g *Game) clearExpiredHighlights() {
@@ -1274,6 +1282,10 @@ func (g *Game) clearExpiredHighlights() {
 	}
 }
 
+// BPM returns the tempo shown in the BPM box.
+func (g *Game) BPM() int { return g.drum.BPM() }
+
+// Seek moves playback to the given beat of every row's path.
 func (g *Game) Seek(beats int) {
 	if beats < 0 {
 		beats = 0
@@ -1281,99 +1293,10 @@ func (g *Game) Seek(beats int) {
 	g.highlightedBeats = map[int]int64{}
 	g.activePulses = nil
 	g.activePulse = nil
-	if g.playing {
-		for row := range g.drum.Rows {
-			g.spawnPulseFromRow(row, beats)
-		}
-	} else {
-		for i := range g.nextBeatIdxs {
-			g.nextBeatIdxs[i] = beats
-		}
+	g.engine.Seek(beats)
+	if !g.playing {
 		g.elapsedBeats = beats
 	}
-	g.resetOriginSequences()
-}
-
-func (g *Game) advancePulse(p *pulse) bool {
-	beatDuration := int64(60.0 / float64(g.bpm) * ebitenTPS)
-
-	// The pulse has arrived at p.toBeatInfo. Highlight it.
-	arrivalBeatInfo := p.toBeatInfo
-	arrivalPathIdx := p.pathIdx
-
-	g.logger.Debugf("[GAME] advancePulse: Pulse arrived at beat index %d: %+v", arrivalPathIdx, arrivalBeatInfo)
-	if p.row < len(g.drum.Rows) {
-		origin := g.drum.Rows[p.row].Origin
-		if origin != model.InvalidNodeID && arrivalBeatInfo.NodeID == origin &&
-			p.row < len(g.nextOriginIdxByRow) && p.row < len(g.originIdxsByRow) {
-
-			seq := g.nextOriginIdxByRow[p.row]
-			positions := g.originIdxsByRow[p.row]
-			expectedIdx := 0
-			if seq < len(positions) {
-				expectedIdx = positions[seq]
-			}
-			if arrivalPathIdx != expectedIdx {
-				g.logger.Errorf("pulse jumped to origin out of order: row=%d idx=%d expected=%d", p.row, arrivalPathIdx, expectedIdx)
-				panic(fmt.Sprintf("pulse jumped to origin out of order: row=%d idx=%d expected=%d", p.row, arrivalPathIdx, expectedIdx))
-			}
-			seq++
-			if seq >= len(positions) {
-				seq = 0
-			}
-			g.nextOriginIdxByRow[p.row] = seq
-		}
-	}
-
-	g.highlightBeat(p.row, g.nextBeatIdxs[p.row], arrivalBeatInfo, beatDuration)
-	p.lastIdx = g.nextBeatIdxs[p.row]
-	g.nextBeatIdxs[p.row]++
-	if p.row == 0 {
-		g.elapsedBeats = g.nextBeatIdxs[p.row]
-	}
-
-	// Advance pathIdx for the *next* pulse segment
-	p.pathIdx++
-
-	// If the end of the path is reached, check for a loop.
-	path := p.path
-	if p.pathIdx >= len(path) {
-		if g.isLoopByRow[p.row] {
-			p.pathIdx = g.loopStartByRow[p.row]
-		} else {
-			return false
-		}
-	}
-
-	// Set up the next segment of the pulse's journey.
-	prevIdx := p.pathIdx - 1
-	if prevIdx < 0 {
-		if g.isLoopByRow[p.row] {
-			prevIdx = len(path) - 1
-		} else {
-			return false
-		}
-	}
-	if g.isLoopByRow[p.row] && p.pathIdx == g.loopStartByRow[p.row] {
-		prevIdx = len(path) - 1
-	}
-	p.fromBeatInfo = path[prevIdx]
-	p.toBeatInfo = path[p.pathIdx]
-	p.from = g.nodeByID(p.fromBeatInfo.NodeID)
-	p.to = g.nodeByID(p.toBeatInfo.NodeID)
-
-	if p.from == nil || p.to == nil {
-		return false
-	}
-
-	// Set pulse start and end coordinates for animation
-	p.x1 = p.from.X
-	p.y1 = p.from.Y
-	p.x2 = p.to.X
-	p.y2 = p.to.Y
-	p.t = 0 // Reset animation progress
-
-	return true
 }
 
 func visibleWorldRect(cam *Camera, screenW, screenH int) (minX, maxX, minY, maxY float64) {
@@ -0,0 +1,98 @@
+package ui
+
+import (
+	"math/rand/v2"
+
+	"github.com/ingyamilmolinar/tunkul/core/model"
+)
+
+// rowTool is an FX panel action that rewrites which nodes along a row's
+// path are hits.
+type rowTool int
+
+const (
+	toolRandomize rowTool = iota
+	toolMutate
+	toolShiftLeft
+	toolShiftRight
+	toolReverse
+)
+
+// rowToolRequest asks the game to apply tool to a drum row.
+type rowToolRequest struct {
+	row  int
+	tool rowTool
+}
+
+// SetSeed reseeds the generator behind the randomize and mutate tools, so
+// the same seed and actions give the same variations.
+func (g *Game) SetSeed(seed uint64) {
+	g.rng = rand.New(rand.NewPCG(seed, seed))
+}
+
+// rowNodes returns the nodes one lap of the row's path visits, in the order
+// it first reaches them. It walks the graph being edited rather than the
+// engine's paths, which lag behind edits launch quantization holds back.
+// Nodes shared with another row's path are included and change for both.
+func (g *Game) rowNodes(row int) []model.NodeID {
+	if row < 0 || row >= len(g.drum.Rows) {
+		return nil
+	}
+	// As in the engine, a generous beat length returns the whole path.
+	length := g.graph.BeatLength()
+	g.graph.SetBeatLength(int(g.graph.Next))
+	beats, _, _ := g.graph.CalculateBeatRowFrom(g.rowOrigin(row))
+	g.graph.SetBeatLength(length)
+	if n := g.drum.Rows[row].Length; n > 0 && n < len(beats) {
+		beats = beats[:n]
+	}
+	var ids []model.NodeID
+	seen := map[model.NodeID]bool{}
+	for _, b := range beats {
+		if b.NodeID == model.InvalidNodeID || seen[b.NodeID] {
+			continue
+		}
+		seen[b.NodeID] = true
+		ids = append(ids, b.NodeID)
+	}
+	return ids
+}
+
+// applyRowTool rewrites the hits along a row's path, turning nodes regular
+// or invisible, and reports whether the row had nodes to change.
+func (g *Game) applyRowTool(row int, tool rowTool) bool {
+	if row < 0 || row >= len(g.drum.Rows) {
+		return false
+	}
+	ids := g.rowNodes(row)
+	if len(ids) == 0 {
+		return false
+	}
+	p := make([]bool, len(ids))
+	for k, id := range ids {
+		p[k] = g.graph.Nodes[id].Type == model.NodeTypeRegular
+	}
+	switch tool {
+	case toolRandomize:
+		p = model.Randomize(p, g.rng)
+	case toolMutate:
+		p = model.Mutate(p, g.drum.Rows[row].Mutations, g.rng)
+	case toolShiftLeft:
+		p = model.Shift(p, -1)
+	case toolShiftRight:
+		p = model.Shift(p, 1)
+	case toolReverse:
+		p = model.Reverse(p)
+	}
+	for k, id := range ids {
+		n := g.graph.Nodes[id]
+		n.Type = model.NodeTypeInvisible
+		if p[k] {
+			n.Type = model.NodeTypeRegular
+		}
+		g.graph.Nodes[id] = n
+	}
+	g.logger.Debugf("[GAME] Row %d tool %d rewrote %d nodes", row, tool, len(ids))
+	g.updateBeatInfos()
+	return true
+}
@@ -0,0 +1,110 @@
+package ui
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ingyamilmolinar/tunkul/core/model"
+)
+
+// rowPattern reads which nodes along the row's path are hits.
+func rowPattern(g *Game, row int) []bool {
+	var p []bool
+	for _, id := range g.rowNodes(row) {
+		p = append(p, g.graph.Nodes[id].Type == model.NodeTypeRegular)
+	}
+	return p
+}
+
+func euclidGame(t *testing.T, seed uint64) *Game {
+	t.Helper()
+	g := New(testLogger)
+	g.Layout(640, 480)
+	g.SetSeed(seed)
+	if !g.placeEuclid(0, 0, 0, model.Euclid{Steps: 8, Pulses: 3}) {
+		t.Fatal("placeEuclid failed")
+	}
+	return g
+}
+
+func TestRowToolsRewriteThePath(t *testing.T) {
+	g := euclidGame(t, 1)
+	tresillo := []bool{true, false, false, true, false, false, true, false}
+	if got := rowPattern(g, 0); !slices.Equal(got, tresillo) {
+		t.Fatalf("row pattern %v, want %v", got, tresillo)
+	}
+
+	g.applyRowTool(0, toolShiftRight)
+	if got, want := rowPattern(g, 0), model.Shift(tresillo, 1); !slices.Equal(got, want) {
+		t.Fatalf("shifted right to %v, want %v", got, want)
+	}
+	g.applyRowTool(0, toolShiftLeft)
+	g.applyRowTool(0, toolReverse)
+	if got, want := rowPattern(g, 0), model.Reverse(tresillo); !slices.Equal(got, want) {
+		t.Fatalf("reversed to %v, want %v", got, want)
+	}
+	if got := g.path(0).At(1).NodeType; got != model.NodeTypeRegular {
+		t.Fatalf("engine path beat 1 is %v after reverse, want a hit", got)
+	}
+
+	before := rowPattern(g, 0)
+	g.drum.Rows[0].Mutations = 3
+	g.applyRowTool(0, toolMutate)
+	flipped := 0
+	for k, on := range rowPattern(g, 0) {
+		if on != before[k] {
+			flipped++
+		}
+	}
+	if flipped != 3 {
+		t.Fatalf("mutate flipped %d steps, want 3", flipped)
+	}
+}
+
+func TestRowNodesFollowQueuedEdits(t *testing.T) {
+	g := New(testLogger)
+	g.Layout(640, 480)
+	a := g.tryAddNode(0, 0, model.NodeTypeRegular)
+	b := g.tryAddNode(1, 0, model.NodeTypeRegular)
+	g.addEdge(a, b)
+	// An edit launch quantization holds back is in the graph but not yet in
+	// the paths the engine plays.
+	c := g.graph.AddNode(2, 0, model.NodeTypeInvisible)
+	g.graph.Edges[[2]model.NodeID{b.ID, c}] = struct{}{}
+	if got, want := g.rowNodes(0), []model.NodeID{a.ID, b.ID, c}; !slices.Equal(got, want) {
+		t.Fatalf("row nodes %v, want %v", got, want)
+	}
+	g.drum.Rows[0].Length = 2
+	if got, want := g.rowNodes(0), []model.NodeID{a.ID, b.ID}; !slices.Equal(got, want) {
+		t.Fatalf("row nodes %v with a length of 2, want %v", got, want)
+	}
+}
+
+func TestRowToolsAreReproducible(t *testing.T) {
+	a, b := euclidGame(t, 42), euclidGame(t, 42)
+	for range 3 {
+		a.applyRowTool(0, toolRandomize)
+		b.applyRowTool(0, toolRandomize)
+	}
+	if pa, pb := rowPattern(a, 0), rowPattern(b, 0); !slices.Equal(pa, pb) {
+		t.Fatalf("same seed gave %v and %v", pa, pb)
+	}
+	if g := New(testLogger); g.applyRowTool(0, toolRandomize) {
+		t.Fatal("randomized a row without a path")
+	}
+}
+
+func TestToolButtonReachesGame(t *testing.T) {
+	g := euclidGame(t, 1)
+	want := model.Reverse(rowPattern(g, 0))
+	g.drum.toggleFX(0)
+	for i, b := range toolButtons {
+		if b.tool == toolReverse {
+			g.drum.fx.toolBtns[i].OnClick()
+		}
+	}
+	g.Update()
+	if got := rowPattern(g, 0); !slices.Equal(got, want) {
+		t.Fatalf("Rev button left %v, want %v", got, want)
+	}
+}
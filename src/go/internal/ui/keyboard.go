@@ -0,0 +1,258 @@
+package ui
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/ingyamilmolinar/tunkul/core/model"
+)
+
+// keyBindings lists the grid editing keys shown by the help overlay.
+var keyBindings = [][2]string{
+	{"Arrows", "move the cursor"},
+	{"N", "place a node"},
+	{"X / Delete", "delete the node"},
+	{"E", "start an edge; on another node, link or unlink it"},
+	{"1-9", "pick the drum row O assigns"},
+	{"O", "make the node the picked row's origin"},
+	{"T", "toggle the node between hit and rest"},
+	{"Esc", "drop the edge, then hide the cursor"},
+	{"H", "show or hide this help"},
+}
+
+// cursorMoves maps the arrow keys to the grid step they move the cursor.
+var cursorMoves = []struct {
+	key    ebiten.Key
+	di, dj int
+}{
+	{ebiten.KeyArrowLeft, -1, 0},
+	{ebiten.KeyArrowRight, 1, 0},
+	{ebiten.KeyArrowUp, 0, -1},
+	{ebiten.KeyArrowDown, 0, 1},
+}
+
+// editKeys are the keys keyState samples every frame.
+var editKeys = []ebiten.Key{
+	ebiten.KeyArrowLeft, ebiten.KeyArrowRight, ebiten.KeyArrowUp, ebiten.KeyArrowDown,
+	ebiten.KeyN, ebiten.KeyX, ebiten.KeyDelete, ebiten.KeyE, ebiten.KeyO, ebiten.KeyT,
+	ebiten.KeyEscape, ebiten.KeyH,
+}
+
+// rowKeys pick drum rows 1 to 9 for the O key.
+var rowKeys = []ebiten.Key{
+	ebiten.KeyDigit1, ebiten.KeyDigit2, ebiten.KeyDigit3, ebiten.KeyDigit4, ebiten.KeyDigit5,
+	ebiten.KeyDigit6, ebiten.KeyDigit7, ebiten.KeyDigit8, ebiten.KeyDigit9,
+}
+
+// keyState counts the frames each editing key has been held. Sampling every
+// key once per frame, even while the keys are ignored, keeps a key held over
+// from typing from acting as a fresh press.
+type keyState map[ebiten.Key]int
+
+func (s keyState) update() {
+	for _, keys := range [][]ebiten.Key{editKeys, rowKeys} {
+		for _, k := range keys {
+			if isKeyPressed(k) {
+				s[k]++
+			} else {
+				s[k] = 0
+			}
+		}
+	}
+}
+
+// pressed reports whether k went down this frame.
+func (s keyState) pressed(k ebiten.Key) bool { return s[k] == 1 }
+
+// repeated reports a press of k, and repeats it while k is held.
+func (s keyState) repeated(k ebiten.Key) bool {
+	d := s[k]
+	return d == 1 || (d > 30 && d%6 == 0)
+}
+
+// gridCursor is the keyboard cursor on the grid.
+type gridCursor struct {
+	I, J    int
+	visible bool
+	link    *uiNode // node an edge is being drawn from, nil for none
+}
+
+// handleKeys edits the grid from the keyboard. The first arrow press shows
+// the cursor on the selected node, the start node or the middle of the view.
+func (g *Game) handleKeys() {
+	g.keys.update()
+	if g.drum.Typing() {
+		return
+	}
+	k := g.keys
+	if k.pressed(ebiten.KeyH) {
+		g.showHelp = !g.showHelp
+	}
+	for _, m := range cursorMoves {
+		if !k.repeated(m.key) {
+			continue
+		}
+		if g.cursor.visible {
+			g.cursor.I += m.di
+			g.cursor.J += m.dj
+		} else {
+			g.cursor.I, g.cursor.J = g.cursorHome()
+			g.cursor.visible = true
+		}
+		g.followCursor()
+	}
+	for row, key := range rowKeys {
+		if k.pressed(key) && row < len(g.drum.Rows) {
+			g.drum.selRow = row
+		}
+	}
+	if !g.cursor.visible {
+		return
+	}
+	if l := g.cursor.link; l != nil && g.nodeByID(l.ID) != l {
+		g.cursor.link = nil // deleted some other way
+	}
+
+	i, j := g.cursor.I, g.cursor.J
+	n := g.nodeAt(i, j)
+	switch {
+	case k.pressed(ebiten.KeyN):
+		g.selectNode(g.tryAddNode(i, j, model.NodeTypeRegular))
+	case (k.pressed(ebiten.KeyX) || k.pressed(ebiten.KeyDelete)) && n != nil:
+		if g.cursor.link == n {
+			g.cursor.link = nil
+		}
+		g.deleteNode(n)
+	case k.pressed(ebiten.KeyE):
+		g.linkKey(n)
+	case k.pressed(ebiten.KeyO):
+		g.pendingStartRow, g.pendingEuclid = g.drum.selRow, -1
+		g.tryAddNode(i, j, model.NodeTypeRegular)
+		g.pendingStartRow = -1
+	case k.pressed(ebiten.KeyT) && n != nil:
+		node := g.graph.Nodes[n.ID]
+		if node.Type == model.NodeTypeRegular {
+			node.Type = model.NodeTypeInvisible
+		} else {
+			node.Type = model.NodeTypeRegular
+		}
+		g.graph.Nodes[n.ID] = node
+		g.updateBeatInfos()
+	case k.pressed(ebiten.KeyEscape):
+		if g.cursor.link != nil {
+			g.cursor.link = nil
+		} else {
+			g.cursor.visible = false
+		}
+	}
+}
+
+// cursorHome returns where the cursor appears when it is first shown.
+func (g *Game) cursorHome() (int, int) {
+	if g.sel != nil {
+		return g.sel.I, g.sel.J
+	}
+	if g.start != nil {
+		return g.start.I, g.start.J
+	}
+	wx := (float64(g.winW)/2 - g.cam.OffsetX) / g.cam.Scale
+	wy := (float64(g.split.Y-topOffset)/2 - g.cam.OffsetY) / g.cam.Scale
+	_, _, i, j := Snap(wx, wy)
+	return i, j
+}
+
+// followCursor pans the camera so the cursor stays in the grid pane.
+func (g *Game) followCursor() {
+	const margin = 40
+	stepPx := float64(StepPixels(g.cam.Scale))
+	sx := math.Round(g.cam.OffsetX) + stepPx*float64(g.cursor.I)
+	sy := math.Round(g.cam.OffsetY) + stepPx*float64(g.cursor.J) + topOffset
+	if sx < margin {
+		g.cam.OffsetX += margin - sx
+	} else if right := float64(g.winW - margin); sx > right {
+		g.cam.OffsetX -= sx - right
+	}
+	if top := float64(topOffset + margin); sy < top {
+		g.cam.OffsetY += top - sy
+	} else if bottom := float64(g.split.Y - margin); sy > bottom {
+		g.cam.OffsetY -= sy - bottom
+	}
+}
+
+// linkKey starts an edge at n or ends the one in progress there: it links
+// the two nodes and carries on from n, or unlinks them if they already were.
+func (g *Game) linkKey(n *uiNode) {
+	from := g.cursor.link
+	switch {
+	case n == nil:
+		return
+	case from == nil:
+		g.cursor.link = n
+		return
+	case from == n:
+		g.cursor.link = nil
+		return
+	}
+	for _, e := range g.edges {
+		if (e.A == from && e.B == n) || (e.A == n && e.B == from) {
+			g.deleteEdge(e.A, e.B)
+			g.cursor.link = nil
+			return
+		}
+	}
+	g.addEdge(from, n)
+	if _, ok := g.graph.Edges[[2]model.NodeID{from.ID, n.ID}]; ok {
+		g.cursor.link = n
+	} else {
+		g.logger.Debugf("[GAME] Cannot link (%d,%d) to (%d,%d)", from.I, from.J, n.I, n.J)
+	}
+}
+
+// drawCursor outlines the keyboard cursor's cell and previews the edge in
+// progress.
+func (g *Game) drawCursor(screen *ebiten.Image, cam *ebiten.GeoM) {
+	if !g.cursor.visible {
+		return
+	}
+	x, y := float64(g.cursor.I*GridStep), float64(g.cursor.J*GridStep)
+	if l := g.cursor.link; l != nil {
+		EdgeUI.Draw(screen, l.X, l.Y, x, y, cam)
+	}
+	h := float64(GridStep) / 2
+	DrawLineCam(screen, x-h, y-h, x+h, y-h, cam, colCursor, 2)
+	DrawLineCam(screen, x+h, y-h, x+h, y+h, cam, colCursor, 2)
+	DrawLineCam(screen, x+h, y+h, x-h, y+h, cam, colCursor, 2)
+	DrawLineCam(screen, x-h, y+h, x-h, y-h, cam, colCursor, 2)
+}
+
+// drawHelp lists the editing keys over the grid pane.
+func (g *Game) drawHelp(dst *ebiten.Image) {
+	if !g.showHelp {
+		return
+	}
+	keyW := 0
+	for _, b := range keyBindings {
+		keyW = max(keyW, len(b[0]))
+	}
+	w := 0
+	for _, b := range keyBindings {
+		w = max(w, (keyW+2+len(b[1]))*debugCharW)
+	}
+	lineH := debugCharH + 4
+	w += 16
+	h := (len(keyBindings)+1)*lineH + 16
+	x := max((g.winW-w)/2, 0)
+	y := max(topOffset+(g.split.Y-topOffset-h)/2, topOffset)
+	r := image.Rect(x, y, x+w, y+h)
+	drawRect(dst, r, color.RGBA{30, 30, 30, 240}, true)
+	drawRect(dst, r, colDropdownEdge, false)
+	ebitenutil.DebugPrintAt(dst, "Grid keys", x+8, y+8)
+	for i, b := range keyBindings {
+		ly := y + 8 + (i+1)*lineH
+		ebitenutil.DebugPrintAt(dst, b[0], x+8, ly)
+		ebitenutil.DebugPrintAt(dst, b[1], x+8+(keyW+2)*debugCharW, ly)
+	}
+}
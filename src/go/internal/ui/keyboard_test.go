@@ -0,0 +1,125 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/ingyamilmolinar/tunkul/core/model"
+)
+
+// keyboardGame returns a game driven by the keys held in the returned map.
+func keyboardGame(t *testing.T) (*Game, func(...ebiten.Key)) {
+	t.Helper()
+	g := New(testLogger)
+	g.Layout(640, 480)
+	held := map[ebiten.Key]bool{}
+	restore := SetInputForTest(
+		func() (int, int) { return -1, -1 },
+		func(ebiten.MouseButton) bool { return false },
+		func(k ebiten.Key) bool { return held[k] },
+		func() []rune { return nil },
+		func() (float64, float64) { return 0, 0 },
+		func() (int, int) { return g.winW, g.winH },
+	)
+	t.Cleanup(restore)
+	press := func(keys ...ebiten.Key) {
+		for _, k := range keys {
+			held[k] = true
+			g.Update()
+			held[k] = false
+			g.Update()
+		}
+	}
+	return g, press
+}
+
+func TestKeyboardEditsGrid(t *testing.T) {
+	g, press := keyboardGame(t)
+
+	press(ebiten.KeyArrowRight) // shows the cursor without moving it
+	if !g.cursor.visible {
+		t.Fatal("arrow key did not show the cursor")
+	}
+	i, j := g.cursor.I, g.cursor.J
+	press(ebiten.KeyN, ebiten.KeyArrowRight, ebiten.KeyArrowRight, ebiten.KeyN)
+	a, b := g.nodeAt(i, j), g.nodeAt(i+2, j)
+	if a == nil || b == nil || g.sel != b {
+		t.Fatalf("N placed %+v and %+v, selected %+v", a, b, g.sel)
+	}
+
+	press(ebiten.KeyArrowLeft, ebiten.KeyArrowLeft, ebiten.KeyE, ebiten.KeyArrowRight, ebiten.KeyArrowRight, ebiten.KeyE)
+	if _, ok := g.graph.Edges[[2]model.NodeID{a.ID, b.ID}]; !ok {
+		t.Fatal("E, E did not link the nodes")
+	}
+	if g.cursor.link != b {
+		t.Fatalf("edge did not carry on from the end node: %+v", g.cursor.link)
+	}
+	if mid := g.nodeAt(i+1, j); mid == nil || g.graph.Nodes[mid.ID].Type != model.NodeTypeInvisible {
+		t.Fatalf("edge has no rest between its nodes: %+v", mid)
+	}
+	press(ebiten.KeyEscape)
+	if g.cursor.link != nil || !g.cursor.visible {
+		t.Fatal("Esc should drop the edge first and keep the cursor")
+	}
+
+	press(ebiten.KeyT)
+	if g.graph.Nodes[b.ID].Type != model.NodeTypeInvisible {
+		t.Fatal("T did not turn the node into a rest")
+	}
+
+	g.drum.AddRow()
+	g.Update()
+	g.pendingStartRow = -1
+	press(ebiten.KeyArrowDown, ebiten.KeyArrowDown, ebiten.KeyDigit2, ebiten.KeyO)
+	if o := g.nodeAt(i+2, j+2); o == nil || g.drum.Rows[1].Origin != o.ID || !o.Start {
+		t.Fatalf("O did not give row 2 an origin under the cursor: origin %d", g.drum.Rows[1].Origin)
+	}
+
+	press(ebiten.KeyArrowUp, ebiten.KeyArrowUp, ebiten.KeyX)
+	if g.nodeAt(i+2, j) != nil {
+		t.Fatal("X did not delete the node")
+	}
+	press(ebiten.KeyEscape)
+	if g.cursor.visible {
+		t.Fatal("second Esc did not hide the cursor")
+	}
+}
+
+func TestKeyboardIgnoredWhileTyping(t *testing.T) {
+	g, press := keyboardGame(t)
+	press(ebiten.KeyArrowDown)
+	nodes := len(g.nodes)
+	g.drum.focusBPM = true
+	press(ebiten.KeyN, ebiten.KeyH)
+	if len(g.nodes) != nodes || g.showHelp {
+		t.Fatal("editing keys acted while the BPM box had focus")
+	}
+	g.drum.focusBPM = false
+	press(ebiten.KeyH)
+	if !g.showHelp {
+		t.Fatal("H did not show the help overlay")
+	}
+	g.Draw(ebiten.NewImage(640, 480))
+}
+
+func TestKeyRepeatsWhileHeld(t *testing.T) {
+	s := keyState{}
+	held := true
+	restore := SetInputForTest(nil, nil, func(ebiten.Key) bool { return held }, nil, nil, nil)
+	defer restore()
+	n := 0
+	for range 60 {
+		s.update()
+		if s.repeated(ebiten.KeyArrowLeft) {
+			n++
+		}
+	}
+	if n != 6 { // the press, then frames 36, 42, 48, 54 and 60
+		t.Fatalf("held key repeated %d times in 60 frames, want 6", n)
+	}
+	held = false
+	s.update()
+	if s.pressed(ebiten.KeyArrowLeft) || s.repeated(ebiten.KeyArrowLeft) {
+		t.Fatal("released key still reported")
+	}
+}
@@ -0,0 +1,89 @@
+package ui
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+// knobTravel is the vertical drag distance in px that sweeps the full range.
+const knobTravel = 100
+
+// Knob is a rotary control adjusted by dragging vertically. Its value spans
+// Min..Max, which defaults to the bipolar range -1..1.
+type Knob struct {
+	r        image.Rectangle
+	Label    string
+	Value    float64
+	Min, Max float64
+	Disabled bool
+
+	dragging bool
+	startY   int
+	startVal float64
+}
+
+func NewKnob(label string, v float64) *Knob { return NewRangeKnob(label, v, -1, 1) }
+
+// NewRangeKnob returns a knob covering min..max.
+func NewRangeKnob(label string, v, min, max float64) *Knob {
+	return &Knob{Label: label, Value: v, Min: min, Max: max}
+}
+
+func (k *Knob) SetRect(r image.Rectangle) { k.r = r }
+
+func (k *Knob) Rect() image.Rectangle { return k.r }
+
+// Handle processes mouse interaction and reports whether the knob consumed it.
+func (k *Knob) Handle(mx, my int, pressed bool) bool {
+	if k.Disabled {
+		k.dragging = false
+		return false
+	}
+	if pressed {
+		if !k.dragging {
+			if !image.Pt(mx, my).In(k.r) {
+				return false
+			}
+			k.dragging = true
+			k.startY = my
+			k.startVal = k.Value
+		}
+		v := k.startVal + float64(k.startY-my)*(k.Max-k.Min)/knobTravel
+		k.Value = math.Max(k.Min, math.Min(k.Max, v))
+		return true
+	} else if k.dragging {
+		k.dragging = false
+		return true
+	}
+	return false
+}
+
+// Draw renders the knob body, its pointer and the label underneath.
+func (k *Knob) Draw(dst *ebiten.Image) {
+	body := color.RGBA{60, 60, 60, 255}
+	pointer := color.RGBA{200, 200, 200, 255}
+	if k.Disabled {
+		body = color.RGBA{40, 40, 40, 255}
+		pointer = color.RGBA{90, 90, 90, 255}
+	}
+	drawRect(dst, k.r, body, true)
+	drawRect(dst, k.r, colButtonBorder, false)
+
+	// pointer sweeps 270° with the middle of the range pointing straight up
+	cx := float64(k.r.Min.X+k.r.Max.X) / 2
+	cy := float64(k.r.Min.Y+k.r.Max.Y) / 2
+	radius := float64(min(k.r.Dx(), k.r.Dy())) / 2
+	frac := 0.5
+	if k.Max > k.Min {
+		frac = (k.Value - k.Min) / (k.Max - k.Min)
+	}
+	angle := -math.Pi/2 + (2*frac-1)*math.Pi*3/4
+	var id ebiten.GeoM
+	DrawLineCam(dst, cx, cy, cx+radius*math.Cos(angle), cy+radius*math.Sin(angle), &id, pointer, 2)
+
+	ebitenutil.DebugPrintAt(dst, k.Label, k.r.Min.X, k.r.Max.Y+1)
+}
@@ -0,0 +1,49 @@
+package ui
+
+import (
+	"image"
+	"testing"
+)
+
+func TestKnobVerticalDrag(t *testing.T) {
+	k := NewKnob("Pitch", 0)
+	k.SetRect(image.Rect(0, 0, 20, 20))
+	if !k.Handle(10, 10, true) {
+		t.Fatalf("expected handle to start drag")
+	}
+	k.Handle(10, 10-knobTravel/4, true)
+	if k.Value < 0.49 || k.Value > 0.51 {
+		t.Fatalf("expected value 0.5 got %f", k.Value)
+	}
+	k.Handle(300, 10+knobTravel*2, true) // drag continues outside the knob
+	if k.Value != -1 {
+		t.Fatalf("expected value clamped to -1 got %f", k.Value)
+	}
+	k.Handle(300, 300, false)
+	if k.Handle(300, 300, true) {
+		t.Fatalf("press outside the knob should not start a drag")
+	}
+}
+
+func TestKnobDisabledIgnoresInput(t *testing.T) {
+	k := NewKnob("Tone", 0)
+	k.SetRect(image.Rect(0, 0, 20, 20))
+	k.Disabled = true
+	if k.Handle(10, 10, true) || k.Value != 0 {
+		t.Fatalf("disabled knob reacted to input")
+	}
+}
+
+func TestRangeKnobSpansRange(t *testing.T) {
+	k := NewRangeKnob("Mix", 0, 0, 1)
+	k.SetRect(image.Rect(0, 0, 20, 20))
+	k.Handle(10, 10, true)
+	k.Handle(10, 10-knobTravel/2, true)
+	if k.Value < 0.49 || k.Value > 0.51 {
+		t.Fatalf("expected value 0.5 got %f", k.Value)
+	}
+	k.Handle(10, 10+knobTravel, true)
+	if k.Value != 0 {
+		t.Fatalf("expected value clamped to 0 got %f", k.Value)
+	}
+}
@@ -66,7 +66,7 @@ func TestDrumViewButtonLayout(t *testing.T) {
 			prev = r
 		}
 
-		bottomButtons := []*Button{dv.uploadBtn}
+		bottomButtons := []*Button{dv.uploadBtn, dv.learnBtn, dv.quantBtn}
 		prev = image.Rectangle{}
 		for i, btn := range bottomButtons {
 			r := btn.Rect()
@@ -0,0 +1,100 @@
+package ui
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/ingyamilmolinar/tunkul/internal/audio"
+)
+
+const (
+	meterFloorDB = -60.0 // level drawn at the left edge of the meter
+	meterMaxGain = 2.0   // master gain at the right edge of the fader (+6dB)
+)
+
+// master bus hooks, replaced in tests
+var (
+	masterLevels  = audio.MasterLevels
+	setMasterGain = audio.SetMasterGain
+)
+
+var (
+	colMeterRMS   = color.RGBA{60, 170, 90, 255}
+	colMeterPeak  = color.RGBA{240, 240, 40, 255}
+	colMeterLimit = color.RGBA{200, 60, 60, 255}
+)
+
+// LevelMeter draws the master bus levels on a dBFS scale and doubles as the
+// master gain fader: dragging across it moves the gain marker.
+type LevelMeter struct {
+	r        image.Rectangle
+	Levels   audio.Levels
+	Gain     float64 // linear master gain, 0..meterMaxGain
+	dragging bool
+}
+
+func NewLevelMeter(gain float64) *LevelMeter { return &LevelMeter{Gain: gain} }
+
+func (m *LevelMeter) SetRect(r image.Rectangle) { m.r = r }
+
+func (m *LevelMeter) Rect() image.Rectangle { return m.r }
+
+// Handle processes mouse interaction with the gain fader and reports whether
+// the meter consumed it.
+func (m *LevelMeter) Handle(mx, my int, pressed bool) bool {
+	if pressed {
+		if m.dragging || image.Pt(mx, my).In(m.r) {
+			m.dragging = true
+			w := m.r.Dx() - 1
+			if w <= 0 {
+				return true
+			}
+			f := math.Max(0, math.Min(1, float64(mx-m.r.Min.X)/float64(w)))
+			m.Gain = f * meterMaxGain
+			return true
+		}
+	} else if m.dragging {
+		m.dragging = false
+		return true
+	}
+	return false
+}
+
+// meterFrac maps a linear amplitude to its position on the meter.
+func meterFrac(v float64) float64 {
+	if v <= 0 {
+		return 0
+	}
+	db := 20 * math.Log10(v)
+	return math.Max(0, math.Min(1, (db-meterFloorDB)/-meterFloorDB))
+}
+
+// Draw renders the RMS bar, the decaying peak tick, the gain marker and a
+// gain readout. The peak turns red while the limiter is reducing gain.
+func (m *LevelMeter) Draw(dst *ebiten.Image) {
+	drawRect(dst, m.r, colBPMBox, true)
+	w := float64(m.r.Dx())
+	rms := m.r.Min.X + int(meterFrac(m.Levels.RMS)*w)
+	drawRect(dst, image.Rect(m.r.Min.X, m.r.Min.Y+m.r.Dy()/4, rms, m.r.Max.Y-m.r.Dy()/4), colMeterRMS, true)
+	if m.Levels.Peak > 0 {
+		pk := m.r.Min.X + int(meterFrac(m.Levels.Peak)*w)
+		c := colMeterPeak
+		if m.Levels.Gain < 1 {
+			c = colMeterLimit
+		}
+		drawRect(dst, image.Rect(pk-1, m.r.Min.Y, pk+1, m.r.Max.Y), c, true)
+	}
+	g := m.r.Min.X + int(m.Gain/meterMaxGain*(w-1))
+	drawRect(dst, image.Rect(g-1, m.r.Min.Y, g+2, m.r.Max.Y), color.RGBA{200, 200, 200, 255}, true)
+	drawRect(dst, m.r, colButtonBorder, false)
+
+	txt := "-inf dB"
+	if m.Gain > 0 {
+		txt = fmt.Sprintf("%+.1f dB", 20*math.Log10(m.Gain))
+	}
+	ebitenutil.DebugPrintAt(dst, txt, m.r.Max.X-debugCharW*len(txt)-2, m.r.Min.Y+(m.r.Dy()-debugCharH)/2)
+}
@@ -0,0 +1,40 @@
+package ui
+
+import (
+	"image"
+	"testing"
+)
+
+func TestMeterFracUsesDBScale(t *testing.T) {
+	cases := []struct{ v, want float64 }{
+		{0, 0},
+		{1, 1},
+		{0.001, 0},                  // -60 dB
+		{0.031622776601683794, 0.5}, // -30 dB
+		{2, 1},
+	}
+	for _, c := range cases {
+		if got := meterFrac(c.v); got < c.want-1e-9 || got > c.want+1e-9 {
+			t.Fatalf("meterFrac(%f)=%f want %f", c.v, got, c.want)
+		}
+	}
+}
+
+func TestLevelMeterDragSetsGain(t *testing.T) {
+	m := NewLevelMeter(1)
+	m.SetRect(image.Rect(0, 0, 101, 10))
+	if !m.Handle(25, 5, true) {
+		t.Fatalf("expected press inside meter to be handled")
+	}
+	if m.Gain != meterMaxGain/4 {
+		t.Fatalf("expected gain %f got %f", meterMaxGain/4, m.Gain)
+	}
+	m.Handle(500, 5, true) // drag continues past the edge
+	if m.Gain != meterMaxGain {
+		t.Fatalf("expected gain clamped to %f got %f", meterMaxGain, m.Gain)
+	}
+	m.Handle(500, 5, false)
+	if m.Handle(500, 5, true) {
+		t.Fatalf("press outside the meter should not start a drag")
+	}
+}
@@ -0,0 +1,119 @@
+package ui
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"github.com/ingyamilmolinar/tunkul/core/model"
+	"github.com/ingyamilmolinar/tunkul/internal/midi"
+)
+
+// midiQueue bounds the notes and CCs waiting for the next frame.
+const midiQueue = 256
+
+// midiMsg is a note or CC from the MIDI input and the time it arrived.
+type midiMsg struct {
+	msg []byte
+	at  time.Time
+}
+
+// sendMIDI plays a note on the MIDI output. It is a no-op until
+// SetMIDIOutput is called and is overridden in tests.
+var sendMIDI = func(channel, note, velocity int) {}
+
+// SetMIDIOutput sends every played hit to s as well as to the audio engine,
+// on the channel and note configured for its drum row. Pass nil to stop.
+func SetMIDIOutput(s *midi.Sender) {
+	if s == nil {
+		sendMIDI = func(int, int, int) {}
+		return
+	}
+	sendMIDI = func(channel, note, velocity int) { _ = s.Note(channel, note, velocity) }
+}
+
+// midiVelocity maps a row volume (0..1) to a MIDI velocity, 0 meaning the
+// hit should not be sent.
+func midiVelocity(vol float64) int {
+	return int(math.Round(math.Max(0, math.Min(1, vol)) * 127))
+}
+
+// SendMIDIClock makes tunkul the clock master, sending 24 PPQN clock and
+// start, stop and continue to out.
+func (g *Game) SendMIDIClock(out midi.Out) {
+	g.engine.SetClockOut(func(msg byte) { _ = out.Send([]byte{msg}) })
+}
+
+// FollowMIDIClock locks playback to the clock arriving on the MIDI input:
+// the remote master sets the tempo and drives start, stop, continue and song
+// position.
+func (g *Game) FollowMIDIClock(on bool) { g.engine.FollowClock(on) }
+
+// SetMIDIInput listens to in. Clock and transport messages go straight to
+// the engine; notes and CCs are queued for Update, which records pads into
+// the rows mapped to them and moves the controls learned for each CC.
+func (g *Game) SetMIDIInput(in midi.In) error {
+	ch := make(chan midiMsg, midiQueue)
+	g.midiIn = ch
+	return in.Listen(func(msg []byte, at time.Time) {
+		if msg[0] >= 0xf0 {
+			g.engine.Clock(msg, at)
+			return
+		}
+		select {
+		case ch <- midiMsg{slices.Clone(msg), at}:
+		default: // Update is stalled; drop rather than block the port
+		}
+	})
+}
+
+// drainMIDI handles the notes and CCs received since the last frame.
+func (g *Game) drainMIDI() {
+	for {
+		select {
+		case m := <-g.midiIn:
+			g.handleMIDI(m.msg, m.at)
+		default:
+			return
+		}
+	}
+}
+
+func (g *Game) handleMIDI(msg []byte, at time.Time) {
+	if len(msg) < 3 || g.drum.learnMIDI(msg) {
+		return
+	}
+	channel, data, value := int(msg[0]&0x0f)+1, int(msg[1]), int(msg[2])
+	switch msg[0] & 0xf0 {
+	case 0x90:
+		if value == 0 {
+			return // note-off by running status
+		}
+		for _, row := range g.drum.rowsForNote(channel, data) {
+			g.recordHit(row, value, at)
+		}
+	case 0xb0:
+		if !g.drum.applyCC(channel, data, value) {
+			g.logger.Debugf("[GAME] Unmapped CC %d ch %d", data, channel)
+		}
+	}
+}
+
+// recordHit plays row at velocity and, while playing, records the hit on
+// the row's beat nearest to at, as the engine timed it. An invisible node
+// there turns regular and a beat past the end of a straight path extends
+// it. A hit closer to the next beat lands on it, which then is not played
+// again when the row reaches it.
+func (g *Game) recordHit(row, velocity int, at time.Time) {
+	g.playRow(row, float64(velocity)/127)
+	if !g.playing {
+		return
+	}
+	beat, ok := g.engine.Record(row, at)
+	if !ok || g.path(row).At(beat).NodeType == model.NodeTypeRegular {
+		return
+	}
+	if g.toggleStep(row, beat) {
+		g.logger.Infof("[GAME] Recorded row %d at beat %d", row, beat)
+	}
+}
@@ -0,0 +1,219 @@
+package ui
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/ingyamilmolinar/tunkul/core/model"
+	"github.com/ingyamilmolinar/tunkul/internal/audio"
+	"github.com/ingyamilmolinar/tunkul/internal/midi"
+)
+
+func TestHighlightBeatSendsMIDI(t *testing.T) {
+	g := New(testLogger)
+	g.Layout(640, 480)
+	g.tryAddNode(0, 0, model.NodeTypeRegular)
+	r := g.drum.Rows[0]
+	r.MIDIChannel, r.MIDINote, r.Volume = 3, 50, 0.5
+
+	type note struct{ ch, note, vel int }
+	var got []note
+	origMIDI, origPlay := sendMIDI, playSound
+	sendMIDI = func(ch, n, vel int) { got = append(got, note{ch, n, vel}) }
+	playSound = func(audio.Hit) {}
+	defer func() { sendMIDI, playSound = origMIDI, origPlay }()
+
+	beatAll(g)
+	if len(got) != 1 || got[0] != (note{3, 50, 64}) {
+		t.Fatalf("got %+v", got)
+	}
+	r.MIDIChannel = 0
+	beatAll(g)
+	r.MIDIChannel, r.Muted = 3, true
+	beatAll(g)
+	if len(got) != 1 {
+		t.Fatalf("disabled or muted row sent MIDI: %+v", got)
+	}
+}
+
+func TestSetMIDIOutputSendsToPort(t *testing.T) {
+	loop := midi.NewLoopback()
+	s := midi.NewSender(loop)
+	SetMIDIOutput(s)
+	defer SetMIDIOutput(nil)
+	sendMIDI(10, 36, 100)
+	s.Close()
+	if msgs := loop.Messages(); len(msgs) != 2 || msgs[0][0] != 0x99 {
+		t.Fatalf("port got % x", msgs)
+	}
+}
+
+func TestFXPanelEditsRowMIDI(t *testing.T) {
+	row := &DrumRow{MIDIChannel: midi.DrumChannel, MIDINote: 36}
+	p := NewFXPanel(0, row)
+	p.SetRect(image.Rect(0, 0, 540, 180))
+	k := p.knobs[len(fxKnobs)+1] // channel, after the loop length
+	x, y := k.Rect().Min.X+1, k.Rect().Min.Y+1
+	p.Update(x, y, true)
+	p.Update(x, y+knobTravel, true)
+	p.Update(x, y+knobTravel, false)
+	if row.MIDIChannel != 0 {
+		t.Fatalf("channel %d, want 0", row.MIDIChannel)
+	}
+	if row.Effects != (audio.EffectSettings{}) || row.MIDINote != 36 {
+		t.Fatalf("other settings changed: %+v", row)
+	}
+}
+
+func TestFollowMIDIClockDrivesTransport(t *testing.T) {
+	g := New(testLogger)
+	g.Layout(640, 480)
+	g.tryAddNode(0, 0, model.NodeTypeRegular)
+	loop := midi.NewLoopback()
+	if err := g.SetMIDIInput(loop); err != nil {
+		t.Fatal(err)
+	}
+	g.FollowMIDIClock(true)
+	pulse := time.Minute / 100 / 24
+	at := time.Now()
+	loop.Send([]byte{0xFA})
+	for i := 0; i < 24; i++ {
+		g.engine.Clock([]byte{0xF8}, at)
+		at = at.Add(pulse)
+	}
+	g.Update()
+	if !g.playing || g.drum.BPM() != 100 {
+		t.Fatalf("playing %t bpm %d, want playing at 100", g.playing, g.drum.BPM())
+	}
+	loop.Send([]byte{0xFC})
+	g.Update()
+	if g.playing {
+		t.Fatal("remote stop ignored")
+	}
+}
+
+func TestMIDILearnBindsClickedControl(t *testing.T) {
+	dv := NewDrumView(image.Rect(0, 0, 640, 300), model.NewGraph(testLogger), testLogger)
+	dv.AddRow()
+	dv.recalcButtons()
+	dv.calcLayout()
+	mx, my, pressed := 0, 0, false
+	restore := SetInputForTest(
+		func() (int, int) { return mx, my },
+		func(ebiten.MouseButton) bool { return pressed },
+		func(ebiten.Key) bool { return false },
+		func() []rune { return nil },
+		func() (float64, float64) { return 0, 0 },
+		func() (int, int) { return 0, 0 },
+	)
+	defer restore()
+	click := func(r image.Rectangle) {
+		mx, my = r.Min.X+1, r.Min.Y+1
+		pressed = true
+		dv.Update()
+		pressed = false
+		dv.Update()
+	}
+
+	click(dv.learnBtn.Rect())
+	if !dv.learning {
+		t.Fatal("learn button did not enter learn mode")
+	}
+	click(dv.rowMuteBtns[1].Rect())
+	if dv.Rows[1].Muted {
+		t.Fatal("clicking in learn mode toggled mute")
+	}
+	if !dv.learnMIDI([]byte{0xb1, 20, 127}) {
+		t.Fatal("CC not learned")
+	}
+	click(dv.rowLabels[1].Rect())
+	if dv.learnMIDI([]byte{0xb1, 21, 127}) {
+		t.Fatal("CC bound to a note target")
+	}
+	if !dv.learnMIDI([]byte{0x93, 60, 100}) || dv.Rows[1].MIDIChannel != 4 || dv.Rows[1].MIDINote != 60 {
+		t.Fatalf("note not learned: %+v", dv.Rows[1])
+	}
+	click(dv.learnBtn.Rect())
+
+	if !dv.applyCC(2, 20, 100) || !dv.Rows[1].Muted {
+		t.Fatal("learned CC did not mute row 1")
+	}
+	dv.applyCC(2, 20, 0)
+	if dv.Rows[1].Muted {
+		t.Fatal("learned CC did not unmute row 1")
+	}
+	if dv.applyCC(2, 21, 127) {
+		t.Fatal("unlearned CC applied")
+	}
+	if rows := dv.rowsForNote(4, 60); len(rows) != 1 || rows[0] != 1 {
+		t.Fatalf("note 60 ch 4 plays rows %v", rows)
+	}
+
+	dv.DeleteRow(0)
+	if got := dv.ccMap[midiControl{2, 20}]; got != (midiTarget{Param: midiRowMute, Row: 0}) {
+		t.Fatalf("mapping not shifted with deleted row: %+v", got)
+	}
+}
+
+func TestMIDICCMovesVolumeAndBPM(t *testing.T) {
+	g := New(testLogger)
+	g.drum.ccMap[midiControl{1, 7}] = midiTarget{Param: midiRowVolume}
+	g.drum.ccMap[midiControl{1, 8}] = midiTarget{Param: midiBPM}
+	g.handleMIDI([]byte{0xb0, 7, 0}, time.Now())
+	g.handleMIDI([]byte{0xb0, 8, 127}, time.Now())
+	if g.drum.Rows[0].Volume != 0 || g.drum.BPM() != ccMaxBPM {
+		t.Fatalf("volume %.2f bpm %d", g.drum.Rows[0].Volume, g.drum.BPM())
+	}
+}
+
+func TestMIDINoteRecordsQuantizedStep(t *testing.T) {
+	g := New(testLogger)
+	g.Layout(640, 480)
+	a := g.tryAddNode(0, 0, model.NodeTypeRegular)
+	b := g.tryAddNode(3, 0, model.NodeTypeRegular)
+	g.addEdge(a, b) // (1,0) and (2,0) are invisible steps
+	r := g.drum.Rows[0]
+	r.MIDIChannel, r.MIDINote = 10, 36
+	var played []float64
+	origPlay, origMIDI := playSound, sendMIDI
+	playSound = func(h audio.Hit) { played = append(played, h.Volume) }
+	sendMIDI = func(int, int, int) {}
+	defer func() { playSound, sendMIDI = origPlay, origMIDI }()
+
+	g.handleMIDI([]byte{0x99, 36, 127}, time.Now()) // stopped: only heard
+	if len(played) != 1 || g.graph.Nodes[g.nodeAt(1, 0).ID].Type != model.NodeTypeInvisible {
+		t.Fatalf("stopped hit played %v and changed the graph", played)
+	}
+
+	g.playing = true
+	g.engine.Rewind()
+	t0 := time.Now()
+	g.engine.Beat(0, t0)
+	g.drainEvents()
+	every := time.Minute / time.Duration(g.engine.BPM())
+	played = nil
+	// 70% of the way to step 1, however late the frame handling it runs.
+	g.handleMIDI([]byte{0x99, 36, 64}, t0.Add(every*7/10))
+	if g.graph.Nodes[g.nodeAt(1, 0).ID].Type != model.NodeTypeRegular || !g.drum.Rows[0].Steps[1] {
+		t.Fatal("hit not recorded on step 1")
+	}
+	if len(played) != 1 || played[0] < 0.5 || played[0] > 0.51 {
+		t.Fatalf("hit should be heard once at its velocity, got %v", played)
+	}
+	g.engine.Beat(1, t0.Add(every))
+	g.drainEvents()
+	if len(played) != 1 {
+		t.Fatal("recorded step played again when the pulse arrived")
+	}
+
+	g.handleMIDI([]byte{0x99, 36, 64}, t0.Add(5*every)) // step 5
+	n := g.nodeAt(5, 0)
+	if n == nil || g.graph.Nodes[n.ID].Type != model.NodeTypeRegular || g.nodeAt(4, 0) == nil {
+		t.Fatalf("hit past the end of the path did not extend it: %+v", n)
+	}
+	if got := g.path(0).At(5).NodeID; got != n.ID {
+		t.Fatalf("beat 5 plays node %d, want the recorded node %d", got, n.ID)
+	}
+}
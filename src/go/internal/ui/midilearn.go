@@ -0,0 +1,175 @@
+package ui
+
+import (
+	"image"
+	"maps"
+)
+
+// CC-controlled BPM spans this range across the controller's travel.
+const (
+	ccMinBPM = 40
+	ccMaxBPM = 240
+)
+
+// midiParam is a drum view control that can be driven over MIDI.
+type midiParam int
+
+const (
+	midiRowNote   midiParam = iota // note that plays and records a row
+	midiRowVolume                  // row volume, CC value scaled to 0..1
+	midiRowMute                    // row mute, on at CC values of 64 and up
+	midiRowSolo                    // row solo, on at CC values of 64 and up
+	midiBPM                        // tempo, CC value scaled to ccMinBPM..ccMaxBPM
+)
+
+// midiTarget is a control picked in MIDI-learn mode. Row is ignored for
+// midiBPM.
+type midiTarget struct {
+	Param midiParam
+	Row   int
+}
+
+// midiControl identifies a controller: channel 1-16 and CC number.
+type midiControl struct {
+	Channel, CC int
+}
+
+// toggleLearn enters or leaves MIDI-learn mode. While learning, clicking a
+// row label, volume slider, mute or solo button or the BPM box picks it as
+// the target, and the next note or CC received is bound to it.
+func (dv *DrumView) toggleLearn() {
+	dv.learning = !dv.learning
+	dv.learnTarget = nil
+	dv.instMenuOpen = false
+	dv.focusBPM = false
+	dv.logger.Infof("[DRUMVIEW] MIDI learn %t", dv.learning)
+}
+
+// learnTargetAt returns the learnable control under the cursor.
+func (dv *DrumView) learnTargetAt(x, y int) (midiTarget, image.Rectangle, bool) {
+	if pt(x, y, dv.bpmBox.Rect()) {
+		return midiTarget{Param: midiBPM}, dv.bpmBox.Rect(), true
+	}
+	for i := range dv.Rows {
+		for _, c := range []struct {
+			param midiParam
+			rect  image.Rectangle
+		}{
+			{midiRowNote, dv.rowLabels[i].Rect()},
+			{midiRowVolume, dv.rowVolSliders[i].Rect()},
+			{midiRowMute, dv.rowMuteBtns[i].Rect()},
+			{midiRowSolo, dv.rowSoloBtns[i].Rect()},
+		} {
+			if pt(x, y, c.rect) {
+				return midiTarget{Param: c.param, Row: i}, c.rect, true
+			}
+		}
+	}
+	return midiTarget{}, image.Rectangle{}, false
+}
+
+// learnRect is the on-screen area of the pending learn target.
+func (dv *DrumView) learnRect() image.Rectangle {
+	t := dv.learnTarget
+	if t == nil {
+		return image.Rectangle{}
+	}
+	if t.Param == midiBPM {
+		return dv.bpmBox.Rect()
+	}
+	if t.Row >= len(dv.rowLabels) {
+		return image.Rectangle{}
+	}
+	switch t.Param {
+	case midiRowVolume:
+		return dv.rowVolSliders[t.Row].Rect()
+	case midiRowMute:
+		return dv.rowMuteBtns[t.Row].Rect()
+	case midiRowSolo:
+		return dv.rowSoloBtns[t.Row].Rect()
+	}
+	return dv.rowLabels[t.Row].Rect()
+}
+
+// learnMIDI binds msg to the pending learn target. Notes bind to row note
+// targets and CCs to the others; it reports whether msg was consumed.
+func (dv *DrumView) learnMIDI(msg []byte) bool {
+	t := dv.learnTarget
+	if t == nil || len(msg) < 3 {
+		return false
+	}
+	ch := int(msg[0]&0x0f) + 1
+	switch {
+	case msg[0]&0xf0 == 0x90 && msg[2] > 0 && t.Param == midiRowNote:
+		r := dv.Rows[t.Row]
+		r.MIDIChannel, r.MIDINote = ch, int(msg[1])
+		dv.logger.Infof("[DRUMVIEW] Learned note %d ch %d for row %d", r.MIDINote, ch, t.Row)
+	case msg[0]&0xf0 == 0xb0 && t.Param != midiRowNote:
+		maps.DeleteFunc(dv.ccMap, func(_ midiControl, v midiTarget) bool { return v == *t })
+		dv.ccMap[midiControl{ch, int(msg[1])}] = *t
+		dv.logger.Infof("[DRUMVIEW] Learned CC %d ch %d for %+v", msg[1], ch, *t)
+	default:
+		return false
+	}
+	dv.learnTarget = nil
+	return true
+}
+
+// applyCC moves the control mapped to the given controller, reporting
+// whether one is mapped.
+func (dv *DrumView) applyCC(channel, cc, value int) bool {
+	t, ok := dv.ccMap[midiControl{channel, cc}]
+	if !ok {
+		return false
+	}
+	on := value >= 64
+	if t.Param == midiBPM {
+		dv.SetBPM(ccMinBPM + value*(ccMaxBPM-ccMinBPM)/127)
+		return true
+	}
+	if t.Row >= len(dv.Rows) {
+		return false
+	}
+	r := dv.Rows[t.Row]
+	switch t.Param {
+	case midiRowVolume:
+		r.Volume = float64(value) / 127
+	case midiRowMute:
+		if r.Muted != on {
+			dv.toggleMute(t.Row)
+		}
+	case midiRowSolo:
+		if r.Solo != on {
+			dv.toggleSolo(t.Row)
+		}
+	}
+	return true
+}
+
+// rowsForNote returns the rows triggered by a note on channel. Rows without
+// a MIDI channel answer on every channel.
+func (dv *DrumView) rowsForNote(channel, note int) []int {
+	var rows []int
+	for i, r := range dv.Rows {
+		if r.MIDINote == note && (r.MIDIChannel == 0 || r.MIDIChannel == channel) {
+			rows = append(rows, i)
+		}
+	}
+	return rows
+}
+
+// dropLearnedRow forgets mappings to row i and shifts those of later rows
+// down, after the row is deleted.
+func (dv *DrumView) dropLearnedRow(i int) {
+	for k, t := range dv.ccMap {
+		switch {
+		case t.Param == midiBPM || t.Row < i:
+		case t.Row == i:
+			delete(dv.ccMap, k)
+		default:
+			t.Row--
+			dv.ccMap[k] = t
+		}
+	}
+	dv.learnTarget = nil
+}
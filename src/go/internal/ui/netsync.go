@@ -0,0 +1,12 @@
+package ui
+
+import "github.com/ingyamilmolinar/tunkul/internal/netsync"
+
+// SetNetSync joins the tempo and bar phase shared by sess. Playback starts
+// on the session's next bar, BPM edits are sent to the other peers and their
+// changes show up in the BPM box. It has no effect while following a MIDI
+// clock.
+func (g *Game) SetNetSync(sess *netsync.Session) {
+	g.netSync = sess
+	g.engine.SetTimeline(sess)
+}
@@ -0,0 +1,49 @@
+package ui
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ingyamilmolinar/tunkul/internal/netsync"
+)
+
+func TestNetSyncSharesBPM(t *testing.T) {
+	ca, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := netsync.New(ca, 120, cb.LocalAddr())
+	defer a.Close()
+	b := netsync.New(cb, 120, ca.LocalAddr())
+	defer b.Close()
+
+	g := New(testLogger)
+	g.Layout(640, 480)
+	g.SetNetSync(a)
+
+	b.SetTempo(100)
+	waitFor(t, func() bool { g.Update(); return g.drum.BPM() == 100 })
+
+	g.drum.SetBPM(140)
+	g.Update()
+	waitFor(t, func() bool { return b.Tempo() == 140 })
+	g.Update()
+	if g.drum.BPM() != 140 {
+		t.Fatalf("local BPM edit reverted to %d", g.drum.BPM())
+	}
+}
+
+// waitFor polls cond for up to a second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package ui
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ingyamilmolinar/tunkul/core/engine"
+	"github.com/ingyamilmolinar/tunkul/core/model"
+	"github.com/ingyamilmolinar/tunkul/internal/osc"
+)
+
+// oscQueue bounds the OSC messages waiting for the next frame.
+const oscQueue = 256
+
+// SetOSCServer lets s control the game and reports every step to s as
+// /tunkul/step. Messages are applied on the next Update:
+//
+//	/tunkul/play [0|1]         play, or stop with 0
+//	/tunkul/stop
+//	/tunkul/bpm N
+//	/tunkul/row/N/mute 0|1     rows count from 0
+//	/tunkul/row/N/solo 0|1
+//	/tunkul/row/N/volume 0..1
+//	/tunkul/node/add I J       a regular node at grid cell I,J
+//	/tunkul/node/delete I J
+func (g *Game) SetOSCServer(s *osc.Server) error {
+	ch := make(chan osc.Message, oscQueue)
+	g.oscIn, g.osc = ch, s
+	if err := s.Serve(func(m osc.Message) {
+		select {
+		case ch <- m:
+		default: // Update is stalled; drop rather than block the socket
+		}
+	}); err != nil {
+		return err
+	}
+	// Steps go out as the engine plays them rather than once per frame.
+	steps := g.engine.Subscribe(oscQueue, engine.DropNewest, engine.EventStep)
+	go func() {
+		for ev := range steps.C {
+			g.sendOSCStep(ev.Step)
+		}
+	}()
+	return nil
+}
+
+// drainOSC applies the OSC messages received since the last frame.
+func (g *Game) drainOSC() {
+	for {
+		select {
+		case m := <-g.oscIn:
+			g.handleOSC(m)
+		default:
+			return
+		}
+	}
+}
+
+func (g *Game) handleOSC(m osc.Message) {
+	path, ok := strings.CutPrefix(m.Address, "/tunkul/")
+	if !ok {
+		g.logger.Debugf("[GAME] OSC: ignoring %v", m)
+		return
+	}
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "play":
+		if on, ok := m.Int(0); ok && on == 0 {
+			g.drum.stopPressed = true
+		} else {
+			g.drum.playPressed = true
+		}
+	case path == "stop":
+		g.drum.stopPressed = true
+	case path == "bpm":
+		if bpm, ok := m.Int(0); ok {
+			g.drum.SetBPM(bpm)
+		}
+	case len(parts) == 3 && parts[0] == "row":
+		row, err := strconv.Atoi(parts[1])
+		if err != nil || row < 0 || row >= len(g.drum.Rows) {
+			g.logger.Warnf("[GAME] OSC: no row %q in %v", parts[1], m)
+			return
+		}
+		g.oscRow(row, parts[2], m)
+	case path == "node/add" || path == "node/delete":
+		i, ok1 := m.Int(0)
+		j, ok2 := m.Int(1)
+		if !ok1 || !ok2 {
+			g.logger.Warnf("[GAME] OSC: %v needs two grid coordinates", m)
+			return
+		}
+		if parts[1] == "add" {
+			g.tryAddNode(i, j, model.NodeTypeRegular)
+		} else if n := g.nodeAt(i, j); n != nil {
+			g.deleteNode(n)
+		}
+	default:
+		g.logger.Warnf("[GAME] OSC: unknown message %v", m)
+	}
+}
+
+// oscRow applies a /tunkul/row/N/... message.
+func (g *Game) oscRow(row int, param string, m osc.Message) {
+	r := g.drum.Rows[row]
+	switch param {
+	case "mute":
+		if on, ok := m.Int(0); ok && (on != 0) != r.Muted {
+			g.drum.toggleMute(row)
+		}
+	case "solo":
+		if on, ok := m.Int(0); ok && (on != 0) != r.Solo {
+			g.drum.toggleSolo(row)
+		}
+	case "volume":
+		if v, ok := m.Float(0); ok {
+			r.Volume = math.Max(0, math.Min(1, v))
+		}
+	default:
+		g.logger.Warnf("[GAME] OSC: unknown row parameter in %v", m)
+	}
+}
+
+// sendOSCStep reports a scheduler step to the OSC peers. It runs on the
+// goroutine started by SetOSCServer.
+func (g *Game) sendOSCStep(step int) {
+	if err := g.osc.Send(osc.Message{Address: "/tunkul/step", Args: []any{int32(step)}}); err != nil {
+		g.logger.Debugf("[GAME] OSC: send step: %v", err)
+	}
+}
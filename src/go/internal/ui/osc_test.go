@@ -0,0 +1,84 @@
+package ui
+
+import (
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ingyamilmolinar/tunkul/core/model"
+	"github.com/ingyamilmolinar/tunkul/internal/osc"
+)
+
+func TestOSCMessagesControlGame(t *testing.T) {
+	g := New(testLogger)
+	g.Layout(640, 480)
+	g.drum.AddRow()
+	g.handleOSC(osc.Message{Address: "/tunkul/node/add", Args: []any{int32(2), int32(3)}})
+	n := g.nodeAt(2, 3)
+	if n == nil || g.graph.Nodes[n.ID].Type != model.NodeTypeRegular {
+		t.Fatal("node not added")
+	}
+	g.handleOSC(osc.Message{Address: "/tunkul/bpm", Args: []any{float32(128)}})
+	g.handleOSC(osc.Message{Address: "/tunkul/row/1/mute", Args: []any{int32(1)}})
+	g.handleOSC(osc.Message{Address: "/tunkul/row/0/volume", Args: []any{float32(0.25)}})
+	g.handleOSC(osc.Message{Address: "/tunkul/row/9/mute", Args: []any{int32(1)}})              // ignored
+	g.handleOSC(osc.Message{Address: "/tunkul/row/0/volume", Args: []any{float32(math.NaN())}}) // ignored
+	if g.drum.BPM() != 128 || !g.drum.Rows[1].Muted || g.drum.Rows[0].Volume != 0.25 {
+		t.Fatalf("bpm %d muted %t volume %.2f", g.drum.BPM(), g.drum.Rows[1].Muted, g.drum.Rows[0].Volume)
+	}
+	g.handleOSC(osc.Message{Address: "/tunkul/play"})
+	if !g.drum.PlayPressed() {
+		t.Fatal("play not pressed")
+	}
+	g.handleOSC(osc.Message{Address: "/tunkul/play", Args: []any{int32(0)}})
+	if !g.drum.StopPressed() {
+		t.Fatal("play 0 did not stop")
+	}
+	g.handleOSC(osc.Message{Address: "/tunkul/node/delete", Args: []any{int32(2), int32(3)}})
+	if g.nodeAt(2, 3) != nil {
+		t.Fatal("node not deleted")
+	}
+}
+
+func TestOSCServerDrivesGameAndReportsSteps(t *testing.T) {
+	g := New(testLogger)
+	srv, err := osc.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	if err := g.SetOSCServer(srv); err != nil {
+		t.Fatal(err)
+	}
+	client, err := net.DialUDP("udp", nil, srv.Addr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	data, _ := osc.Message{Address: "/tunkul/bpm", Args: []any{int32(90)}}.MarshalBinary()
+	client.Write(data)
+	deadline := time.Now().Add(time.Second)
+	for g.drum.BPM() != 90 && time.Now().Before(deadline) {
+		g.drainOSC()
+		time.Sleep(time.Millisecond)
+	}
+	if g.drum.BPM() != 90 {
+		t.Fatalf("bpm %d after OSC /tunkul/bpm 90", g.drum.BPM())
+	}
+
+	g.engine.Beat(5, time.Now())
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 512)
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := osc.Parse(buf[:n])
+	if err != nil || len(msgs) != 1 || msgs[0].Address != "/tunkul/step" {
+		t.Fatalf("client got %v %v", msgs, err)
+	}
+	if step, _ := msgs[0].Int(0); step != 5 {
+		t.Fatalf("step %d", step)
+	}
+}
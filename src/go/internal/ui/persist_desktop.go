@@ -0,0 +1,9 @@
+//go:build !js || !wasm || test
+
+package ui
+
+// restoreProject is a no-op outside the browser.
+func (g *Game) restoreProject() {}
+
+// autosave is a no-op outside the browser.
+func (g *Game) autosave() {}
@@ -0,0 +1,68 @@
+//go:build js && wasm && !test
+
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"syscall/js"
+)
+
+const (
+	projectStorageKey = "tunkul.project"
+	projectHashPrefix = "#p="
+	autosaveFrames    = ebitenTPS // look for changes once a second
+)
+
+// jsCall invokes method on v, turning a thrown exception into an error.
+// Storage access throws when the browser blocks it.
+func jsCall(v js.Value, method string, args ...any) (res js.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s: %v", method, r)
+		}
+	}()
+	return v.Call(method, args...), nil
+}
+
+// restoreProject loads the project shared in the page URL, falling back to
+// the last autosave.
+func (g *Game) restoreProject() {
+	src := ""
+	if h := js.Global().Get("location").Get("hash").String(); strings.HasPrefix(h, projectHashPrefix) {
+		src = strings.TrimPrefix(h, projectHashPrefix)
+	} else if v, err := jsCall(js.Global().Get("localStorage"), "getItem", projectStorageKey); err == nil && v.Type() == js.TypeString {
+		src = v.String()
+	}
+	if src == "" {
+		return
+	}
+	p, err := DecodeProject(src)
+	if err == nil {
+		err = g.LoadProject(p)
+	}
+	if err != nil {
+		g.logger.Warnf("[GAME] restoreProject: %v", err)
+		return
+	}
+	g.savedProject = src
+}
+
+// autosave writes the project to localStorage and the URL fragment whenever
+// it changes, so the address bar always holds a shareable link.
+func (g *Game) autosave() {
+	if g.frame%autosaveFrames != 0 {
+		return
+	}
+	s, err := EncodeProject(g.Project())
+	if err != nil || s == g.savedProject {
+		return
+	}
+	g.savedProject = s
+	if _, err := jsCall(js.Global().Get("localStorage"), "setItem", projectStorageKey, s); err != nil {
+		g.logger.Warnf("[GAME] autosave: %v", err)
+	}
+	if _, err := jsCall(js.Global().Get("history"), "replaceState", js.Null(), "", projectHashPrefix+s); err != nil {
+		g.logger.Warnf("[GAME] autosave: %v", err)
+	}
+}
@@ -0,0 +1,317 @@
+package ui
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/ingyamilmolinar/tunkul/core/engine"
+	"github.com/ingyamilmolinar/tunkul/core/model"
+	"github.com/ingyamilmolinar/tunkul/internal/audio"
+)
+
+// projectVersion prefixes encoded projects so the format can evolve.
+const projectVersion = "1"
+
+// maxProjectSize bounds the decompressed size of an encoded project.
+const maxProjectSize = 1 << 20
+
+// Project is a serialisable snapshot of a groove: the node graph, the drum
+// rows and the transport settings. Uploaded samples are not embedded; rows
+// using one fall back to the default instrument if it is not loaded.
+type Project struct {
+	BPM    int `json:"b"`
+	Length int `json:"l"`
+	// Quantize is the launch quantization of edits made while playing.
+	Quantize engine.Quantize `json:"q,omitempty"`
+	Nodes    []ProjectNode   `json:"n"`
+	Edges    [][2]int        `json:"e"` // indices into Nodes, in link direction
+	Rows     []ProjectRow    `json:"r"`
+}
+
+// ProjectNode is a grid node.
+type ProjectNode struct {
+	I    int            `json:"i"`
+	J    int            `json:"j"`
+	Type model.NodeType `json:"t,omitempty"`
+}
+
+// ProjectRow is a drum row. Origin indexes Nodes, -1 if the row has none.
+type ProjectRow struct {
+	Name       string               `json:"n,omitempty"`
+	Instrument string               `json:"i"`
+	Origin     int                  `json:"o"`
+	Volume     float64              `json:"v"`
+	Pan        float64              `json:"p,omitempty"`
+	Choke      int                  `json:"c,omitempty"`
+	Muted      bool                 `json:"m,omitempty"`
+	Solo       bool                 `json:"s,omitempty"`
+	Params     audio.DrumParams     `json:"k"`
+	Effects    audio.EffectSettings `json:"f"`
+	MIDI       [2]int               `json:"x"` // channel (0 for none), note
+	Length     int                  `json:"l,omitempty"`
+	Rate       [2]int               `json:"r"` // row beats, master beats; zero for the master rate
+}
+
+// Project returns a snapshot of the current groove.
+func (g *Game) Project() Project {
+	p := Project{BPM: g.drum.BPM(), Length: g.drum.Length, Quantize: g.drum.Quantize}
+	index := map[model.NodeID]int{}
+	for i, n := range g.nodes {
+		index[n.ID] = i
+		p.Nodes = append(p.Nodes, ProjectNode{I: n.I, J: n.J, Type: g.graph.Nodes[n.ID].Type})
+	}
+	for _, e := range g.edges {
+		p.Edges = append(p.Edges, [2]int{index[e.A.ID], index[e.B.ID]})
+	}
+	for _, r := range g.drum.Rows {
+		origin := -1
+		if i, ok := index[r.Origin]; ok {
+			origin = i
+		}
+		p.Rows = append(p.Rows, ProjectRow{
+			Name:       r.Name,
+			Instrument: r.Instrument,
+			Origin:     origin,
+			Volume:     r.Volume,
+			Pan:        r.Pan,
+			Choke:      r.Choke,
+			Muted:      r.Muted,
+			Solo:       r.Solo,
+			Params:     r.Params,
+			Effects:    r.Effects,
+			MIDI:       [2]int{r.MIDIChannel, r.MIDINote},
+			Length:     r.Length,
+			Rate:       [2]int{r.Rate.Num, r.Rate.Den},
+		})
+	}
+	return p
+}
+
+// validate checks that p's indices and settings are in range before it is
+// loaded, so a hostile share link cannot crash or stall the synth.
+func (p Project) validate() error {
+	if len(p.Rows) == 0 {
+		return errors.New("project has no rows")
+	}
+	if p.BPM < 0 || p.BPM > maxBPM {
+		return fmt.Errorf("bpm %d out of range", p.BPM)
+	}
+	if p.Length < 0 || p.Length > maxLength {
+		return fmt.Errorf("length %d out of range", p.Length)
+	}
+	if p.Quantize < engine.QuantizeOff || p.Quantize > engine.QuantizeLoop {
+		return fmt.Errorf("unknown launch quantize %d", p.Quantize)
+	}
+	for i, n := range p.Nodes {
+		if n.Type != model.NodeTypeRegular && n.Type != model.NodeTypeInvisible {
+			return fmt.Errorf("node %d has unknown type %d", i, n.Type)
+		}
+	}
+	for _, e := range p.Edges {
+		if e[0] < 0 || e[0] >= len(p.Nodes) || e[1] < 0 || e[1] >= len(p.Nodes) {
+			return fmt.Errorf("edge %v references a missing node", e)
+		}
+	}
+	for i, r := range p.Rows {
+		if r.Origin < -1 || r.Origin >= len(p.Nodes) {
+			return fmt.Errorf("row %d origin %d references a missing node", i, r.Origin)
+		}
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("row %d %w", i, err)
+		}
+		if rate := (engine.Rate{Num: r.Rate[0], Den: r.Rate[1]}); rate != (engine.Rate{}) && !slices.Contains(engine.Rates, rate) {
+			return fmt.Errorf("row %d has unknown rate %d/%d", i, r.Rate[0], r.Rate[1])
+		}
+	}
+	return nil
+}
+
+// validate checks that r's settings are ones the drum view could produce.
+// Drum params are clamped on load instead, like a knob would.
+func (r ProjectRow) validate() error {
+	if !inRange(r.Volume, 0, 1) {
+		return fmt.Errorf("volume %g out of range", r.Volume)
+	}
+	if !inRange(r.Pan, -1, 1) {
+		return fmt.Errorf("pan %g out of range", r.Pan)
+	}
+	if r.Choke < 0 || r.Choke > audio.ChokeGroups {
+		return fmt.Errorf("has unknown choke group %d", r.Choke)
+	}
+	for i := range audio.ParamNames {
+		if v := r.Params.Get(i); math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("param %s is not a number", audio.ParamNames[i])
+		}
+	}
+	if r.Length < 0 || r.Length > maxRowLength {
+		return fmt.Errorf("length %d out of range", r.Length)
+	}
+	if r.MIDI[0] < 0 || r.MIDI[0] > 16 {
+		return fmt.Errorf("midi channel %d out of range", r.MIDI[0])
+	}
+	if r.MIDI[1] < 0 || r.MIDI[1] > 127 {
+		return fmt.Errorf("midi note %d out of range", r.MIDI[1])
+	}
+	fx := r.Effects
+	if fx.Filter < audio.FilterOff || fx.Filter > audio.FilterBandPass {
+		return fmt.Errorf("has unknown filter %d", fx.Filter)
+	}
+	if fx.DelayDiv < 0 || fx.DelayDiv >= len(audio.DelayDivisions) {
+		return fmt.Errorf("has unknown delay division %d", fx.DelayDiv)
+	}
+	for _, k := range fxKnobs {
+		if v := *k.field(&fx); !inRange(v, 0, 1) {
+			return fmt.Errorf("effect %s %g out of range", k.label, v)
+		}
+	}
+	return nil
+}
+
+// inRange reports whether v lies in [lo,hi]. NaN never does.
+func inRange(v, lo, hi float64) bool { return v >= lo && v <= hi }
+
+// LoadProject replaces the current groove with p and stops playback.
+func (g *Game) LoadProject(p Project) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	g.playing = false
+	g.engine.Stop()
+	g.activePulses, g.activePulse = nil, nil
+	g.highlightedBeats = map[int]int64{}
+	g.sel, g.start = nil, nil
+	g.linkDrag = dragLink{}
+	g.cursor.link = nil
+	g.nodes, g.edges = nil, nil
+	g.graph.Nodes = map[model.NodeID]model.Node{}
+	g.graph.Edges = map[[2]model.NodeID]struct{}{}
+	g.graph.Next = 0
+	g.graph.StartNodeID = model.InvalidNodeID
+	g.pendingStartRow, g.pendingEuclid = -1, -1
+
+	if p.Length > 0 {
+		g.drum.SetLength(p.Length)
+	}
+	if p.BPM > 0 {
+		g.drum.SetBPM(p.BPM)
+	}
+	g.drum.Quantize = p.Quantize
+	known := audio.Instruments()
+	rows := make([]*DrumRow, len(p.Rows))
+	for i, pr := range p.Rows {
+		inst := pr.Instrument
+		if !slices.Contains(known, inst) {
+			g.logger.Warnf("[GAME] LoadProject: instrument %q not loaded, using %q", inst, known[0])
+			inst = known[0]
+		}
+		params := pr.Params
+		for k := range audio.ParamNames {
+			params = params.Set(k, params.Get(k))
+		}
+		name := pr.Name
+		if name == "" {
+			name = strings.ToUpper(inst[:1]) + inst[1:]
+		}
+		rows[i] = &DrumRow{
+			Name:        name,
+			Instrument:  inst,
+			Color:       instColor(inst),
+			Origin:      model.InvalidNodeID,
+			Volume:      pr.Volume,
+			Pan:         pr.Pan,
+			Choke:       pr.Choke,
+			Muted:       pr.Muted,
+			Solo:        pr.Solo,
+			Params:      params,
+			Effects:     pr.Effects,
+			MIDIChannel: pr.MIDI[0],
+			MIDINote:    pr.MIDI[1],
+			Length:      pr.Length,
+			Rate:        engine.Rate{Num: pr.Rate[0], Den: pr.Rate[1]},
+		}
+	}
+	g.drum.setRows(rows)
+
+	nodes := make([]*uiNode, len(p.Nodes))
+	for i, pn := range p.Nodes {
+		nodes[i] = g.tryAddNode(pn.I, pn.J, pn.Type)
+	}
+	// tryAddNode promotes the first regular node to the start; the rows
+	// below decide the real origins.
+	for _, n := range g.nodes {
+		n.Start = false
+	}
+	g.start = nil
+	g.graph.StartNodeID = model.InvalidNodeID
+	for i, pr := range p.Rows {
+		if pr.Origin < 0 {
+			continue
+		}
+		n := nodes[pr.Origin]
+		rows[i].Origin, rows[i].Node = n.ID, n
+		n.Start = true
+		if i == 0 {
+			g.start = n
+			g.graph.StartNodeID = n.ID
+		}
+	}
+	for _, e := range p.Edges {
+		g.addEdge(nodes[e[0]], nodes[e[1]])
+	}
+	for i := range g.edges {
+		g.edges[i].t = 1 // skip the link animation
+	}
+	g.updateBeatInfos()
+	g.refreshDrumRow()
+	g.logger.Infof("[GAME] LoadProject: %d nodes, %d edges, %d rows", len(p.Nodes), len(p.Edges), len(p.Rows))
+	return nil
+}
+
+// EncodeProject packs p into a compact URL-safe string.
+func EncodeProject(p Project) (string, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(data); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return projectVersion + base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecodeProject unpacks a string produced by EncodeProject.
+func DecodeProject(s string) (Project, error) {
+	var p Project
+	data, ok := strings.CutPrefix(s, projectVersion)
+	if !ok {
+		return p, errors.New("unsupported project version")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return p, fmt.Errorf("decode project: %w", err)
+	}
+	js, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(raw)), maxProjectSize))
+	if err != nil {
+		return p, fmt.Errorf("inflate project: %w", err)
+	}
+	if err := json.Unmarshal(js, &p); err != nil {
+		return p, fmt.Errorf("parse project: %w", err)
+	}
+	return p, p.validate()
+}
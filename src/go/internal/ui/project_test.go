@@ -0,0 +1,160 @@
+package ui
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ingyamilmolinar/tunkul/core/engine"
+	"github.com/ingyamilmolinar/tunkul/core/model"
+	"github.com/ingyamilmolinar/tunkul/internal/audio"
+)
+
+func buildProjectGame(t *testing.T) *Game {
+	t.Helper()
+	g := New(testLogger)
+	g.Layout(640, 480)
+	a := g.tryAddNode(0, 0, model.NodeTypeRegular)
+	b := g.tryAddNode(3, 0, model.NodeTypeRegular)
+	c := g.tryAddNode(3, 2, model.NodeTypeRegular)
+	g.addEdge(a, b)
+	g.addEdge(b, c)
+	g.drum.AddRow()
+	g.Update()
+	g.pendingStartRow = 1
+	g.tryAddNode(5, 5, model.NodeTypeRegular)
+	r := g.drum.Rows[1]
+	r.Instrument = "kick"
+	r.Name = "Boom"
+	r.Volume = 0.5
+	r.Pan = -0.25
+	r.Choke = 2
+	r.Muted = true
+	r.Params.Pitch = 0.7
+	r.Effects = audio.EffectSettings{Filter: audio.FilterLowPass, Cutoff: 0.4, ReverbMix: 0.3}
+	r.MIDIChannel, r.MIDINote = 3, 50
+	r.Length = 3
+	r.Rate = engine.Rate{Num: 3, Den: 2}
+	g.drum.SetBPM(97)
+	g.drum.Quantize = engine.QuantizeBar
+	return g
+}
+
+func TestProjectRoundTripsThroughURL(t *testing.T) {
+	g := buildProjectGame(t)
+	want := g.Project()
+	s, err := EncodeProject(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := DecodeProject(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Fatalf("decoded %+v\nwant %+v", p, want)
+	}
+
+	h := New(testLogger)
+	h.Layout(640, 480)
+	if err := h.LoadProject(p); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.Project(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("reloaded %+v\nwant %+v", got, want)
+	}
+	if len(h.path(0).Beats) != len(g.path(0).Beats) {
+		t.Fatalf("beat path has %d steps, want %d", len(h.path(0).Beats), len(g.path(0).Beats))
+	}
+	if h.start == nil || h.start.I != 0 || h.start.J != 0 {
+		t.Fatalf("start node not restored: %+v", h.start)
+	}
+	if n := h.drum.Rows[1].Node; n == nil || n.I != 5 || n.J != 5 || !n.Start {
+		t.Fatalf("row 1 origin not restored: %+v", n)
+	}
+	if h.drum.BPM() != 97 || h.drum.Rows[1].Name != "Boom" {
+		t.Fatalf("bpm %d row name %q", h.drum.BPM(), h.drum.Rows[1].Name)
+	}
+}
+
+func TestLoadProjectFallsBackForMissingInstrument(t *testing.T) {
+	g := New(testLogger)
+	p := Project{Rows: []ProjectRow{{Instrument: "not-loaded", Origin: -1, Volume: 1}}}
+	if err := g.LoadProject(p); err != nil {
+		t.Fatal(err)
+	}
+	inst := audio.Instruments()[0]
+	if got := g.drum.Rows[0].Instrument; got != inst {
+		t.Fatalf("instrument %q", got)
+	}
+	if got, want := g.drum.Rows[0].Name, strings.ToUpper(inst[:1])+inst[1:]; got != want {
+		t.Fatalf("unnamed row called %q, want %q", got, want)
+	}
+}
+
+func TestDecodeProjectRejectsBadInput(t *testing.T) {
+	for _, s := range []string{"", "9abc", "1!!!", "1AAAA"} {
+		if _, err := DecodeProject(s); err == nil {
+			t.Fatalf("%q decoded without error", s)
+		}
+	}
+	bad := Project{Nodes: []ProjectNode{{}}, Edges: [][2]int{{0, 3}}, Rows: []ProjectRow{{Origin: -1}}}
+	s, err := EncodeProject(bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeProject(s); err == nil {
+		t.Fatal("out-of-range edge accepted")
+	}
+}
+
+// fragment encodes raw project JSON the way EncodeProject would, so tests
+// can hand-craft projects the encoder would never produce.
+func fragment(t *testing.T, js string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(js))
+	w.Close()
+	return projectVersion + base64.RawURLEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestDecodeProjectRejectsHostileSettings(t *testing.T) {
+	for _, js := range []string{
+		`{"b":1000000000000,"r":[{"o":-1,"v":1}]}`,
+		`{"b":-5,"r":[{"o":-1,"v":1}]}`,
+		`{"l":1000000000,"r":[{"o":-1,"v":1}]}`,
+		`{"r":[{"o":-1,"v":5}]}`,
+		`{"r":[{"o":-1,"v":1,"p":-3}]}`,
+		`{"r":[{"o":-1,"v":1,"c":9}]}`,
+		`{"r":[{"o":-1,"v":1,"f":{"Drive":7}}]}`,
+		`{"r":[{"o":-1,"v":1,"f":{"Filter":9}}]}`,
+		`{"r":[{"o":-1,"v":1,"f":{"DelayDiv":-1}}]}`,
+		`{"r":[{"o":-1,"v":1,"x":[17,36]}]}`,
+		`{"r":[{"o":-1,"v":1,"x":[10,300]}]}`,
+	} {
+		if _, err := DecodeProject(fragment(t, js)); err == nil {
+			t.Errorf("%s decoded without error", js)
+		}
+	}
+}
+
+func TestLoadProjectClampsDrumParams(t *testing.T) {
+	p, err := DecodeProject(fragment(t, `{"r":[{"i":"kick","o":-1,"v":1,"k":{"Decay":2000,"Pitch":-9}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := New(testLogger)
+	if err := g.LoadProject(p); err != nil {
+		t.Fatal(err)
+	}
+	if got := g.drum.Rows[0].Params; got.Decay != 1 || got.Pitch != -1 {
+		t.Fatalf("params not clamped: %+v", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"math"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
@@ -13,6 +14,7 @@ import (
 type Slider struct {
 	r        image.Rectangle
 	Value    float64
+	Format   func(v float64) string // label text; nil shows a percentage
 	dragging bool
 }
 
@@ -53,7 +55,7 @@ func (s *Slider) setFromX(mx int) {
 	s.Value = pos / float64(w)
 }
 
-// Draw renders the slider and its percentage label.
+// Draw renders the slider and its label.
 func (s *Slider) Draw(dst *ebiten.Image) {
 	// track
 	trackY := s.r.Min.Y + s.r.Dy()/2 - 2
@@ -67,5 +69,20 @@ func (s *Slider) Draw(dst *ebiten.Image) {
 
 	// label
 	txt := fmt.Sprintf("%d%%", int(s.Value*100))
+	if s.Format != nil {
+		txt = s.Format(s.Value)
+	}
 	ebitenutil.DebugPrintAt(dst, txt, s.r.Min.X, s.r.Min.Y-15)
 }
+
+// panLabel formats a pan slider value as L/C/R and a percentage.
+func panLabel(v float64) string {
+	p := int(math.Round((v*2 - 1) * 100))
+	switch {
+	case p < 0:
+		return fmt.Sprintf("L%d", -p)
+	case p > 0:
+		return fmt.Sprintf("R%d", p)
+	}
+	return "C"
+}
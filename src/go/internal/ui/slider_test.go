@@ -21,3 +21,12 @@ func TestSliderFullRange(t *testing.T) {
 	}
 	s.Handle(0, 5, false)
 }
+
+func TestPanLabel(t *testing.T) {
+	cases := map[float64]string{0: "L100", 0.25: "L50", 0.5: "C", 1: "R100"}
+	for v, want := range cases {
+		if got := panLabel(v); got != want {
+			t.Fatalf("panLabel(%f)=%q want %q", v, got, want)
+		}
+	}
+}
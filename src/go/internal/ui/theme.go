@@ -21,10 +21,13 @@ var (
 	colStepOff    = color.RGBA{25, 25, 25, 255}
 	colStepBorder = color.RGBA{60, 60, 60, 255}
 	colHighlight  = color.RGBA{240, 240, 40, 255}
+	colCursor     = color.RGBA{120, 220, 255, 255}
 
 	colTimelineTotal  = color.RGBA{40, 40, 40, 255}
 	colTimelineView   = color.RGBA{0, 160, 200, 255}
 	colTimelineCursor = color.RGBA{240, 240, 40, 255}
+	colTimelineCycle  = color.RGBA{230, 130, 40, 255}
+	colRowWrap        = color.RGBA{230, 130, 40, 255}
 
 	NodeUI   = NodeStyle{Radius: 16, Fill: color.RGBA{80, 80, 80, 255}, Border: color.RGBA{220, 220, 220, 255}}
 	SignalUI = SignalStyle{Radius: 6, Color: color.RGBA{0, 160, 200, 255}}
@@ -1,29 +1,180 @@
-import init from './drums.js';
-
-let modulePromise = init();
-let mod;
 let ctx;
 const samples = {};
+const buses = new Map();
+let master;
 
 function getCtx() {
   if (!ctx) ctx = new (window.AudioContext || window.webkitAudioContext)();
   return ctx;
 }
 
-async function ensureModule() {
-  if (!mod) {
-    mod = await modulePromise;
+// The master bus mirrors the native one: gain, a limiter holding peaks under
+// the ceiling, a soft clip above the knee, then the meter.
+export function configureMaster(s) {
+  const c = getCtx();
+  master = {
+    input: c.createGain(),
+    limiter: c.createDynamicsCompressor(),
+    clip: c.createWaveShaper(),
+    meter: c.createAnalyser(),
+    window: Math.floor(c.sampleRate * s.rms),
+    peakFall: s.peakFall,
+    peak: 0,
+    at: c.currentTime,
+  };
+  master.input.gain.value = s.gain;
+  master.limiter.threshold.value = 20 * Math.log10(s.ceiling);
+  master.limiter.knee.value = 0;
+  master.limiter.ratio.value = 20;
+  master.limiter.attack.value = s.attack;
+  master.limiter.release.value = s.release;
+  master.clip.curve = softClipCurve(s.knee);
+  master.meter.fftSize = 32768;
+  master.input.connect(master.limiter);
+  master.limiter.connect(master.clip);
+  master.clip.connect(master.meter);
+  master.meter.connect(c.destination);
+}
+
+function softClipCurve(knee) {
+  const curve = new Float32Array(4096);
+  for (let i = 0; i < curve.length; i++) {
+    const x = (i / (curve.length - 1)) * 2 - 1;
+    const a = Math.abs(x);
+    const y = a <= knee ? a : knee + (1 - knee) * Math.tanh((a - knee) / (1 - knee));
+    curve[i] = Math.sign(x) * y;
   }
-  return mod;
+  return curve;
 }
 
-const RENDER = {
-  snare: 'render_snare',
-  kick: 'render_kick',
-  hihat: 'render_hihat',
-  tom: 'render_tom',
-  clap: 'render_clap',
-};
+export function setMasterGain(g) {
+  if (master) master.input.gain.value = g;
+}
+
+// masterLevels reads the meter: a falling peak, the RMS over the window and
+// the limiter gain.
+export function masterLevels() {
+  if (!master) return { peak: 0, rms: 0, gain: 1 };
+  const c = getCtx();
+  const data = new Float32Array(master.meter.fftSize);
+  master.meter.getFloatTimeDomainData(data);
+  let peak = 0;
+  let sum = 0;
+  const from = Math.max(0, data.length - master.window);
+  for (let i = from; i < data.length; i++) {
+    peak = Math.max(peak, Math.abs(data[i]));
+    sum += data[i] * data[i];
+  }
+  const dt = c.currentTime - master.at;
+  master.at = c.currentTime;
+  master.peak = Math.max(peak, master.peak * Math.exp(-dt / master.peakFall));
+  return {
+    peak: master.peak,
+    rms: Math.sqrt(sum / (data.length - from)),
+    gain: Math.pow(10, master.limiter.reduction / 20),
+  };
+}
+
+// output is where buses and dry hits go: the master bus once it is set up.
+function output() {
+  return master ? master.input : getCtx().destination;
+}
+
+// An effects bus mirrors the native chain: drive, filter, a feedback delay
+// mixed with the dry signal, then reverb mixed over that.
+function newBus() {
+  const c = getCtx();
+  const b = {
+    input: c.createWaveShaper(),
+    filter: c.createBiquadFilter(),
+    dry: c.createGain(),
+    delay: c.createDelay(4),
+    feedback: c.createGain(),
+    delayWet: c.createGain(),
+    post: c.createGain(),
+    reverb: c.createConvolver(),
+    reverbWet: c.createGain(),
+    reverbSeconds: 0,
+  };
+  b.filter.connect(b.dry);
+  b.dry.connect(b.post);
+  b.dry.connect(b.delay);
+  b.delay.connect(b.feedback);
+  b.feedback.connect(b.delay);
+  b.delay.connect(b.delayWet);
+  b.delayWet.connect(b.post);
+  b.post.connect(output());
+  b.post.connect(b.reverb);
+  b.reverb.connect(b.reverbWet);
+  b.reverbWet.connect(output());
+  return b;
+}
+
+// driveCurve is the saturator's tanh curve for a drive of 0..1.
+function driveCurve(drive) {
+  const g = 1 + 9 * drive;
+  const curve = new Float32Array(1024);
+  for (let i = 0; i < curve.length; i++) {
+    const x = (i / (curve.length - 1)) * 2 - 1;
+    curve[i] = Math.tanh(g * x) / Math.tanh(g);
+  }
+  return curve;
+}
+
+// impulse is decaying stereo noise that falls by 60dB over seconds.
+function impulse(seconds) {
+  const c = getCtx();
+  const n = Math.max(1, Math.floor(c.sampleRate * seconds));
+  const buf = c.createBuffer(2, n, c.sampleRate);
+  for (let ch = 0; ch < 2; ch++) {
+    const d = buf.getChannelData(ch);
+    for (let i = 0; i < n; i++) {
+      d[i] = (Math.random() * 2 - 1) * Math.pow(1e-3, i / n);
+    }
+  }
+  return buf;
+}
+
+export function configureBus(bus, s) {
+  let b = buses.get(bus);
+  if (!b) {
+    b = newBus();
+    buses.set(bus, b);
+  }
+  b.input.curve = s.drive > 0 ? driveCurve(s.drive) : null;
+  b.input.disconnect();
+  if (s.filter) {
+    b.filter.type = s.filter;
+    b.filter.frequency.value = s.cutoff;
+    b.filter.Q.value = s.q;
+    b.input.connect(b.filter);
+  } else {
+    b.input.connect(b.dry);
+  }
+  b.delay.delayTime.value = Math.min(s.delay, 4);
+  b.feedback.gain.value = s.feedback;
+  b.delayWet.gain.value = s.delayMix;
+  b.reverbWet.gain.value = s.reverbMix;
+  if (s.reverbMix > 0 && s.reverbSeconds !== b.reverbSeconds) {
+    b.reverb.buffer = impulse(s.reverbSeconds);
+    b.reverbSeconds = s.reverbSeconds;
+  }
+}
+
+export function releaseBus(bus) {
+  const b = buses.get(bus);
+  if (!b) return;
+  for (const node of Object.values(b)) {
+    if (node instanceof AudioNode) node.disconnect();
+  }
+  buses.delete(bus);
+}
+
+// busInput is where a hit on bus enters the graph; bus 0 is dry.
+function busInput(bus) {
+  const b = buses.get(bus);
+  return b ? b.input : output();
+}
 
 export async function loadWav(id, url) {
   const res = await fetch(url);
@@ -32,44 +183,125 @@ export async function loadWav(id, url) {
   samples[id] = buf;
 }
 
-export async function playSound(id) {
-  const sr = 44100;
-  if (RENDER[id]) {
-    const m = await ensureModule();
-    const sec = id === 'snare' ? 0.25 : id === 'hihat' ? 0.125 : 0.5;
-    const frames = Math.floor(sr * sec);
-    const ptr = m._malloc(frames * 4);
-    if (!ptr) {
-      throw new Error('Failed to allocate memory for audio buffer.');
+// route returns the node a hit connects to: its effects bus, through a
+// stereo panner when pan is non-zero.
+function route(bus, pan) {
+  const c = getCtx();
+  const dest = busInput(bus);
+  if (!pan || !c.createStereoPanner) return dest;
+  const p = c.createStereoPanner();
+  p.pan.value = Math.max(-1, Math.min(1, pan));
+  p.connect(dest);
+  return p;
+}
+
+const CHOKE_FADE = 0.005;
+const chokeGroups = {};
+
+// start plays src on bus at gain from time when on the AudioContext clock,
+// or immediately if when has passed. Any voice still sounding in the same
+// choke group is faded out as src starts. Group 0 never chokes.
+function start(src, bus, pan, choke, level = 1, when = 0) {
+  const c = getCtx();
+  const at = Math.max(c.currentTime, when || 0);
+  const gain = c.createGain();
+  gain.gain.value = Math.max(0, level);
+  src.connect(gain);
+  gain.connect(route(bus, pan));
+  if (choke) {
+    for (const v of chokeGroups[choke] || []) {
+      v.gain.gain.setValueAtTime(v.gain.gain.value, at);
+      v.gain.gain.linearRampToValueAtTime(0, at + CHOKE_FADE);
+      v.src.stop(at + CHOKE_FADE);
     }
-    m.ccall(RENDER[id], null, ['number','number','number'], [ptr, sr, frames]);
-    const data = new Float32Array(m.HEAPF32.buffer, ptr, frames).slice();
-    m._free(ptr);
-    const buffer = getCtx().createBuffer(1, frames, sr);
-    buffer.copyToChannel(data, 0);
-    const src = getCtx().createBufferSource();
-    src.buffer = buffer;
-    src.connect(getCtx().destination);
-    src.start();
-    return;
+    const voice = { src, gain };
+    chokeGroups[choke] = [voice];
+    src.onended = () => {
+      chokeGroups[choke] = (chokeGroups[choke] || []).filter((v) => v !== voice);
+    };
   }
+  src.start(at);
+}
+
+// now returns the AudioContext clock that start times are measured on.
+export function now() {
+  return getCtx().currentTime;
+}
+
+// resume restarts a context suspended by the browser's autoplay policy.
+export function resume() {
+  return getCtx().resume();
+}
+
+export async function playSound(id, bus = 0, pan = 0, choke = 0, gain = 1, when = 0) {
   const buf = samples[id];
   if (!buf) throw new Error('Unknown sound: ' + id);
   const src = getCtx().createBufferSource();
   src.buffer = buf;
-  src.connect(getCtx().destination);
-  src.start();
+  start(src, bus, pan, choke, gain, when);
+}
+
+export function playBuffer(data, sr, bus = 0, pan = 0, choke = 0, gain = 1, when = 0) {
+  const buffer = getCtx().createBuffer(1, data.length, sr);
+  buffer.copyToChannel(data, 0);
+  const src = getCtx().createBufferSource();
+  src.buffer = buffer;
+  start(src, bus, pan, choke, gain, when);
 }
 
 // Expose for Go
-window.playSound = async (id) => {
+window.playSound = async (id, bus, pan, choke, gain, when) => {
   try {
-    await playSound(id);
+    await playSound(id, bus, pan, choke, gain, when);
   } catch (err) {
     console.error('Error playing sound:', err);
   }
 };
 
+window.playBuffer = (data, sr, bus, pan, choke, gain, when) => {
+  try {
+    playBuffer(data, sr, bus, pan, choke, gain, when);
+  } catch (err) {
+    console.error('Error playing buffer:', err);
+  }
+};
+
+window.configureBus = (bus, settings) => {
+  try {
+    configureBus(bus, settings);
+  } catch (err) {
+    console.error('Error configuring effects bus:', err);
+  }
+};
+
+window.releaseBus = (bus) => {
+  releaseBus(bus);
+};
+
+window.configureMaster = (settings) => {
+  try {
+    configureMaster(settings);
+  } catch (err) {
+    console.error('Error setting up the master bus:', err);
+  }
+};
+
+window.setMasterGain = (g) => {
+  setMasterGain(g);
+};
+
+window.masterLevels = () => masterLevels();
+
+window.audioNow = now;
+
+window.resumeAudio = async () => {
+  try {
+    await resume();
+  } catch (err) {
+    console.error('Error resuming audio:', err);
+  }
+};
+
 window.loadWav = async (id, url) => {
   try {
     await loadWav(id, url);